@@ -0,0 +1,124 @@
+// Package client calls the controller http api, it is used by xrctl.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// same as the controller
+	RES_OK = 0
+
+	API_KEY_HEADER = "X-API-Key"
+)
+
+type Response struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Client struct {
+	BaseUrl string
+	ApiKey  string
+
+	hc *http.Client
+}
+
+func NewClient(profile *Profile) *Client {
+	return &Client{
+		BaseUrl: strings.TrimRight(profile.Url, "/"),
+		ApiKey:  profile.ApiKey,
+		hc:      &http.Client{Timeout: time.Duration(profile.Timeout) * time.Second},
+	}
+}
+
+// Call posts req as json to path and decodes the data of the response into out, which may be nil.
+func (c *Client) Call(path string, req, out interface{}) error {
+	if req == nil {
+		req = struct{}{}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	data, err := c.post(path, nil, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return decodeResponse(path, data, out)
+}
+
+// Upload posts body as it is, with query in the url, and decodes the response like Call.
+func (c *Client) Upload(path string, query url.Values, contentType string, body io.Reader, out interface{}) error {
+	data, err := c.post(path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(path, data, out)
+}
+
+// Download returns the body of a route answering files, such as format=csv.
+func (c *Client) Download(path string, query url.Values) ([]byte, error) {
+	data, err := c.post(path, query, "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		return nil, err
+	}
+	// errors still come as a json response
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := decodeResponse(path, data, nil); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (c *Client) post(path string, query url.Values, contentType string, body io.Reader) ([]byte, error) {
+	u := c.BaseUrl + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	httpReq, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if c.ApiKey != "" {
+		httpReq.Header.Set(API_KEY_HEADER, c.ApiKey)
+	}
+	rsp, err := c.hc.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: http %d: %s", path, rsp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func decodeResponse(path string, data []byte, out interface{}) error {
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("%s: bad response: %v", path, err)
+	}
+	if response.Code != RES_OK {
+		return fmt.Errorf("%s: %s", path, strings.TrimSpace(response.Msg))
+	}
+	if out != nil && len(response.Data) != 0 {
+		return json.Unmarshal(response.Data, out)
+	}
+	return nil
+}
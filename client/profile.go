@@ -0,0 +1,64 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-ini/ini"
+)
+
+const (
+	DEFAULT_PROFILE      = "default"
+	DEFAULT_PROFILE_FILE = ".xrctl.ini"
+	DEFAULT_URL          = "http://127.0.0.1:7878"
+	DEFAULT_TIMEOUT      = 10
+)
+
+// Profile is a section of the profile file:
+//
+//	[default]
+//	Url = http://127.0.0.1:7878
+//	ApiKey = ...
+//	Timeout = 10
+type Profile struct {
+	Url     string
+	ApiKey  string
+	Timeout int
+}
+
+func DefaultProfilePath() string {
+	return filepath.Join(os.Getenv("HOME"), DEFAULT_PROFILE_FILE)
+}
+
+// LoadProfile reads profile name from path. A missing default file gives the default profile,
+// XRCTL_URL and XRCTL_API_KEY override the file.
+func LoadProfile(path, name string) (*Profile, error) {
+	p := &Profile{Url: DEFAULT_URL, Timeout: DEFAULT_TIMEOUT}
+	if _, err := os.Stat(path); err == nil {
+		f, err := ini.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("load profile file[%s] error: %v", path, err)
+		}
+		section, err := f.GetSection(name)
+		if err != nil {
+			return nil, fmt.Errorf("no profile[%s] in %s", name, path)
+		}
+		if err := section.MapTo(p); err != nil {
+			return nil, fmt.Errorf("profile[%s] error: %v", name, err)
+		}
+	} else if name != DEFAULT_PROFILE || path != DefaultProfilePath() {
+		return nil, fmt.Errorf("profile file[%s] error: %v", path, err)
+	}
+
+	if v := os.Getenv("XRCTL_URL"); v != "" {
+		p.Url = v
+	}
+	if v := os.Getenv("XRCTL_API_KEY"); v != "" {
+		p.ApiKey = v
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DEFAULT_TIMEOUT
+	}
+	return p, nil
+}
@@ -0,0 +1,1158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	domainGroupColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"TYPE", "type"}, {"STATUS", "status"},
+		{"SHARE", "shareStatus"}, {"ADS", "adsStatus"}, {"SHOW GROUPS", "showGroupListStr"},
+		{"CHECK INTERVAL", "checkInterval"}, {"TENANT", "tenantID"}, {"TIME", "time"},
+	}
+	domainColumns = []column{
+		{"ID", "id"}, {"GROUP", "groupID"}, {"DOMAIN", "domain"}, {"STATUS", "status"}, {"TIME", "time"},
+	}
+	contentGroupColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"TYPE", "type"}, {"FORMATS", "formats"},
+		{"JSON URL", "jsonUrl"}, {"CHECK INTERVAL", "checkInterval"}, {"TENANT", "tenantID"}, {"TIME", "time"},
+	}
+	contentColumns = []column{
+		{"ID", "id"}, {"GROUP", "groupID"}, {"POSITION", "position"}, {"ENABLED", "enabled"},
+		{"PINNED", "pinned"}, {"PUBLISH AT", "publishAt"}, {"EXPIRE AT", "expireAt"}, {"TIME", "time"},
+	}
+	publishColumns = []column{
+		{"GROUP", "groupID"}, {"JSON URL", "jsonUrl"}, {"LAST SUCCESS", "lastSuccess"},
+		{"FAILURES", "consecutiveFailures"}, {"LAST ERROR", "lastError"}, {"DEGRADED", "degraded"},
+	}
+	expiryColumns = []column{
+		{"ID", "id"}, {"GROUP", "groupID"}, {"DOMAIN", "domain"}, {"STATUS", "status"},
+		{"REGISTRATION EXPIRES", "registrationExpiresAt"}, {"CERT EXPIRES", "certExpiresAt"},
+		{"DAYS LEFT", "daysLeft"}, {"EXPIRED", "expired"},
+	}
+	topologyGroupColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"TYPE", "type"}, {"STATUS", "status"},
+		{"DOMAINS", "domains"}, {"OK DOMAINS", "okDomains"}, {"HEALTHY", "healthy"},
+	}
+	topologyEdgeColumns = []column{
+		{"JUMP", "from"}, {"SHOW", "to"}, {"WEIGHT", "weight"}, {"MISSING", "missing"},
+	}
+	importColumns = []column{
+		{"LINE", "line"}, {"INPUT", "input"}, {"DOMAIN", "domain"}, {"GROUP", "groupID"},
+		{"RESULT", "result"}, {"ID", "id"}, {"MESSAGE", "message"},
+	}
+	healthColumns = []column{
+		{"ID", "id"}, {"GROUP", "groupID"}, {"DOMAIN ID", "domainID"}, {"DOMAIN", "domain"},
+		{"RESULT", "result"}, {"MESSAGE", "message"}, {"TIME", "time"},
+	}
+	tenantColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"DOMAIN GROUPS", "domainGroups"}, {"MAX DOMAIN GROUPS", "maxDomainGroups"},
+		{"CONTENT GROUPS", "contentGroups"}, {"MAX CONTENT GROUPS", "maxContentGroups"},
+		{"DOMAINS", "domains"}, {"MAX DOMAINS", "maxDomains"}, {"TIME", "time"},
+	}
+	apiKeyColumns = []column{
+		{"ID", "id"}, {"TENANT", "tenantID"}, {"NAME", "name"}, {"TIME", "time"},
+	}
+	webhookColumns = []column{
+		{"ID", "id"}, {"TENANT", "tenantID"}, {"URL", "url"}, {"EVENTS", "eventTypes"}, {"ENABLED", "enabled"}, {"TIME", "time"},
+	}
+	deliveryColumns = []column{
+		{"ID", "id"}, {"EVENT", "eventID"}, {"TYPE", "eventType"}, {"STATUS", "status"}, {"ATTEMPTS", "attempts"},
+		{"NEXT ATTEMPT", "nextAttemptAt"}, {"CODE", "responseCode"}, {"ERROR", "lastError"}, {"DELIVERED", "deliveredAt"},
+	}
+	publishLogColumns = []column{
+		{"ID", "id"}, {"GROUP", "groupID"}, {"SUCCESS", "success"}, {"JSON URL", "jsonUrl"}, {"ERROR", "error"}, {"TIME", "time"},
+	}
+	auditColumns = []column{
+		{"ID", "id"}, {"TENANT", "tenantID"}, {"ACTOR", "actor"}, {"ACTION", "action"}, {"CODE", "code"},
+		{"MESSAGE", "message"}, {"IP", "ip"}, {"REQUEST", "requestID"}, {"TIME", "time"},
+	}
+)
+
+var commands = []command{
+	{"domain-group", "list", "list domain groups", listDomainGroups},
+	{"domain-group", "get", "-id N: show a domain group", getDomainGroup},
+	{"domain-group", "add", "-name S [-type 0|1] [-tenant N]: add a domain group, type 1 is jump", addDomainGroup},
+	{"domain-group", "update", "-id N [-name S] [-type 0|1] [-show-groups 1:3,2]: update a domain group, show groups as id[:weight]", updateDomainGroup},
+	{"domain-group", "topology", "[-format dot]: show jump groups, their show groups and health", showTopology},
+	{"domain-group", "delete", "-id N: delete a domain group and its domains", deleteByID("/domain/delete_domain_group", "domain group")},
+	{"domain-group", "enable", "-id N: put a domain group online", setDomainGroupStatus(0)},
+	{"domain-group", "disable", "-id N: take a domain group offline", setDomainGroupStatus(1)},
+	{"domain-group", "set-tenant", "-id N -tenant N: move a domain group to a tenant, 0 for none", setGroupTenant("domain")},
+
+	{"domain", "list", "-group N: list the domains of a group", listDomains},
+	{"domain", "add", "-group N -domain S: add a domain", addDomain},
+	{"domain", "update", "-id N -domain S: change a domain", updateDomain},
+	{"domain", "delete", "-id N: delete a domain", deleteByID("/domain/delete_domain", "domain")},
+	{"domain", "up", "-id N: mark a domain ok", setDomainStatus(0)},
+	{"domain", "down", "-id N: mark a domain down", setDomainStatus(1)},
+	{"domain", "import", "-file F [-group N] [-format text|csv|json] [-dry-run] [-allow-shared]: import domains", importDomains},
+	{"domain", "expiring", "[-days N] [-group N]: list domains expiring within days, and expired ones", expiringDomains},
+	{"domain", "set-expiry", "-id N -at YYYY-MM-DD|0: set the registration expiry of a domain, 0 clears it", setDomainExpiry},
+	{"domain", "probe-certs", "read the certificate expiry of every domain now", probeCerts},
+	{"domain", "export", "[-group N] [-format csv|json]: export groups and their domains", exportDomains},
+
+	{"content-group", "list", "list content groups", listContentGroups},
+	{"content-group", "get", "-id N: show a content group", getContentGroup},
+	{"content-group", "add", "-name S [-type N] [-formats json,rss] [-jsonp-callback S] [-tenant N]: add a content group", addContentGroup},
+	{"content-group", "update", "-id N [-name S] [-type N]: update a content group", updateContentGroup},
+	{"content-group", "delete", "-id N: delete a content group and its content", deleteByID("/domain/delete_content_group", "content group")},
+	{"content-group", "set-tenant", "-id N -tenant N: move a content group to a tenant, 0 for none", setGroupTenant("content")},
+
+	{"content", "list", "-group N: list the content of a group", listContent},
+	{"content", "add", "-group N -file video.json [-position N] [-pinned]: add video content", addContent},
+	{"content", "update", "-id N -file video.json: replace the video of content", updateContent},
+	{"content", "delete", "-id N: delete content", deleteByID("/domain/delete_content", "content")},
+	{"content", "enable", "-id N: show content", setContentEnabled(true)},
+	{"content", "disable", "-id N: hide content", setContentEnabled(false)},
+
+	{"publish", "", "-group N: publish a content group now", publish},
+	{"publish-status", "", "[-group N]: show publish status", publishStatus},
+	{"publish-history", "", "-group N [-limit N]: show the publishes of a content group, latest first", publishHistory},
+	{"health", "", "[-group N] [-domain N] [-limit N]: show failed health checks, latest first", health},
+
+	{"tenant", "list", "list tenants with their usage", listTenants},
+	{"tenant", "add", "-name S [-max-domain-groups N] [-max-content-groups N] [-max-domains N]: add a tenant, 0 is unlimited", addTenant},
+	{"tenant", "update", "-id N [-name S] [-max-domain-groups N] [-max-content-groups N] [-max-domains N]: update a tenant", updateTenant},
+	{"tenant", "delete", "-id N: delete a tenant without groups and its api keys", deleteByID("/domain/delete_tenant", "tenant")},
+
+	{"api-key", "list", "list api keys", listApiKeys},
+	{"api-key", "add", "[-tenant N] [-name S]: add an api key, tenant 0 is an admin key", addApiKey},
+	{"api-key", "delete", "-id N: delete an api key", deleteByID("/domain/delete_api_key", "api key")},
+
+	{"webhook", "list", "list webhooks", listWebhooks},
+	{"webhook", "add", "-url U -events domain_status,content_published [-tenant N] [-secret S]: add a webhook, tenant 0 receives every tenant", addWebhook},
+	{"webhook", "delete", "-id N: delete a webhook and its deliveries", deleteByID("/domain/delete_webhook", "webhook")},
+	{"webhook", "deliveries", "-id N [-status 0|1|2] [-limit N]: show the deliveries of a webhook, latest first", webhookDeliveries},
+	{"webhook", "redeliver", "-id N: send a delivery again, dead ones included", redeliverWebhook},
+
+	{"audit", "", "[-action /domain/add_domain] [-before N] [-limit N]: show the audit log, latest first", auditLog},
+}
+
+func parseFlags(name string, args []string, setup func(fs *flag.FlagSet)) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	setup(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func requireID(name string, v int64) error {
+	if v == 0 {
+		return fmt.Errorf("-%s is required", name)
+	}
+	return nil
+}
+
+// call runs an api and decodes its data as generic rows.
+func (ctx *context) call(path string, req, out interface{}) error {
+	var data json.RawMessage
+	if err := ctx.c.Call(path, req, &data); err != nil {
+		return err
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return decodeRows(data, out)
+}
+
+func listDomainGroups(ctx *context, args []string) error {
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_domain_groups", nil, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(domainGroupColumns, rows)
+}
+
+func getDomainGroupRow(ctx *context, id int64) (map[string]interface{}, error) {
+	var row map[string]interface{}
+	err := ctx.call("/domain/get_domain_group_detail", map[string]interface{}{"groupID": id}, &row)
+	if err == nil {
+		row["id"] = id
+	}
+	return row, err
+}
+
+func getDomainGroup(ctx *context, args []string) error {
+	var id int64
+	if _, err := parseFlags("domain-group get", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "domain group id")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	row, err := getDomainGroupRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	return ctx.out.row(domainGroupColumns, row)
+}
+
+func addDomainGroup(ctx *context, args []string) error {
+	var name string
+	var t, tenant int64
+	if _, err := parseFlags("domain-group add", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&name, "name", "", "group name")
+		fs.Int64Var(&t, "type", 0, "0 show, 1 jump")
+		fs.Int64Var(&tenant, "tenant", 0, "owner tenant, the tenant of the api key by default")
+	}); err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	req := map[string]interface{}{"name": name, "type": t, "tenantID": tenant}
+	if err := ctx.call("/domain/add_domain_group", req, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("domain group %s added", name)
+}
+
+func updateDomainGroup(ctx *context, args []string) error {
+	var id, t int64
+	var name, showGroups string
+	fs, err := parseFlags("domain-group update", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "domain group id")
+		fs.StringVar(&name, "name", "", "group name")
+		fs.Int64Var(&t, "type", 0, "0 show, 1 jump")
+		fs.StringVar(&showGroups, "show-groups", "", "show groups of a jump group as id[:weight], comma separated")
+	})
+	if err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	// the api replaces every field, so start from the current group
+	row, err := getDomainGroupRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{
+		"id":         id,
+		"name":       row["name"],
+		"type":       row["type"],
+		"showGroups": row["showGroups"],
+	}
+	if isSet(fs, "name") {
+		req["name"] = name
+	}
+	if isSet(fs, "type") {
+		req["type"] = t
+	}
+	if isSet(fs, "show-groups") {
+		shows, err := parseShowGroups(showGroups)
+		if err != nil {
+			return err
+		}
+		req["showGroups"] = shows
+	}
+	if err := ctx.call("/domain/update_domain_group", req, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("domain group %d updated", id)
+}
+
+func showTopology(ctx *context, args []string) error {
+	var format string
+	if _, err := parseFlags("domain-group topology", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", "", "dot prints a graphviz graph")
+	}); err != nil {
+		return err
+	}
+	if format == "dot" {
+		data, err := ctx.c.Download("/domain/get_show_topology", url.Values{"format": {"dot"}})
+		if err != nil {
+			return err
+		}
+		_, err = ctx.out.w.Write(data)
+		return err
+	}
+	var topo struct {
+		Groups []map[string]interface{} `json:"groups"`
+		Edges  []map[string]interface{} `json:"edges"`
+	}
+	if err := ctx.call("/domain/get_show_topology", nil, &topo); err != nil {
+		return err
+	}
+	if ctx.out.format == OUTPUT_JSON {
+		return ctx.out.json(topo)
+	}
+	if err := ctx.out.rows(topologyGroupColumns, topo.Groups); err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.out.w)
+	return ctx.out.rows(topologyEdgeColumns, topo.Edges)
+}
+
+func setDomainGroupStatus(status int64) func(ctx *context, args []string) error {
+	return func(ctx *context, args []string) error {
+		var id int64
+		if _, err := parseFlags("domain-group status", args, func(fs *flag.FlagSet) {
+			fs.Int64Var(&id, "id", 0, "domain group id")
+		}); err != nil {
+			return err
+		}
+		if err := requireID("id", id); err != nil {
+			return err
+		}
+		row, err := getDomainGroupRow(ctx, id)
+		if err != nil {
+			return err
+		}
+		req := map[string]interface{}{
+			"id":          id,
+			"status":      status,
+			"shareStatus": row["shareStatus"],
+			"adsStatus":   row["adsStatus"],
+		}
+		if err := ctx.call("/domain/setting_domain_group", req, nil); err != nil {
+			return err
+		}
+		return ctx.out.done("domain group %d status set to %d", id, status)
+	}
+}
+
+func listDomains(ctx *context, args []string) error {
+	var group int64
+	if _, err := parseFlags("domain list", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "domain group id")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("group", group); err != nil {
+		return err
+	}
+	var list struct {
+		DomainList []map[string]interface{} `json:"domainList"`
+	}
+	if err := ctx.call("/domain/get_domain_list", map[string]interface{}{"groupID": group}, &list); err != nil {
+		return err
+	}
+	return ctx.out.rows(domainColumns, list.DomainList)
+}
+
+func addDomain(ctx *context, args []string) error {
+	var group int64
+	var domain string
+	if _, err := parseFlags("domain add", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "domain group id")
+		fs.StringVar(&domain, "domain", "", "domain")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("group", group); err != nil {
+		return err
+	}
+	if domain == "" {
+		return fmt.Errorf("-domain is required")
+	}
+	if err := ctx.call("/domain/add_domain", map[string]interface{}{"groupID": group, "domain": domain}, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("domain %s added to group %d", domain, group)
+}
+
+func updateDomain(ctx *context, args []string) error {
+	var id int64
+	var domain string
+	if _, err := parseFlags("domain update", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "domain id")
+		fs.StringVar(&domain, "domain", "", "domain")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	if domain == "" {
+		return fmt.Errorf("-domain is required")
+	}
+	if err := ctx.call("/domain/update_domain", map[string]interface{}{"id": id, "domain": domain}, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("domain %d updated", id)
+}
+
+func setDomainStatus(status int64) func(ctx *context, args []string) error {
+	return func(ctx *context, args []string) error {
+		var id int64
+		if _, err := parseFlags("domain status", args, func(fs *flag.FlagSet) {
+			fs.Int64Var(&id, "id", 0, "domain id")
+		}); err != nil {
+			return err
+		}
+		if err := requireID("id", id); err != nil {
+			return err
+		}
+		if err := ctx.call("/domain/off_domain", map[string]interface{}{"id": id, "status": status}, nil); err != nil {
+			return err
+		}
+		return ctx.out.done("domain %d status set to %d", id, status)
+	}
+}
+
+func importDomains(ctx *context, args []string) error {
+	var group int64
+	var file, format string
+	var dryRun, allowShared bool
+	if _, err := parseFlags("domain import", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&file, "file", "", "file of domains, - for stdin")
+		fs.Int64Var(&group, "group", 0, "target domain group id, 0 takes groups by the names in the file")
+		fs.StringVar(&format, "format", "", "text, csv or json, by the file extension when empty")
+		fs.BoolVar(&dryRun, "dry-run", false, "only report what would be imported")
+		fs.BoolVar(&allowShared, "allow-shared", false, "add domains that are in other groups too")
+	}); err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".csv":
+			format = "csv"
+		case ".json":
+			format = "json"
+		default:
+			format = "text"
+		}
+	}
+	query := url.Values{"format": {format}}
+	if group != 0 {
+		query.Set("group_id", strconv.FormatInt(group, 10))
+	}
+	if dryRun {
+		query.Set("dry_run", "1")
+	}
+	if allowShared {
+		query.Set("allow_shared", "1")
+	}
+
+	var raw json.RawMessage
+	if err := ctx.c.Upload("/domain/import_domains", query, "text/plain", bytes.NewReader(data), &raw); err != nil {
+		return err
+	}
+	if ctx.out.format == OUTPUT_JSON {
+		return ctx.out.json(&raw)
+	}
+	var report struct {
+		DryRun    bool                     `json:"dryRun"`
+		Total     json.Number              `json:"total"`
+		Added     json.Number              `json:"added"`
+		Duplicate json.Number              `json:"duplicate"`
+		Exists    json.Number              `json:"exists"`
+		Invalid   json.Number              `json:"invalid"`
+		Failed    json.Number              `json:"failed"`
+		Rows      []map[string]interface{} `json:"rows"`
+	}
+	if err := decodeRows(raw, &report); err != nil {
+		return err
+	}
+	if err := ctx.out.rows(importColumns, report.Rows); err != nil {
+		return err
+	}
+	return ctx.out.done("\ndry run %v: %s rows, %s added, %s duplicate, %s exists, %s invalid, %s failed",
+		report.DryRun, report.Total, report.Added, report.Duplicate, report.Exists, report.Invalid, report.Failed)
+}
+
+func exportDomains(ctx *context, args []string) error {
+	var group int64
+	var format string
+	if _, err := parseFlags("domain export", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "domain group id, 0 for all")
+		fs.StringVar(&format, "format", "json", "csv or json, both can be imported again")
+	}); err != nil {
+		return err
+	}
+	query := url.Values{"format": {format}}
+	if group != 0 {
+		query.Set("group_id", strconv.FormatInt(group, 10))
+	}
+	if format != "csv" {
+		var raw json.RawMessage
+		if err := ctx.c.Call("/domain/export_domains?"+query.Encode(), nil, &raw); err != nil {
+			return err
+		}
+		return ctx.out.json(&raw)
+	}
+	data, err := ctx.c.Download("/domain/export_domains", query)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.out.w.Write(data)
+	return err
+}
+
+func expiringDomains(ctx *context, args []string) error {
+	var days, group int64
+	if _, err := parseFlags("domain expiring", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&days, "days", 30, "days ahead")
+		fs.Int64Var(&group, "group", 0, "domain group id, 0 for all")
+	}); err != nil {
+		return err
+	}
+	query := url.Values{"days": {strconv.FormatInt(days, 10)}}
+	if group != 0 {
+		query.Set("group_id", strconv.FormatInt(group, 10))
+	}
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_expiring_domains?"+query.Encode(), nil, &rows); err != nil {
+		return err
+	}
+	if ctx.out.format == OUTPUT_TABLE {
+		for _, row := range rows {
+			for _, key := range []string{"registrationExpiresAt", "certExpiresAt"} {
+				row[key] = unixDate(row[key])
+			}
+		}
+	}
+	return ctx.out.rows(expiryColumns, rows)
+}
+
+func setDomainExpiry(ctx *context, args []string) error {
+	var id int64
+	var at string
+	if _, err := parseFlags("domain set-expiry", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "domain id")
+		fs.StringVar(&at, "at", "", "registration expiry date, YYYY-MM-DD in local time, 0 clears it")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	var expiresAt int64
+	switch at {
+	case "":
+		return fmt.Errorf("-at is required")
+	case "0":
+	default:
+		t, err := time.ParseInLocation("2006-01-02", at, time.Local)
+		if err != nil {
+			return fmt.Errorf("-at %q is not YYYY-MM-DD", at)
+		}
+		expiresAt = t.Unix()
+	}
+	if err := ctx.call("/domain/set_domain_expiry", map[string]interface{}{"id": id, "registrationExpiresAt": expiresAt}, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("domain %d registration expiry set to %s", id, at)
+}
+
+func probeCerts(ctx *context, args []string) error {
+	if err := ctx.call("/domain/probe_certs", nil, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("cert probe started")
+}
+
+// unixDate prints unix seconds of the api as a date, 0 stays unknown.
+func unixDate(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	sec, err := n.Int64()
+	if err != nil || sec == 0 {
+		return nil
+	}
+	return time.Unix(sec, 0).Format("2006-01-02 15:04")
+}
+
+func listContentGroups(ctx *context, args []string) error {
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_content_group", nil, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(contentGroupColumns, rows)
+}
+
+func getContentGroupRow(ctx *context, id int64) (map[string]interface{}, error) {
+	var row map[string]interface{}
+	err := ctx.call("/domain/get_content_group_detail", map[string]interface{}{"groupID": id}, &row)
+	if err == nil {
+		row["id"] = id
+	}
+	return row, err
+}
+
+func getContentGroup(ctx *context, args []string) error {
+	var id int64
+	if _, err := parseFlags("content-group get", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "content group id")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	row, err := getContentGroupRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	return ctx.out.row(contentGroupColumns, row)
+}
+
+func addContentGroup(ctx *context, args []string) error {
+	var name, formats, callback string
+	var t, tenant int64
+	if _, err := parseFlags("content-group add", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&name, "name", "", "group name")
+		fs.Int64Var(&tenant, "tenant", 0, "owner tenant, the tenant of the api key by default")
+		fs.Int64Var(&t, "type", 0, "content type")
+		fs.StringVar(&formats, "formats", "json", "published formats: json, jsonp, rss, atom, comma separated")
+		fs.StringVar(&callback, "jsonp-callback", "", "callback of the jsonp format")
+	}); err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	req := map[string]interface{}{
+		"name":          name,
+		"type":          t,
+		"formats":       splitList(formats),
+		"jsonpCallback": callback,
+		"tenantID":      tenant,
+	}
+	if err := ctx.call("/domain/add_content_group", req, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("content group %s added", name)
+}
+
+func updateContentGroup(ctx *context, args []string) error {
+	var id, t int64
+	var name string
+	fs, err := parseFlags("content-group update", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "content group id")
+		fs.StringVar(&name, "name", "", "group name")
+		fs.Int64Var(&t, "type", 0, "content type")
+	})
+	if err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	row, err := getContentGroupRow(ctx, id)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{"id": id, "name": row["name"], "type": row["type"]}
+	if isSet(fs, "name") {
+		req["name"] = name
+	}
+	if isSet(fs, "type") {
+		req["type"] = t
+	}
+	if err := ctx.call("/domain/update_content_group", req, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("content group %d updated", id)
+}
+
+func getContentRows(ctx *context, group int64) ([]map[string]interface{}, error) {
+	var list struct {
+		ContentList []map[string]interface{} `json:"contentList"`
+	}
+	err := ctx.call("/domain/get_content_list", map[string]interface{}{"groupID": group}, &list)
+	return list.ContentList, err
+}
+
+func listContent(ctx *context, args []string) error {
+	var group int64
+	if _, err := parseFlags("content list", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "content group id")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("group", group); err != nil {
+		return err
+	}
+	rows, err := getContentRows(ctx, group)
+	if err != nil {
+		return err
+	}
+	return ctx.out.rows(contentColumns, rows)
+}
+
+func readVideo(file string) (interface{}, error) {
+	if file == "" {
+		return nil, fmt.Errorf("-file is required")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var video interface{}
+	if err := json.Unmarshal(data, &video); err != nil {
+		return nil, fmt.Errorf("%s is not json: %v", file, err)
+	}
+	return video, nil
+}
+
+func addContent(ctx *context, args []string) error {
+	var group, position int64
+	var file string
+	var pinned bool
+	if _, err := parseFlags("content add", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "content group id")
+		fs.StringVar(&file, "file", "", "json file of the video")
+		fs.Int64Var(&position, "position", 0, "position in the group")
+		fs.BoolVar(&pinned, "pinned", false, "keep on top")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("group", group); err != nil {
+		return err
+	}
+	video, err := readVideo(file)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{"groupID": group, "position": position, "pinned": pinned, "video": video}
+	if err := ctx.call("/domain/add_video_content", req, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("content added to group %d", group)
+}
+
+func updateContent(ctx *context, args []string) error {
+	var id int64
+	var file string
+	if _, err := parseFlags("content update", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "content id")
+		fs.StringVar(&file, "file", "", "json file of the video")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	video, err := readVideo(file)
+	if err != nil {
+		return err
+	}
+	if err := ctx.call("/domain/update_video_content", map[string]interface{}{"id": id, "video": video}, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("content %d updated", id)
+}
+
+func setContentEnabled(enabled bool) func(ctx *context, args []string) error {
+	return func(ctx *context, args []string) error {
+		var id int64
+		if _, err := parseFlags("content enable", args, func(fs *flag.FlagSet) {
+			fs.Int64Var(&id, "id", 0, "content id")
+		}); err != nil {
+			return err
+		}
+		if err := requireID("id", id); err != nil {
+			return err
+		}
+		req := map[string]interface{}{"id": id, "enabled": enabled}
+		if err := ctx.call("/domain/setting_content", req, nil); err != nil {
+			return err
+		}
+		return ctx.out.done("content %d enabled set to %v", id, enabled)
+	}
+}
+
+func deleteByID(path, what string) func(ctx *context, args []string) error {
+	return func(ctx *context, args []string) error {
+		var id int64
+		if _, err := parseFlags("delete", args, func(fs *flag.FlagSet) {
+			fs.Int64Var(&id, "id", 0, what+" id")
+		}); err != nil {
+			return err
+		}
+		if err := requireID("id", id); err != nil {
+			return err
+		}
+		if err := ctx.call(path, map[string]interface{}{"id": id}, nil); err != nil {
+			return err
+		}
+		return ctx.out.done("%s %d deleted", what, id)
+	}
+}
+
+// getTenantRows flattens the usage of each tenant into its row.
+func getTenantRows(ctx *context) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_tenants", nil, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if usage, ok := row["usage"].(map[string]interface{}); ok {
+			for k, v := range usage {
+				row[k] = v
+			}
+		}
+	}
+	return rows, nil
+}
+
+func listTenants(ctx *context, args []string) error {
+	rows, err := getTenantRows(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.out.rows(tenantColumns, rows)
+}
+
+func tenantFlags(fs *flag.FlagSet, name *string, maxDomainGroups, maxContentGroups, maxDomains *int64) {
+	fs.StringVar(name, "name", "", "tenant name")
+	fs.Int64Var(maxDomainGroups, "max-domain-groups", 0, "most domain groups of the tenant, 0 is unlimited")
+	fs.Int64Var(maxContentGroups, "max-content-groups", 0, "most content groups of the tenant, 0 is unlimited")
+	fs.Int64Var(maxDomains, "max-domains", 0, "most domains of the tenant, 0 is unlimited")
+}
+
+func addTenant(ctx *context, args []string) error {
+	var name string
+	var maxDomainGroups, maxContentGroups, maxDomains int64
+	if _, err := parseFlags("tenant add", args, func(fs *flag.FlagSet) {
+		tenantFlags(fs, &name, &maxDomainGroups, &maxContentGroups, &maxDomains)
+	}); err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("-name is required")
+	}
+	req := map[string]interface{}{
+		"name":             name,
+		"maxDomainGroups":  maxDomainGroups,
+		"maxContentGroups": maxContentGroups,
+		"maxDomains":       maxDomains,
+	}
+	var row map[string]interface{}
+	if err := ctx.call("/domain/add_tenant", req, &row); err != nil {
+		return err
+	}
+	return ctx.out.done("tenant %s added with id %v", name, cell(row["id"]))
+}
+
+func updateTenant(ctx *context, args []string) error {
+	var id, maxDomainGroups, maxContentGroups, maxDomains int64
+	var name string
+	fs, err := parseFlags("tenant update", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "tenant id")
+		tenantFlags(fs, &name, &maxDomainGroups, &maxContentGroups, &maxDomains)
+	})
+	if err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	rows, err := getTenantRows(ctx)
+	if err != nil {
+		return err
+	}
+	var req map[string]interface{}
+	for _, row := range rows {
+		if cell(row["id"]) == strconv.FormatInt(id, 10) {
+			req = map[string]interface{}{
+				"id":               id,
+				"name":             row["name"],
+				"maxDomainGroups":  row["maxDomainGroups"],
+				"maxContentGroups": row["maxContentGroups"],
+				"maxDomains":       row["maxDomains"],
+			}
+		}
+	}
+	if req == nil {
+		return fmt.Errorf("no tenant %d", id)
+	}
+	if isSet(fs, "name") {
+		req["name"] = name
+	}
+	if isSet(fs, "max-domain-groups") {
+		req["maxDomainGroups"] = maxDomainGroups
+	}
+	if isSet(fs, "max-content-groups") {
+		req["maxContentGroups"] = maxContentGroups
+	}
+	if isSet(fs, "max-domains") {
+		req["maxDomains"] = maxDomains
+	}
+	if err := ctx.call("/domain/update_tenant", req, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("tenant %d updated", id)
+}
+
+func listApiKeys(ctx *context, args []string) error {
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_api_keys", nil, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(apiKeyColumns, rows)
+}
+
+// addApiKey prints the new key, the controller keeps only its hash.
+func addApiKey(ctx *context, args []string) error {
+	var tenant int64
+	var name string
+	if _, err := parseFlags("api-key add", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&tenant, "tenant", 0, "tenant of the key, 0 for an admin key")
+		fs.StringVar(&name, "name", "", "what the key is for")
+	}); err != nil {
+		return err
+	}
+	var row map[string]interface{}
+	if err := ctx.call("/domain/add_api_key", map[string]interface{}{"tenantID": tenant, "name": name}, &row); err != nil {
+		return err
+	}
+	columns := append(append([]column{}, apiKeyColumns...), column{"KEY", "key"})
+	return ctx.out.row(columns, row)
+}
+
+func listWebhooks(ctx *context, args []string) error {
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_webhooks", nil, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(webhookColumns, rows)
+}
+
+// addWebhook prints the secret receivers check the signature with, it is not shown again.
+func addWebhook(ctx *context, args []string) error {
+	var tenant int64
+	var u, events, secret string
+	if _, err := parseFlags("webhook add", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&u, "url", "", "url the events are posted to")
+		fs.StringVar(&events, "events", "", "event types, comma separated")
+		fs.Int64Var(&tenant, "tenant", 0, "tenant of the webhook, 0 for every tenant")
+		fs.StringVar(&secret, "secret", "", "signing secret, generated when empty")
+	}); err != nil {
+		return err
+	}
+	if u == "" || events == "" {
+		return fmt.Errorf("-url and -events are required")
+	}
+	req := map[string]interface{}{"url": u, "eventTypes": splitList(events), "tenantID": tenant, "secret": secret}
+	var row map[string]interface{}
+	if err := ctx.call("/domain/add_webhook", req, &row); err != nil {
+		return err
+	}
+	columns := append(append([]column{}, webhookColumns...), column{"SECRET", "secret"})
+	return ctx.out.row(columns, row)
+}
+
+func webhookDeliveries(ctx *context, args []string) error {
+	var id, status, limit int64
+	if _, err := parseFlags("webhook deliveries", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "webhook id")
+		fs.Int64Var(&status, "status", -1, "0 pending, 1 delivered, 2 dead, -1 for all")
+		fs.Int64Var(&limit, "limit", 50, "number of deliveries")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	req := map[string]interface{}{"webhookID": id, "status": status, "limit": limit}
+	if err := ctx.call("/domain/get_webhook_deliveries", req, &rows); err != nil {
+		return err
+	}
+	if ctx.out.format == OUTPUT_TABLE {
+		for _, row := range rows {
+			for _, key := range []string{"nextAttemptAt", "deliveredAt"} {
+				row[key] = unixDate(row[key])
+			}
+		}
+	}
+	return ctx.out.rows(deliveryColumns, rows)
+}
+
+func redeliverWebhook(ctx *context, args []string) error {
+	var id int64
+	if _, err := parseFlags("webhook redeliver", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&id, "id", 0, "delivery id")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("id", id); err != nil {
+		return err
+	}
+	if err := ctx.call("/domain/redeliver_webhook", map[string]interface{}{"id": id}, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("delivery %d queued", id)
+}
+
+// setGroupTenant moves a group of checkType, domain or content, to another tenant.
+func setGroupTenant(checkType string) func(ctx *context, args []string) error {
+	return func(ctx *context, args []string) error {
+		var id, tenant int64
+		fs, err := parseFlags(checkType+"-group set-tenant", args, func(fs *flag.FlagSet) {
+			fs.Int64Var(&id, "id", 0, checkType+" group id")
+			fs.Int64Var(&tenant, "tenant", 0, "tenant id, 0 for none")
+		})
+		if err != nil {
+			return err
+		}
+		if err := requireID("id", id); err != nil {
+			return err
+		}
+		if !isSet(fs, "tenant") {
+			return fmt.Errorf("-tenant is required")
+		}
+		req := map[string]interface{}{"type": checkType, "groupID": id, "tenantID": tenant}
+		if err := ctx.call("/domain/set_group_tenant", req, nil); err != nil {
+			return err
+		}
+		return ctx.out.done("%s group %d moved to tenant %d", checkType, id, tenant)
+	}
+}
+
+func publish(ctx *context, args []string) error {
+	var group int64
+	if _, err := parseFlags("publish", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "content group id")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("group", group); err != nil {
+		return err
+	}
+	if err := ctx.call("/domain/publish_content", map[string]interface{}{"groupID": group}, nil); err != nil {
+		return err
+	}
+	return ctx.out.done("content group %d published", group)
+}
+
+func publishStatus(ctx *context, args []string) error {
+	var group int64
+	if _, err := parseFlags("publish-status", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "content group id, 0 for all")
+	}); err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	if err := ctx.call("/domain/get_publish_status", map[string]interface{}{"groupID": group}, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(publishColumns, rows)
+}
+
+func publishHistory(ctx *context, args []string) error {
+	var group, limit int64
+	if _, err := parseFlags("publish-history", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "content group id")
+		fs.Int64Var(&limit, "limit", 50, "number of publishes")
+	}); err != nil {
+		return err
+	}
+	if err := requireID("group", group); err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	req := map[string]interface{}{"groupID": group, "limit": limit}
+	if err := ctx.call("/domain/get_publish_history", req, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(publishLogColumns, rows)
+}
+
+func auditLog(ctx *context, args []string) error {
+	var action string
+	var before, limit int64
+	if _, err := parseFlags("audit", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&action, "action", "", "route path, empty for all")
+		fs.Int64Var(&before, "before", 0, "entries older than this id, 0 for the latest")
+		fs.Int64Var(&limit, "limit", 50, "number of entries")
+	}); err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	req := map[string]interface{}{"action": action, "beforeID": before, "limit": limit}
+	if err := ctx.call("/domain/get_audit_log", req, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(auditColumns, rows)
+}
+
+func health(ctx *context, args []string) error {
+	var group, domain, limit int64
+	if _, err := parseFlags("health", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&group, "group", 0, "domain group id")
+		fs.Int64Var(&domain, "domain", 0, "domain id")
+		fs.Int64Var(&limit, "limit", 100, "number of checks")
+	}); err != nil {
+		return err
+	}
+	var rows []map[string]interface{}
+	req := map[string]interface{}{"groupID": group, "domainID": domain, "limit": limit}
+	if err := ctx.call("/domain/get_health_history", req, &rows); err != nil {
+		return err
+	}
+	return ctx.out.rows(healthColumns, rows)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// parseShowGroups reads id[:weight] items, a weight of 0 is the default of the controller.
+func parseShowGroups(s string) ([]map[string]int64, error) {
+	shows := make([]map[string]int64, 0)
+	for _, v := range splitList(s) {
+		idStr, weightStr := v, "0"
+		if i := strings.Index(v, ":"); i >= 0 {
+			idStr, weightStr = v[:i], v[i+1:]
+		}
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an id", idStr)
+		}
+		weight, err := strconv.ParseInt(weightStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a weight", weightStr)
+		}
+		shows = append(shows, map[string]int64{"showGroupID": id, "weight": weight})
+	}
+	return shows, nil
+}
@@ -0,0 +1,109 @@
+// xrctl manages the controller through its http api.
+//
+//	xrctl [-profile name] [-f profile file] [-o table|json] <resource> <action> [flags]
+//
+// Run xrctl -h for the resources and actions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/reechou/x-real-control/client"
+)
+
+type command struct {
+	resource string
+	action   string
+	usage    string
+	run      func(ctx *context, args []string) error
+}
+
+type context struct {
+	c   *client.Client
+	out *output
+}
+
+func main() {
+	fs := flag.NewFlagSet("xrctl", flag.ExitOnError)
+	profileName := fs.String("profile", client.DEFAULT_PROFILE, "profile section of the profile file")
+	profilePath := fs.String("f", client.DefaultProfilePath(), "profile file")
+	format := fs.String("o", OUTPUT_TABLE, "output format, table or json")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: xrctl [flags] <resource> <action> [action flags]\n\nflags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\ncommands:\n")
+		for _, cmd := range sortedCommands() {
+			fmt.Fprintf(os.Stderr, "  %-14s %-8s %s\n", cmd.resource, cmd.action, cmd.usage)
+		}
+	}
+	fs.Parse(os.Args[1:])
+
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd := findCommand(args)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "xrctl: unknown command %v\n\n", args)
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != OUTPUT_TABLE && *format != OUTPUT_JSON {
+		fmt.Fprintf(os.Stderr, "xrctl: unknown output format %q\n", *format)
+		os.Exit(2)
+	}
+
+	profile, err := client.LoadProfile(*profilePath, *profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xrctl: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := &context{
+		c:   client.NewClient(profile),
+		out: &output{w: os.Stdout, format: *format},
+	}
+	var cmdArgs []string
+	if cmd.action == "" {
+		cmdArgs = args[1:]
+	} else {
+		cmdArgs = args[2:]
+	}
+	if err := cmd.run(ctx, cmdArgs); err != nil {
+		fmt.Fprintf(os.Stderr, "xrctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func findCommand(args []string) *command {
+	for i := range commands {
+		cmd := &commands[i]
+		if cmd.resource != args[0] {
+			continue
+		}
+		if cmd.action == "" || (len(args) > 1 && cmd.action == args[1]) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func sortedCommands() []command {
+	list := append([]command{}, commands...)
+	sort.Sort(commandSorter(list))
+	return list
+}
+
+type commandSorter []command
+
+func (s commandSorter) Len() int      { return len(s) }
+func (s commandSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s commandSorter) Less(i, j int) bool {
+	if s[i].resource != s[j].resource {
+		return s[i].resource < s[j].resource
+	}
+	return s[i].action < s[j].action
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+)
+
+type column struct {
+	header string
+	key    string
+}
+
+type output struct {
+	w      io.Writer
+	format string
+}
+
+// rows prints a list of api objects, as a table of columns or as json.
+func (o *output) rows(columns []column, rows []map[string]interface{}) error {
+	if o.format == OUTPUT_JSON {
+		return o.json(rows)
+	}
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	for i, c := range columns {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, c.header)
+	}
+	fmt.Fprintln(tw)
+	for _, row := range rows {
+		for i, c := range columns {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, cell(row[c.key]))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func (o *output) row(columns []column, row map[string]interface{}) error {
+	return o.rows(columns, []map[string]interface{}{row})
+}
+
+func (o *output) json(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(o.w, "%s\n", data)
+	return err
+}
+
+// done reports an action without data.
+func (o *output) done(format string, args ...interface{}) error {
+	if o.format == OUTPUT_JSON {
+		return o.json(map[string]string{"result": fmt.Sprintf(format, args...)})
+	}
+	_, err := fmt.Fprintf(o.w, format+"\n", args...)
+	return err
+}
+
+func cell(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		if t == "" {
+			return "-"
+		}
+		return t
+	case []interface{}, map[string]interface{}:
+		data, _ := json.Marshal(t)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+// decodeRows keeps numbers as json.Number, so ids print as they are.
+func decodeRows(data []byte, out interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
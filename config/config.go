@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/coreos/pkg/capnslog"
@@ -17,10 +18,10 @@ var plog = capnslog.NewPackageLogger("github.com/reezhou/x-real-control", "confi
 type AliyunOss struct {
 	Endpoint        string
 	AccessKeyId     string
-	AccessKeySecret string
+	AccessKeySecret string `secret:"true"`
 	Bucket          string
 	Url             string
-	AliyunClient    *oss.Client
+	AliyunClient    *oss.Client `json:"-"`
 }
 
 type IPFilterConfig struct {
@@ -29,16 +30,37 @@ type IPFilterConfig struct {
 }
 
 type Config struct {
-	ConfigPath string
+	ConfigPath string `ini:"-"`
+	// only validate the config file and exit
+	CheckOnly bool `ini:"-" json:"-"`
+	// Key=value pairs of -set flags, they win over ini and env
+	Overrides []string `ini:"-" json:"-"`
 
 	Debug bool
+	// text, json or logfmt
+	LogFormat string
 
 	ListenAddr string
 	ListenPort int
+	// cidrs or ips of load balancers whose X-Forwarded-For, X-Real-IP and Forwarded are believed
+	TrustedProxies []string
+	// requests per minute per client ip, or per api key when X-API-Key is sent; 0 is unlimited.
+	// public routes are get_url, get_data and /content/, every other route is admin.
+	PublicRateLimit int
+	PublicRateBurst int
+	AdminRateLimit  int
+	AdminRateBurst  int
+	// refuse admin routes to callers without X-API-Key even before any key is added, public routes stay open
+	RequireApiKey bool
 
 	IfStartTimer  bool
 	IfUrlEncoding bool
 
+	// serve published content at /content/, always on without aliyun oss
+	IfServeContent bool
+	// public url of /content/, used as the content url handed out by get_data
+	ContentBaseUrl string
+
 	BaiduGroups   []int64
 	ZhihuGroups   []int64
 	BaiduUrlGroup []string
@@ -46,6 +68,18 @@ type Config struct {
 	DomainsTpl    string
 
 	CheckDomainUrls []string
+	// default seconds between checks of a group, groups may set their own
+	CheckInterval int
+	// seconds every check is moved randomly
+	CheckJitter int
+	// seconds between loads of new groups from db
+	RefreshInterval int
+	// seconds between checks of the config file for changes, 0 only reloads on SIGHUP
+	ConfigWatchInterval int
+	// seconds between probes of the certificates served by the domains, 0 is 6 hours
+	CertProbeInterval int
+	// events kept for clients of /api/v2/events resuming with Last-Event-ID, 0 is 1024
+	EventBufferSize int
 
 	utils.MysqlInfo
 	AliyunOss
@@ -57,20 +91,67 @@ func NewConfig() *Config {
 	initFlag(c)
 
 	if c.ConfigPath == "" {
-		plog.Errorf("Hawk must run with config file, please check.\n")
-		os.Exit(0)
+		fmt.Fprintln(os.Stderr, "wx-controller must run with config file: -c <file>")
+		os.Exit(2)
 	}
 
-	cfg, err := ini.Load(c.ConfigPath)
+	path, checkOnly := c.ConfigPath, c.CheckOnly
+	c, err := LoadConfig(path, c.Overrides)
 	if err != nil {
-		plog.Errorf("ini[%s] load error: %v\n", c.ConfigPath, err)
+		fmt.Fprintf(os.Stderr, "load config[%s] error: %v\n", path, err)
+		os.Exit(1)
+	}
+	errs := c.Validate()
+	if checkOnly {
+		if len(errs) == 0 {
+			fmt.Printf("config[%s] ok\n", c.ConfigPath)
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "config[%s] has %d problems:\n", c.ConfigPath, len(errs))
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+		}
+		os.Exit(1)
+	}
+	if len(errs) != 0 {
+		for _, err := range errs {
+			plog.Errorf("config error: %v\n", err)
+		}
 		os.Exit(1)
 	}
+
+	plog.Info(c)
+
+	return c
+}
+
+// String prints the config with secrets masked, so logging a config never leaks them.
+func (c *Config) String() string {
+	type plain Config
+	return fmt.Sprintf("%+v", (*plain)(c.Redacted()))
+}
+
+// LoadConfig reads the ini file at path, then applies the environment and overrides.
+func LoadConfig(path string, overrides []string) (*Config, error) {
+	c := &Config{ConfigPath: path, Overrides: overrides}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		plog.Errorf("ini[%s] load error: %v\n", path, err)
+		return nil, err
+	}
 	cfg.BlockMode = false
 	err = cfg.MapTo(c)
 	if err != nil {
 		plog.Errorf("config MapTo error: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+	if err = c.ApplyEnv(os.LookupEnv); err != nil {
+		plog.Errorf("config env error: %v\n", err)
+		return nil, err
+	}
+	if err = c.ApplyOverrides(overrides); err != nil {
+		plog.Errorf("config override error: %v\n", err)
+		return nil, err
 	}
 
 	for _, v := range c.BaiduUrlGroup {
@@ -88,21 +169,25 @@ func NewConfig() *Config {
 		c.ZhihuGroups = append(c.ZhihuGroups, groupId)
 	}
 
-	plog.Info(c)
-
-	return c
+	return c, nil
 }
 
 func initFlag(c *Config) {
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	v := fs.Bool("v", false, "Print version and exit")
 	fs.StringVar(&c.ConfigPath, "c", "", "wx-controller config file.")
+	fs.BoolVar(&c.CheckOnly, "check", false, "Validate the config file and exit, non-zero if it has problems.")
+	fs.Var((*overrideFlag)(&c.Overrides), "set", "Override a config key, e.g. -set MysqlInfo.Host=127.0.0.1:3306, repeatable.")
 
-	fs.Parse(os.Args[1:])
 	fs.Usage = func() {
-		fmt.Println("Usage: hawk -c hawk.ini")
+		fmt.Println("Usage: wx-controller -c controller.ini [-check] [-set Key=value]...")
 		fmt.Printf("\nglobal flags:\n")
 		fs.PrintDefaults()
+		fmt.Printf("\nevery config key can also be set by env %sSECTION_KEY, e.g. %sMYSQL_INFO_PASS,\n", ENV_PREFIX, ENV_PREFIX)
+		fmt.Printf("secret keys also by env %sSECTION_KEY%s holding the path of a secrets file.\n", ENV_PREFIX, ENV_FILE_SUFFIX)
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
 	}
 
 	if *v {
@@ -110,3 +195,14 @@ func initFlag(c *Config) {
 		os.Exit(0)
 	}
 }
+
+type overrideFlag []string
+
+func (o *overrideFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrideFlag) Set(v string) error {
+	*o = append(*o, v)
+	return nil
+}
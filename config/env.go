@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Every config key can be overridden by the environment variable
+// ENV_PREFIX + SECTION_KEY in upper snake case, e.g. XRC_LISTEN_PORT or XRC_MYSQL_INFO_PASS.
+// Lists are comma separated. Keys tagged secret also accept NAME_FILE, the path
+// of a file holding the value, e.g. XRC_ALIYUN_OSS_ACCESS_KEY_SECRET_FILE.
+// The order is defaults < ini < env < -set flags.
+const (
+	ENV_PREFIX      = "XRC_"
+	ENV_FILE_SUFFIX = "_FILE"
+)
+
+type configField struct {
+	// Key is the ini key, Section.Key for keys of a section
+	Key   string
+	Env   string
+	Value reflect.Value
+
+	secret bool
+}
+
+// fields lists the settable keys of the config.
+func (c *Config) fields() []configField {
+	var list []configField
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			st := sf.Type
+			for j := 0; j < st.NumField(); j++ {
+				if f, ok := newConfigField(sf.Name, st.Field(j), v.Field(i).Field(j)); ok {
+					list = append(list, f)
+				}
+			}
+			continue
+		}
+		if f, ok := newConfigField("", sf, v.Field(i)); ok {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+func newConfigField(section string, sf reflect.StructField, v reflect.Value) (configField, bool) {
+	if sf.PkgPath != "" || sf.Tag.Get("ini") == "-" || !settable(sf.Type) {
+		return configField{}, false
+	}
+	f := configField{
+		Key:    sf.Name,
+		Env:    ENV_PREFIX + upperSnake(sf.Name),
+		Value:  v,
+		secret: sf.Tag.Get("secret") == "true",
+	}
+	if section != "" {
+		f.Key = section + "." + sf.Name
+		f.Env = ENV_PREFIX + upperSnake(section) + "_" + upperSnake(sf.Name)
+	}
+	return f, true
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// ApplyEnv overrides the config with the environment, lookup is os.LookupEnv outside tests.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, f := range c.fields() {
+		value, ok := lookup(f.Env)
+		if f.secret {
+			if path, fok := lookup(f.Env + ENV_FILE_SUFFIX); fok {
+				if ok {
+					return fmt.Errorf("%s and %s are both set, use one of them", f.Env, f.Env+ENV_FILE_SUFFIX)
+				}
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("%s: %v", f.Env+ENV_FILE_SUFFIX, err)
+				}
+				value, ok = strings.TrimRight(string(data), "\r\n"), true
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := setFieldValue(f.Value, value); err != nil {
+			return fmt.Errorf("%s: %v", f.Env, err)
+		}
+	}
+	return nil
+}
+
+// ApplyOverrides sets Key=value pairs given by -set flags.
+func (c *Config) ApplyOverrides(overrides []string) error {
+	fields := make(map[string]configField)
+	for _, f := range c.fields() {
+		fields[strings.ToLower(f.Key)] = f
+	}
+	for _, o := range overrides {
+		idx := strings.Index(o, "=")
+		if idx <= 0 {
+			return fmt.Errorf("-set %q: want Key=value", o)
+		}
+		f, ok := fields[strings.ToLower(strings.TrimSpace(o[:idx]))]
+		if !ok {
+			return fmt.Errorf("-set %q: unknown key", o)
+		}
+		if err := setFieldValue(f.Value, o[idx+1:]); err != nil {
+			return fmt.Errorf("-set %s: %v", f.Key, err)
+		}
+	}
+	return nil
+}
+
+func setFieldValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a bool", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// upperSnake turns ListenPort into LISTEN_PORT and DBName into DB_NAME.
+func upperSnake(name string) string {
+	rs := []rune(name)
+	var out []rune
+	for i, r := range rs {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToUpper(r))
+	}
+	return string(out)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUpperSnake(t *testing.T) {
+	for name, want := range map[string]string{
+		"ListenPort":      "LISTEN_PORT",
+		"DBName":          "DB_NAME",
+		"IPDB":            "IPDB",
+		"IPFilterConfig":  "IP_FILTER_CONFIG",
+		"AccessKeySecret": "ACCESS_KEY_SECRET",
+		"MysqlInfo":       "MYSQL_INFO",
+	} {
+		if got := upperSnake(name); got != want {
+			t.Errorf("upperSnake(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	f, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("oss-secret\n")
+	f.Close()
+
+	env := map[string]string{
+		"XRC_LISTEN_PORT":                       "8080",
+		"XRC_IF_START_TIMER":                    "true",
+		"XRC_CHECK_DOMAIN_URLS":                 "a.example.com, b.example.com",
+		"XRC_MYSQL_INFO_PASS":                   "mysql-secret",
+		"XRC_ALIYUN_OSS_ACCESS_KEY_SECRET_FILE": f.Name(),
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	c := validConfig()
+	if err := c.ApplyEnv(lookup); err != nil {
+		t.Fatal(err)
+	}
+	if c.ListenPort != 8080 || !c.IfStartTimer || c.Pass != "mysql-secret" || c.AccessKeySecret != "oss-secret" {
+		t.Fatalf("env not applied: %+v", *c.Redacted())
+	}
+	if len(c.CheckDomainUrls) != 2 || c.CheckDomainUrls[1] != "b.example.com" {
+		t.Fatalf("list env not applied: %v", c.CheckDomainUrls)
+	}
+
+	// flags win over env
+	if err := c.ApplyOverrides([]string{"ListenPort=9090", "mysqlinfo.pass=flag-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.ListenPort != 9090 || c.Pass != "flag-secret" {
+		t.Fatalf("overrides not applied: %d %s", c.ListenPort, c.Pass)
+	}
+	if err := c.ApplyOverrides([]string{"NoSuchKey=1"}); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+
+	env["XRC_LISTEN_PORT"] = "port"
+	if err := validConfig().ApplyEnv(lookup); err == nil {
+		t.Fatal("bad integer accepted")
+	}
+	env["XRC_LISTEN_PORT"] = "8080"
+	env["XRC_ALIYUN_OSS_ACCESS_KEY_SECRET"] = "both"
+	if err := validConfig().ApplyEnv(lookup); err == nil {
+		t.Fatal("value and file both accepted")
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const (
+	REDACTED = "******"
+)
+
+// liveFields take effect on reload.
+var liveFields = []string{
+	"Debug",
+	"LogFormat",
+	"TrustedProxies",
+	"PublicRateLimit",
+	"PublicRateBurst",
+	"AdminRateLimit",
+	"AdminRateBurst",
+	"RequireApiKey",
+	"IfUrlEncoding",
+	"BaiduGroups",
+	"ZhihuGroups",
+	"BaiduUrlGroup",
+	"ZhihuUrlGroup",
+	"DomainsTpl",
+	"CheckDomainUrls",
+	"CheckInterval",
+	"CheckJitter",
+	"RefreshInterval",
+	"ConfigWatchInterval",
+	"CertProbeInterval",
+	"MaxOpenConns",
+	"MaxIdleConns",
+}
+
+// restartFields are only read at start, changing them needs a restart.
+var restartFields = []string{
+	"ListenAddr",
+	"ListenPort",
+	"IfStartTimer",
+	"IfServeContent",
+	"ContentBaseUrl",
+	"EventBufferSize",
+	"Host",
+	"User",
+	"Pass",
+	"DBName",
+	"Endpoint",
+	"AccessKeyId",
+	"AccessKeySecret",
+	"Bucket",
+	"Url",
+	"IPDB",
+	"FilterLocation",
+}
+
+// Reload reads the config file again. It returns the config to use from now on,
+// which is c with the live fields of the file applied, and the changed fields
+// that need a restart.
+func (c *Config) Reload() (*Config, []string, error) {
+	n, err := LoadConfig(c.ConfigPath, c.Overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	if errs := n.Validate(); len(errs) != 0 {
+		return nil, nil, fmt.Errorf("invalid config: %s", JoinErrors(errs))
+	}
+
+	active := *c
+	av := reflect.ValueOf(&active).Elem()
+	nv := reflect.ValueOf(n).Elem()
+	for _, name := range liveFields {
+		av.FieldByName(name).Set(nv.FieldByName(name))
+	}
+	var restart []string
+	cv := reflect.ValueOf(c).Elem()
+	for _, name := range restartFields {
+		if !reflect.DeepEqual(cv.FieldByName(name).Interface(), nv.FieldByName(name).Interface()) {
+			restart = append(restart, name)
+		}
+	}
+
+	return &active, restart, nil
+}
+
+// Redacted returns a copy of the config which is safe to log or show.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, f := range r.fields() {
+		if f.secret && f.Value.Kind() == reflect.String && f.Value.String() != "" {
+			f.Value.SetString(REDACTED)
+		}
+	}
+	r.AliyunClient = nil
+	return &r
+}
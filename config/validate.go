@@ -0,0 +1,207 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+// ConfigError is one problem of the config file, Field is the ini key.
+type ConfigError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ConfigError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+func JoinErrors(errs []error) string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate returns every problem of the config, nil if it is usable.
+func (c *Config) Validate() []error {
+	var errs []error
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	switch c.LogFormat {
+	case "", utils.LOG_FORMAT_TEXT, utils.LOG_FORMAT_JSON, utils.LOG_FORMAT_LOGFMT:
+	default:
+		add("LogFormat", "%q is unknown, use text, json or logfmt", c.LogFormat)
+	}
+	if c.ListenAddr != "" && !validHost(c.ListenAddr) {
+		add("ListenAddr", "%q is not a valid ip or host name", c.ListenAddr)
+	}
+	if c.ListenPort <= 0 || c.ListenPort > 65535 {
+		add("ListenPort", "must be between 1 and 65535, got %d", c.ListenPort)
+	}
+
+	for i, v := range c.TrustedProxies {
+		if !validCIDR(v) {
+			add("TrustedProxies", "entry %d %q is not an ip or cidr like 10.0.0.0/8", i, v)
+		}
+	}
+
+	for _, v := range []struct {
+		field string
+		value int
+	}{
+		{"PublicRateLimit", c.PublicRateLimit},
+		{"PublicRateBurst", c.PublicRateBurst},
+		{"AdminRateLimit", c.AdminRateLimit},
+		{"AdminRateBurst", c.AdminRateBurst},
+	} {
+		if v.value < 0 {
+			add(v.field, "cannot be negative")
+		}
+	}
+
+	if c.Host == "" {
+		add("MysqlInfo.Host", "is required, set it to the mysql address like 127.0.0.1:3306")
+	} else if !validHostPort(c.Host) {
+		add("MysqlInfo.Host", "%q is not a valid host or host:port", c.Host)
+	}
+	if c.DBName == "" {
+		add("MysqlInfo.DBName", "is required")
+	}
+	if c.MaxOpenConns < 0 {
+		add("MysqlInfo.MaxOpenConns", "cannot be negative")
+	}
+	if c.MaxIdleConns < 0 {
+		add("MysqlInfo.MaxIdleConns", "cannot be negative")
+	}
+
+	// aliyun oss is optional, but when used it needs every field
+	if c.Endpoint != "" {
+		if !validHost(strings.TrimPrefix(strings.TrimPrefix(c.Endpoint, "http://"), "https://")) {
+			add("AliyunOss.Endpoint", "%q is not a valid host name", c.Endpoint)
+		}
+		if c.AccessKeyId == "" {
+			add("AliyunOss.AccessKeyId", "is required when Endpoint is set")
+		}
+		if c.AccessKeySecret == "" {
+			add("AliyunOss.AccessKeySecret", "is required when Endpoint is set")
+		}
+		if c.Bucket == "" {
+			add("AliyunOss.Bucket", "is required when Endpoint is set")
+		}
+		if c.Url == "" {
+			add("AliyunOss.Url", "is required when Endpoint is set, it is the public url of the bucket")
+		} else if !validUrl(c.Url) {
+			add("AliyunOss.Url", "%q is not an absolute http or https url", c.Url)
+		}
+	}
+	if c.ContentBaseUrl != "" && !strings.HasPrefix(c.ContentBaseUrl, "/") && !validUrl(c.ContentBaseUrl) {
+		add("ContentBaseUrl", "%q must be an absolute http or https url or a path starting with /", c.ContentBaseUrl)
+	}
+
+	for i, v := range c.BaiduUrlGroup {
+		if _, err := strconv.ParseInt(v, 10, 0); err != nil {
+			add("BaiduUrlGroup", "entry %d %q is not a group id", i, v)
+		}
+	}
+	for i, v := range c.ZhihuUrlGroup {
+		if _, err := strconv.ParseInt(v, 10, 0); err != nil {
+			add("ZhihuUrlGroup", "entry %d %q is not a group id", i, v)
+		}
+	}
+	for i, v := range c.CheckDomainUrls {
+		if !validHostPort(v) {
+			add("CheckDomainUrls", "entry %d %q is not a valid host or host:port", i, v)
+		}
+	}
+
+	if c.DomainsTpl != "" {
+		if _, err := os.Stat(c.DomainsTpl); err != nil {
+			add("DomainsTpl", "cannot read %q: %v", c.DomainsTpl, err)
+		}
+	}
+	if c.IPDB != "" {
+		if _, err := os.Stat(c.IPDB); err != nil {
+			add("IPFilterConfig.IPDB", "cannot read %q: %v", c.IPDB, err)
+		}
+	}
+
+	if c.CheckInterval < 0 {
+		add("CheckInterval", "cannot be negative")
+	}
+	if c.CheckJitter < 0 {
+		add("CheckJitter", "cannot be negative")
+	} else if c.CheckInterval > 0 && c.CheckJitter >= c.CheckInterval {
+		add("CheckJitter", "must be less than CheckInterval %d", c.CheckInterval)
+	}
+	if c.RefreshInterval < 0 {
+		add("RefreshInterval", "cannot be negative")
+	}
+	if c.ConfigWatchInterval < 0 {
+		add("ConfigWatchInterval", "cannot be negative")
+	}
+	if c.CertProbeInterval < 0 {
+		add("CertProbeInterval", "cannot be negative")
+	}
+	if c.EventBufferSize < 0 {
+		add("EventBufferSize", "cannot be negative")
+	}
+
+	return errs
+}
+
+func validHost(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return true
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validHostPort(hostport string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return validHost(hostport)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return false
+	}
+	return validHost(host)
+}
+
+func validCIDR(s string) bool {
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
+
+func validUrl(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && validHostPort(u.Host)
+}
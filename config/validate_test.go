@@ -0,0 +1,65 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func validConfig() *Config {
+	c := &Config{ListenPort: 7878}
+	c.Host = "127.0.0.1:3306"
+	c.DBName = "x"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	if errs := validConfig().Validate(); len(errs) != 0 {
+		t.Fatalf("valid config has errors: %v", errs)
+	}
+
+	c := validConfig()
+	c.Host = ""
+	c.ListenPort = 0
+	c.Endpoint = "oss-cn-hangzhou.aliyuncs.com"
+	c.Url = "bucket.example.com"
+	c.BaiduUrlGroup = []string{"1", "x2"}
+	c.CheckDomainUrls = []string{"check.example.com:8080", "bad host"}
+	c.CheckInterval = 10
+	c.CheckJitter = 10
+
+	fields := make(map[string]bool)
+	for _, err := range c.Validate() {
+		fields[err.(*ConfigError).Field] = true
+	}
+	for _, f := range []string{
+		"ListenPort",
+		"MysqlInfo.Host",
+		"AliyunOss.AccessKeyId",
+		"AliyunOss.AccessKeySecret",
+		"AliyunOss.Bucket",
+		"AliyunOss.Url",
+		"BaiduUrlGroup",
+		"CheckDomainUrls",
+		"CheckJitter",
+	} {
+		if !fields[f] {
+			t.Errorf("missing error for %s, got %v", f, fields)
+		}
+	}
+	if len(fields) != 9 {
+		t.Errorf("unexpected errors: %v", fields)
+	}
+}
+
+func TestConfigStringRedacted(t *testing.T) {
+	c := validConfig()
+	c.Pass = "mysql-secret"
+	c.AccessKeySecret = "oss-secret"
+	s := c.String()
+	if strings.Contains(s, "mysql-secret") || strings.Contains(s, "oss-secret") || !strings.Contains(s, REDACTED) {
+		t.Fatalf("secrets not redacted: %s", s)
+	}
+	if c.Pass != "mysql-secret" {
+		t.Fatal("String changed the config")
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	ADMIN_SESSION_COOKIE = "xrc_session"
+	// the cookie is only read from requests with this header, a cross-site form cannot send it
+	ADMIN_SESSION_HEADER = "X-Xrc-Session"
+	ADMIN_SESSION_TTL    = 12 * time.Hour
+)
+
+var ErrSessionInvalid = errors.New("session expired, login again")
+
+type adminSession struct {
+	keyHash string
+	expires time.Time
+}
+
+// AdminSessions are the logins of the admin ui, each one acts with the api key it logged in with.
+// They live in memory, a controller restart logs everybody out.
+type AdminSessions struct {
+	sync.Mutex
+	clock utils.Clock
+	// by the sha256 of the token
+	sessions map[string]*adminSession
+}
+
+func NewAdminSessions(clock utils.Clock) *AdminSessions {
+	return &AdminSessions{
+		clock:    clock,
+		sessions: make(map[string]*adminSession),
+	}
+}
+
+// Create returns the token of a new session of the key of keyHash.
+func (as *AdminSessions) Create(keyHash string) (string, time.Time, error) {
+	token, err := NewApiKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	as.Lock()
+	defer as.Unlock()
+	now := as.clock.Now()
+	for k, v := range as.sessions {
+		if !v.expires.After(now) {
+			delete(as.sessions, k)
+		}
+	}
+	expires := now.Add(ADMIN_SESSION_TTL)
+	as.sessions[HashApiKey(token)] = &adminSession{keyHash: keyHash, expires: expires}
+	return token, expires, nil
+}
+
+// KeyHash returns the key hash of the session of token, "" when there is no such session.
+func (as *AdminSessions) KeyHash(token string) string {
+	as.Lock()
+	defer as.Unlock()
+	s := as.sessions[HashApiKey(token)]
+	if s == nil || !s.expires.After(as.clock.Now()) {
+		return ""
+	}
+	return s.keyHash
+}
+
+func (as *AdminSessions) Delete(token string) {
+	as.Lock()
+	defer as.Unlock()
+	delete(as.sessions, HashApiKey(token))
+}
+
+// AuthorizeSession is Authorize for a caller of the admin ui, the key of its session must still exist.
+func (cl *ControllerLogic) AuthorizeSession(token string, adminOnly bool) (int64, *ApiKeyInfo, error) {
+	info := cl.apiKeyByHash(cl.sessions.KeyHash(token))
+	if info == nil {
+		return 0, nil, ErrSessionInvalid
+	}
+	tenantID, err := keyTenant(info, adminOnly)
+	return tenantID, info, err
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
+)
+
+func TestAdminSessions(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1500000000, 0))
+	as := NewAdminSessions(clock)
+	token, expires, err := as.Create("hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expires.Equal(clock.Now().Add(ADMIN_SESSION_TTL)) {
+		t.Errorf("expires %v", expires)
+	}
+	if got := as.KeyHash(token); got != "hash" {
+		t.Errorf("got %q", got)
+	}
+	if got := as.KeyHash("guess"); got != "" {
+		t.Errorf("unknown token: got %q", got)
+	}
+	clock.Advance(ADMIN_SESSION_TTL)
+	if got := as.KeyHash(token); got != "" {
+		t.Errorf("expired: got %q", got)
+	}
+	token, _, _ = as.Create("hash")
+	if len(as.sessions) != 1 {
+		t.Errorf("expired sessions are kept: %d", len(as.sessions))
+	}
+	as.Delete(token)
+	if got := as.KeyHash(token); got != "" {
+		t.Errorf("deleted: got %q", got)
+	}
+}
+
+func newAdminTestServer() *XHttpServer {
+	clock := utils.NewFakeClock(time.Unix(1500000000, 0))
+	cl := &ControllerLogic{
+		cfg:   &config.Config{RequireApiKey: true},
+		clock: clock,
+		apiKeys: map[string]*ApiKeyInfo{
+			HashApiKey("admin"): {ID: 1, Name: "ops", TenantID: 0},
+			HashApiKey("team"):  {ID: 2, Name: "team", TenantID: 7},
+		},
+		sessions: NewAdminSessions(clock),
+	}
+	return &XHttpServer{logic: cl}
+}
+
+func TestAdminLoginSession(t *testing.T) {
+	xhs := newAdminTestServer()
+	token, _, err := xhs.logic.sessions.Create(HashApiKey("team"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := (&http.Cookie{Name: ADMIN_SESSION_COOKIE, Value: token}).String()
+
+	var tenant, keyID string
+	h := xhs.authorize("/domain/get_domain_groups", func(rsp http.ResponseWriter, req *http.Request) {
+		tenant, keyID = req.Header.Get(TENANT_HEADER), req.Header.Get(API_KEY_ID_HEADER)
+	})
+	call := func(withHeader bool) int {
+		tenant, keyID = "", ""
+		req, _ := http.NewRequest("POST", "/domain/get_domain_groups", nil)
+		req.Header.Set("Cookie", cookie)
+		if withHeader {
+			req.Header.Set(ADMIN_SESSION_HEADER, "1")
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+	if code := call(true); code != http.StatusOK || tenant != "7" || keyID != "2" {
+		t.Errorf("session call: got %d tenant %q key %q", code, tenant, keyID)
+	}
+	// a cross-site form sends the cookie but cannot set the header
+	if code := call(false); code != http.StatusUnauthorized {
+		t.Errorf("cookie without the header: got %d", code)
+	}
+
+	xhs.logic.keyMutex.Lock()
+	delete(xhs.logic.apiKeys, HashApiKey("team"))
+	xhs.logic.keyMutex.Unlock()
+	if code := call(true); code != http.StatusUnauthorized {
+		t.Errorf("session of a deleted key: got %d", code)
+	}
+}
+
+func TestAdminUI(t *testing.T) {
+	xhs := newAdminTestServer()
+	cases := map[string]int{
+		ADMIN_UI_PATH:              http.StatusOK,
+		ADMIN_UI_PATH + "app.js":   http.StatusOK,
+		ADMIN_UI_PATH + "app.css":  http.StatusOK,
+		ADMIN_UI_PATH + "other.js": http.StatusNotFound,
+	}
+	for path, want := range cases {
+		req, _ := http.NewRequest("GET", path, nil)
+		rec := httptest.NewRecorder()
+		xhs.adminUI(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: got %d, want %d", path, rec.Code, want)
+		}
+		if want == http.StatusOK && rec.Header().Get("Content-Security-Policy") != ADMIN_UI_CSP {
+			t.Errorf("%s: no csp", path)
+		}
+	}
+}
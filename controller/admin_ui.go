@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ADMIN_UI_PATH     = "/admin/"
+	ADMIN_LOGIN_PATH  = "/admin/login"
+	ADMIN_LOGOUT_PATH = "/admin/logout"
+
+	// the ui loads nothing but its own files, images of the contents aside
+	ADMIN_UI_CSP = "default-src 'self'; img-src * data:; frame-ancestors 'none'"
+)
+
+// adminUIRoutes are open to every caller, the ui asks for a login itself.
+var adminUIRoutes = map[string]bool{
+	ADMIN_UI_PATH:     true,
+	ADMIN_LOGIN_PATH:  true,
+	ADMIN_LOGOUT_PATH: true,
+}
+
+type adminAsset struct {
+	contentType string
+	body        string
+}
+
+// adminAssets are the files of the admin ui by their path, built in so the binary serves it offline.
+var adminAssets = map[string]*adminAsset{
+	ADMIN_UI_PATH:             {"text/html; charset=utf-8", ADMIN_INDEX_HTML},
+	ADMIN_UI_PATH + "app.css": {"text/css; charset=utf-8", ADMIN_APP_CSS},
+	ADMIN_UI_PATH + "app.js":  {"application/javascript; charset=utf-8", ADMIN_APP_JS},
+}
+
+// adminUI serves the files of the admin ui, the data comes from the /domain routes.
+func (xhs *XHttpServer) adminUI(rsp http.ResponseWriter, req *http.Request) {
+	asset := adminAssets[req.URL.Path]
+	if asset == nil {
+		http.NotFound(rsp, req)
+		return
+	}
+	rsp.Header().Set("Content-Type", asset.contentType)
+	rsp.Header().Set("Content-Security-Policy", ADMIN_UI_CSP)
+	rsp.Header().Set("X-Frame-Options", "DENY")
+	rsp.Header().Set("X-Content-Type-Options", "nosniff")
+	rsp.Header().Set("Cache-Control", "no-cache")
+	rsp.Write([]byte(asset.body))
+}
+
+// adminLogin trades an api key for a session cookie, the ui never keeps the key.
+func (xhs *XHttpServer) adminLogin(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type AdminLoginReq struct {
+		Key string `json:"key"`
+	}
+	var info AdminLoginReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.Key == "" {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or key is empty: %v", err)
+		return response, nil
+	}
+
+	keyHash := HashApiKey(info.Key)
+	key := xhs.logic.apiKeyByHash(keyHash)
+	if key == nil {
+		response.Code = RES_ERR
+		response.Msg = ErrApiKeyInvalid.Error()
+		return response, nil
+	}
+	token, expires, err := xhs.logic.sessions.Create(keyHash)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("create session failed: %v", err)
+		return response, nil
+	}
+	tenantID, _ := keyTenant(key, false)
+	// for the audit log, authorize saw no key
+	req.Header.Set(TENANT_HEADER, strconv.FormatInt(tenantID, 10))
+	req.Header.Set(API_KEY_ID_HEADER, strconv.FormatInt(key.ID, 10))
+	http.SetCookie(rsp, &http.Cookie{
+		Name:     ADMIN_SESSION_COOKIE,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil || strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https"),
+	})
+	response.Data = map[string]interface{}{
+		"id":       key.ID,
+		"name":     key.Name,
+		"tenantID": key.TenantID,
+		"expires":  expires.Unix(),
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) adminLogout(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	cookie, err := req.Cookie(ADMIN_SESSION_COOKIE)
+	if err != nil {
+		return response, nil
+	}
+	if key := xhs.logic.apiKeyByHash(xhs.logic.sessions.KeyHash(cookie.Value)); key != nil {
+		tenantID, _ := keyTenant(key, false)
+		req.Header.Set(TENANT_HEADER, strconv.FormatInt(tenantID, 10))
+		req.Header.Set(API_KEY_ID_HEADER, strconv.FormatInt(key.ID, 10))
+	}
+	xhs.logic.sessions.Delete(cookie.Value)
+	http.SetCookie(rsp, &http.Cookie{
+		Name:     ADMIN_SESSION_COOKIE,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	return response, nil
+}
@@ -0,0 +1,379 @@
+package controller
+
+// The admin ui is a page of plain javascript, it needs nothing but the controller.
+
+const ADMIN_INDEX_HTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>x-real-control</title>
+<link rel="stylesheet" href="/admin/app.css">
+</head>
+<body>
+<header>
+  <span class="brand">x-real-control</span>
+  <nav>
+    <a href="#/groups">Groups</a>
+    <a href="#/contents">Contents</a>
+    <a href="#/audit">Audit log</a>
+  </nav>
+  <span id="who"></span>
+  <button id="logout" class="hidden">Logout</button>
+</header>
+<div id="flash" class="hidden"></div>
+<main id="view"></main>
+<script src="/admin/app.js"></script>
+</body>
+</html>
+`
+
+const ADMIN_APP_CSS = `* { box-sizing: border-box; }
+body { margin: 0; font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; background: #f5f6f8; }
+header { display: flex; align-items: center; gap: 16px; padding: 8px 16px; background: #263238; color: #fff; }
+header a { color: #cfd8dc; text-decoration: none; margin-right: 12px; }
+header a:hover { color: #fff; }
+header #who { margin-left: auto; color: #b0bec5; }
+.brand { font-weight: bold; }
+main { padding: 16px; }
+h2 { margin: 0 0 12px; font-size: 18px; }
+table { border-collapse: collapse; width: 100%; background: #fff; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #e0e0e0; text-align: left; vertical-align: top; }
+th { background: #eceff1; font-weight: 600; }
+tr.dragging { opacity: .4; }
+tr.drop { border-top: 2px solid #1e88e5; }
+td.handle { cursor: move; color: #90a4ae; width: 24px; }
+button { padding: 4px 10px; border: 1px solid #b0bec5; border-radius: 3px; background: #fff; cursor: pointer; }
+button.primary { background: #1e88e5; border-color: #1e88e5; color: #fff; }
+input, textarea { padding: 4px 6px; border: 1px solid #b0bec5; border-radius: 3px; font: inherit; }
+textarea { width: 100%; min-height: 160px; font-family: monospace; }
+.badge { display: inline-block; padding: 1px 8px; border-radius: 10px; font-size: 12px; color: #fff; }
+.ok { background: #43a047; }
+.down { background: #e53935; }
+.off { background: #9e9e9e; }
+.hidden { display: none; }
+.bar { display: flex; gap: 8px; align-items: center; margin-bottom: 12px; }
+.login { max-width: 360px; margin: 80px auto; padding: 24px; background: #fff; border-radius: 4px; }
+.login input { width: 100%; margin: 8px 0 12px; }
+.editor { display: grid; grid-template-columns: 1fr 320px; gap: 16px; margin-top: 16px; }
+.card { background: #fff; border: 1px solid #e0e0e0; border-radius: 4px; padding: 8px; }
+.card img { max-width: 100%; display: block; margin-bottom: 6px; }
+.muted { color: #78909c; }
+pre { margin: 0; white-space: pre-wrap; word-break: break-all; font-size: 12px; }
+#flash { padding: 8px 16px; background: #ffebee; color: #b71c1c; }
+`
+
+const ADMIN_APP_JS = `(function () {
+"use strict";
+
+var STATUS = ["ok", "down", "off"];
+var view = document.getElementById("view");
+var flash = document.getElementById("flash");
+
+function el(tag, attrs, children) {
+  var e = document.createElement(tag);
+  attrs = attrs || {};
+  Object.keys(attrs).forEach(function (k) {
+    if (k === "text") { e.textContent = attrs[k]; }
+    else if (k.indexOf("on") === 0) { e.addEventListener(k.slice(2), attrs[k]); }
+    else { e.setAttribute(k, attrs[k]); }
+  });
+  (children || []).forEach(function (c) {
+    e.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+  });
+  return e;
+}
+
+function show(nodes) {
+  view.textContent = "";
+  nodes.forEach(function (n) { view.appendChild(n); });
+}
+
+function fail(msg) {
+  flash.textContent = msg;
+  flash.classList.remove("hidden");
+}
+
+// call posts to a route of the controller, the session header lets the cookie through
+function call(path, body) {
+  flash.classList.add("hidden");
+  return fetch(path, {
+    method: "POST",
+    credentials: "same-origin",
+    headers: {"Content-Type": "application/json", "X-Xrc-Session": "1"},
+    body: JSON.stringify(body || {})
+  }).then(function (rsp) {
+    if (rsp.status === 401) {
+      login();
+      throw new Error("login required");
+    }
+    if (!rsp.ok) {
+      return rsp.text().then(function (t) { throw new Error(t || rsp.statusText); });
+    }
+    return rsp.json();
+  }).then(function (res) {
+    if (res.code !== 0) { throw new Error(res.msg); }
+    return res.data;
+  }).catch(function (err) {
+    if (err.message !== "login required") { fail(err.message); }
+    throw err;
+  });
+}
+
+function badge(status) {
+  var name = STATUS[status] || String(status);
+  return el("span", {"class": "badge " + name, text: name});
+}
+
+function time(unix) {
+  return unix ? new Date(unix * 1000).toLocaleString() : "";
+}
+
+function login() {
+  document.getElementById("logout").classList.add("hidden");
+  document.getElementById("who").textContent = "";
+  var key = el("input", {type: "password", placeholder: "api key", autocomplete: "off"});
+  var form = el("form", {"class": "login", onsubmit: function (ev) {
+    ev.preventDefault();
+    call("/admin/login", {key: key.value}).then(function (who) {
+      sessionStorage.setItem("who", who.name);
+      route();
+    });
+  }}, [el("h2", {text: "Login"}), el("div", {"class": "muted", text: "Log in with an api key of the controller."}),
+    key, el("button", {"class": "primary", type: "submit", text: "Login"})]);
+  show([form]);
+  key.focus();
+}
+
+function groups() {
+  Promise.all([call("/domain/get_domain_groups"), call("/domain/get_show_topology")]).then(function (r) {
+    var health = {};
+    ((r[1] && r[1].groups) || []).forEach(function (g) { health[g.id] = g; });
+    var rows = (r[0] || []).map(function (g) {
+      var h = health[g.id] || {};
+      return el("tr", {}, [
+        el("td", {text: String(g.id)}),
+        el("td", {}, [el("a", {href: "#/group/" + g.id, text: g.name})]),
+        el("td", {text: g.type === 0 ? "show" : "jump"}),
+        el("td", {}, [badge(g.status)]),
+        el("td", {}, [el("span", {"class": "badge " + (h.healthy ? "ok" : "down"), text: h.healthy ? "healthy" : "unhealthy"})]),
+        el("td", {text: (h.okDomains || 0) + " / " + (h.domains || 0)})
+      ]);
+    });
+    show([el("h2", {text: "Domain groups"}), el("table", {}, [
+      el("tr", {}, ["id", "name", "type", "status", "health", "ok domains"].map(function (t) { return el("th", {text: t}); }))
+    ].concat(rows))]);
+  });
+}
+
+function group(id) {
+  call("/domain/get_domain_list", {groupID: id}).then(function (list) {
+    var rows = (list.domainList || []).map(function (d) {
+      var off = d.status === 2;
+      return el("tr", {}, [
+        el("td", {text: String(d.id)}),
+        el("td", {text: d.domain}),
+        el("td", {}, [badge(d.status)]),
+        el("td", {text: time(d.certExpiresAt)}),
+        el("td", {}, [el("button", {text: off ? "Turn on" : "Turn off", onclick: function () {
+          call("/domain/off_domain", {id: d.id, status: off ? 0 : 2}).then(function () { group(id); });
+        }})])
+      ]);
+    });
+    show([el("h2", {text: "Domains of group " + id}), el("table", {}, [
+      el("tr", {}, ["id", "domain", "status", "cert expires", ""].map(function (t) { return el("th", {text: t}); }))
+    ].concat(rows))]);
+  });
+}
+
+function contents() {
+  call("/domain/get_content_group").then(function (list) {
+    var rows = (list || []).map(function (g) {
+      return el("tr", {}, [
+        el("td", {text: String(g.id)}),
+        el("td", {}, [el("a", {href: "#/content/" + g.id, text: g.name})]),
+        el("td", {text: g.jsonUrl}),
+        el("td", {}, [el("a", {href: "#/history/" + g.id, text: "publish history"})])
+      ]);
+    });
+    show([el("h2", {text: "Content groups"}), el("table", {}, [
+      el("tr", {}, ["id", "name", "json url", ""].map(function (t) { return el("th", {text: t}); }))
+    ].concat(rows))]);
+  });
+}
+
+function video(c) {
+  try { return JSON.parse(c.value) || {}; } catch (e) { return {}; }
+}
+
+function preview(v) {
+  var card = el("div", {"class": "card"});
+  if (v.imageUrl) { card.appendChild(el("img", {src: v.imageUrl, alt: ""})); }
+  card.appendChild(el("strong", {text: v.title || "(no title)"}));
+  card.appendChild(el("div", {"class": "muted", text: v.content || ""}));
+  card.appendChild(el("div", {"class": "muted", text: v.videoSrc || ""}));
+  return card;
+}
+
+// content lists the contents of a group, rows are dragged to reorder them
+function content(id) {
+  call("/domain/get_content_list", {groupID: id}).then(function (list) {
+    var items = list.contentList || [];
+    var dragged = null;
+    var table = el("table");
+    var text = el("textarea", {spellcheck: "false"});
+    var card = el("div");
+    var editing = null;
+
+    function edit(c) {
+      editing = c;
+      text.value = JSON.stringify(c ? video(c) : {title: "", content: "", videoSrc: "", imageUrl: "", titleImg: "", type: 0}, null, 2);
+      render();
+    }
+    function render() {
+      card.textContent = "";
+      try { card.appendChild(preview(JSON.parse(text.value))); }
+      catch (e) { card.appendChild(el("div", {"class": "muted", text: "not json: " + e.message})); }
+    }
+    text.addEventListener("input", render);
+
+    function save() {
+      var v;
+      try { v = JSON.parse(text.value); } catch (e) { fail("not json: " + e.message); return; }
+      var p = editing ? call("/domain/update_video_content", {id: editing.id, video: v}) :
+        call("/domain/add_video_content", {groupID: id, video: v});
+      p.then(function () { content(id); });
+    }
+    function reorder() {
+      call("/domain/reorder_content", {groupID: id, contentIDs: items.map(function (c) { return c.id; })});
+    }
+
+    table.appendChild(el("tr", {}, ["", "id", "title", "enabled", "pinned", ""].map(function (t) { return el("th", {text: t}); })));
+    items.forEach(function (c) {
+      var enabled = el("input", {type: "checkbox"});
+      var pinned = el("input", {type: "checkbox"});
+      enabled.checked = c.enabled;
+      pinned.checked = c.pinned;
+      function setting() {
+        call("/domain/setting_content", {id: c.id, enabled: enabled.checked, pinned: pinned.checked});
+      }
+      enabled.addEventListener("change", setting);
+      pinned.addEventListener("change", setting);
+      var row = el("tr", {draggable: "true"}, [
+        el("td", {"class": "handle", text: "::"}),
+        el("td", {text: String(c.id)}),
+        el("td", {text: video(c).title || ""}),
+        el("td", {}, [enabled]),
+        el("td", {}, [pinned]),
+        el("td", {}, [el("button", {text: "Edit", onclick: function () { edit(c); }})])
+      ]);
+      row.addEventListener("dragstart", function (ev) {
+        dragged = c;
+        row.classList.add("dragging");
+        ev.dataTransfer.setData("text/plain", String(c.id));
+      });
+      row.addEventListener("dragend", function () { row.classList.remove("dragging"); });
+      row.addEventListener("dragover", function (ev) { ev.preventDefault(); row.classList.add("drop"); });
+      row.addEventListener("dragleave", function () { row.classList.remove("drop"); });
+      row.addEventListener("drop", function (ev) {
+        ev.preventDefault();
+        row.classList.remove("drop");
+        if (!dragged || dragged === c) { return; }
+        items.splice(items.indexOf(dragged), 1);
+        items.splice(items.indexOf(c), 0, dragged);
+        table.insertBefore(table.querySelector("tr.dragging"), row);
+        reorder();
+      });
+      table.appendChild(row);
+    });
+
+    show([
+      el("h2", {text: "Contents of group " + id}),
+      el("div", {"class": "bar"}, [
+        el("button", {text: "New content", onclick: function () { edit(null); }}),
+        el("button", {"class": "primary", text: "Publish", onclick: function () {
+          call("/domain/publish_content", {groupID: id}).then(function () { location.hash = "#/history/" + id; });
+        }}),
+        el("a", {href: "#/history/" + id, text: "publish history"})
+      ]),
+      table,
+      el("div", {"class": "editor"}, [
+        el("div", {}, [text, el("div", {"class": "bar"}, [el("button", {"class": "primary", text: "Save", onclick: save})])]),
+        card
+      ])
+    ]);
+    edit(items.length ? items[0] : null);
+  });
+}
+
+function history(id) {
+  call("/domain/get_publish_history", {groupID: id}).then(function (list) {
+    var rows = (list || []).map(function (p) {
+      return el("tr", {}, [
+        el("td", {text: p.time}),
+        el("td", {}, [el("span", {"class": "badge " + (p.success ? "ok" : "down"), text: p.success ? "published" : "failed"})]),
+        el("td", {text: p.jsonUrl}),
+        el("td", {text: p.error})
+      ]);
+    });
+    show([el("h2", {text: "Publish history of group " + id}),
+      el("div", {"class": "bar"}, [el("a", {href: "#/content/" + id, text: "contents"})]),
+      el("table", {}, [
+        el("tr", {}, ["time", "result", "json url", "error"].map(function (t) { return el("th", {text: t}); }))
+      ].concat(rows))]);
+  });
+}
+
+function audit(beforeID) {
+  call("/domain/get_audit_log", {beforeID: beforeID || 0}).then(function (list) {
+    list = list || [];
+    var rows = list.map(function (a) {
+      return el("tr", {}, [
+        el("td", {text: a.time}),
+        el("td", {text: a.actor || (a.apiKeyID ? "key " + a.apiKeyID : "-")}),
+        el("td", {text: a.action}),
+        el("td", {}, [a.code === 0 ? badge(0) : el("span", {"class": "badge down", text: "error"})]),
+        el("td", {text: a.message}),
+        el("td", {}, [el("pre", {text: a.body})]),
+        el("td", {"class": "muted", text: a.ip})
+      ]);
+    });
+    var more = [];
+    if (list.length) {
+      more.push(el("button", {text: "Older", onclick: function () { location.hash = "#/audit/" + list[list.length - 1].id; }}));
+    }
+    if (beforeID) { more.push(el("a", {href: "#/audit", text: "latest"})); }
+    show([el("h2", {text: "Audit log"}), el("table", {}, [
+      el("tr", {}, ["time", "actor", "action", "result", "message", "body", "ip"].map(function (t) { return el("th", {text: t}); }))
+    ].concat(rows)), el("div", {"class": "bar"}, more)]);
+  });
+}
+
+var routes = {
+  groups: groups,
+  group: group,
+  contents: contents,
+  content: content,
+  history: history,
+  audit: audit
+};
+
+function route() {
+  var who = sessionStorage.getItem("who");
+  document.getElementById("who").textContent = who || "";
+  document.getElementById("logout").classList.toggle("hidden", !who);
+  var parts = location.hash.replace(/^#\/?/, "").split("/");
+  var f = routes[parts[0]] || groups;
+  f(parts[1] ? parseInt(parts[1], 10) : 0);
+}
+
+document.getElementById("logout").addEventListener("click", function () {
+  call("/admin/logout").then(function () {
+    sessionStorage.removeItem("who");
+    login();
+  });
+});
+window.addEventListener("hashchange", route);
+route();
+})();
+`
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	AUDIT_BODY_MAX     = 4096
+	AUDIT_MESSAGE_MAX  = 255
+	AUDIT_RESPONSE_MAX = 4096
+	AUDIT_MASK         = "***"
+
+	AUDIT_LOG_DEFAULT_LIMIT = 50
+	AUDIT_LOG_MAX_LIMIT     = 500
+)
+
+// auditSecretFields are masked in the bodies kept by the audit log.
+var auditSecretFields = map[string]bool{
+	"key":      true,
+	"secret":   true,
+	"pass":     true,
+	"password": true,
+}
+
+// auditedRoute tells whether calls of path change something, reads are not audited.
+func auditedRoute(path string) bool {
+	if path == ADMIN_LOGIN_PATH || path == ADMIN_LOGOUT_PATH {
+		return true
+	}
+	if !strings.HasPrefix(path, "/domain/") || publicRoutes[path] {
+		return false
+	}
+	name := strings.TrimPrefix(path, "/domain/")
+	return !strings.HasPrefix(name, "get_") && !strings.HasPrefix(name, "export_")
+}
+
+// auditBody returns the body kept in the audit log, with the values of secret fields masked.
+// A body too long or not a json object is not kept, it could hold a secret.
+func auditBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > AUDIT_BODY_MAX {
+		return fmt.Sprintf("(%d+ bytes not kept)", AUDIT_BODY_MAX)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return "(not a json object)"
+	}
+	for k := range m {
+		if auditSecretFields[strings.ToLower(k)] {
+			m[k] = AUDIT_MASK
+		}
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// auditRecorder keeps the start of an answer, for the code and msg of its Response.
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (ar *auditRecorder) WriteHeader(status int) {
+	ar.status = status
+	ar.ResponseWriter.WriteHeader(status)
+}
+
+func (ar *auditRecorder) Write(b []byte) (int, error) {
+	if n := AUDIT_RESPONSE_MAX - ar.buf.Len(); n > 0 {
+		if n > len(b) {
+			n = len(b)
+		}
+		ar.buf.Write(b[:n])
+	}
+	return ar.ResponseWriter.Write(b)
+}
+
+// result reads the code and msg of a Response, they come before its data, which may be cut.
+func (ar *auditRecorder) result() (int64, string) {
+	code, msg := int64(RES_OK), ""
+	if ar.status >= http.StatusBadRequest {
+		code, msg = RES_ERR, http.StatusText(ar.status)
+	}
+	dec := json.NewDecoder(&ar.buf)
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return code, msg
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var v interface{}
+		switch t {
+		case "code":
+			if err := dec.Decode(&v); err == nil {
+				if n, ok := v.(json.Number); ok {
+					code, _ = n.Int64()
+				}
+			}
+		case "msg":
+			if err := dec.Decode(&v); err == nil {
+				msg, _ = v.(string)
+			}
+		default:
+			return code, msg
+		}
+	}
+	return code, msg
+}
+
+// audit records the calls of a route in the audit log. It runs inside authorize, which sets the caller.
+func (xhs *XHttpServer) audit(path string, f http.HandlerFunc) http.HandlerFunc {
+	return func(rsp http.ResponseWriter, req *http.Request) {
+		var body []byte
+		if req.Body != nil {
+			body, _ = ioutil.ReadAll(io.LimitReader(req.Body, AUDIT_BODY_MAX+1))
+			req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+		}
+		rec := &auditRecorder{ResponseWriter: rsp, status: http.StatusOK}
+		f(rec, req)
+
+		code, msg := rec.result()
+		if len(msg) > AUDIT_MESSAGE_MAX {
+			msg = msg[:AUDIT_MESSAGE_MAX]
+		}
+		entry := &AuditLogInfo{
+			Action:    path,
+			RequestID: req.Header.Get(REQUEST_ID_HEADER),
+			IP:        xhs.logic.TrustedProxies().ClientIP(req),
+			Code:      code,
+			Message:   msg,
+			Body:      auditBody(body),
+		}
+		if tenantID := callerTenant(req); tenantID != TENANT_ALL {
+			entry.TenantID = tenantID
+		}
+		entry.ApiKeyID, _ = strconv.ParseInt(req.Header.Get(API_KEY_ID_HEADER), 10, 64)
+		if info := xhs.logic.apiKeyByID(entry.ApiKeyID); entry.ApiKeyID != 0 && info != nil {
+			entry.Actor = info.Name
+		}
+		if err := xhs.logic.cdb.InsertAuditLog(entry); err != nil {
+			requestLogger(req).Errorf("record audit log of[%s] error: %v\n", path, err)
+		}
+	}
+}
+
+// auditRoutes records the calls of every route changing something.
+func (xhs *XHttpServer) auditRoutes() {
+	for p, f := range xhs.hs.Routers {
+		if auditedRoute(p) {
+			xhs.hs.Routers[p] = xhs.audit(p, f)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditedRoute(t *testing.T) {
+	cases := map[string]bool{
+		"/domain/add_domain":        true,
+		"/domain/add_api_key":       true,
+		"/domain/get_domain_groups": false,
+		"/domain/export_domains":    false,
+		"/domain/get_url":           false,
+		ADMIN_LOGIN_PATH:            true,
+		ADMIN_UI_PATH:               false,
+		"/api/v2/stats":             false,
+	}
+	for path, want := range cases {
+		if got := auditedRoute(path); got != want {
+			t.Errorf("%s: got %v", path, got)
+		}
+	}
+}
+
+func TestAuditBody(t *testing.T) {
+	got := auditBody([]byte(`{"name":"team","Key":"k3y","secret":"s3cret"}`))
+	if strings.Contains(got, "k3y") || strings.Contains(got, "s3cret") || !strings.Contains(got, `"name":"team"`) {
+		t.Errorf("got %s", got)
+	}
+	if got := auditBody([]byte(`["k3y"]`)); strings.Contains(got, "k3y") {
+		t.Errorf("not an object: got %s", got)
+	}
+	if got := auditBody([]byte(`{"name":"` + strings.Repeat("a", AUDIT_BODY_MAX) + `"}`)); strings.Contains(got, "aaa") {
+		t.Errorf("too long: got %d bytes", len(got))
+	}
+}
+
+func TestAuditResult(t *testing.T) {
+	rec := &auditRecorder{ResponseWriter: httptest.NewRecorder(), status: 200}
+	// the data is cut, code and msg come first
+	rec.Write([]byte(`{"code":1,"msg":"add domain failed","data":[` + strings.Repeat(`"x",`, AUDIT_RESPONSE_MAX)))
+	if code, msg := rec.result(); code != RES_ERR || msg != "add domain failed" {
+		t.Errorf("got %d %q", code, msg)
+	}
+
+	rec = &auditRecorder{ResponseWriter: httptest.NewRecorder(), status: 200}
+	rec.WriteHeader(500)
+	rec.Write([]byte("db is down"))
+	if code, msg := rec.result(); code != RES_ERR || msg != "Internal Server Error" {
+		t.Errorf("got %d %q", code, msg)
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the networks whose forwarding headers are believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies accepts CIDRs and single ips.
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy[%s] is not an ip or cidr", v)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			v = fmt.Sprintf("%s/%d", v, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy[%s] is not an ip or cidr", v)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func (tp TrustedProxies) Contains(ip net.IP) bool {
+	for _, n := range tp {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the ip of the client. Forwarded, X-Forwarded-For and X-Real-IP,
+// in this order, are only used when the peer is a trusted proxy; the chain is walked
+// from the nearest hop and the first untrusted address is the client.
+func (tp TrustedProxies) ClientIP(req *http.Request) string {
+	remote := parseHostIP(req.RemoteAddr)
+	if remote == nil {
+		return req.RemoteAddr
+	}
+	if !tp.Contains(remote) {
+		return remote.String()
+	}
+
+	var chain []string
+	if v := req.Header.Get("Forwarded"); v != "" {
+		chain = forwardedFor(v)
+	} else if v := req.Header.Get("X-Forwarded-For"); v != "" {
+		chain = strings.Split(v, ",")
+	} else if v := req.Header.Get("X-Real-IP"); v != "" {
+		chain = []string{v}
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHostIP(strings.TrimSpace(chain[i]))
+		if ip == nil {
+			// unknown or obfuscated hop, trust stops at the last proxy
+			break
+		}
+		client = ip
+		if !tp.Contains(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor returns the for= values of a RFC 7239 Forwarded header.
+func forwardedFor(header string) []string {
+	var list []string
+	for _, elem := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(elem, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+				list = append(list, strings.Trim(kv[1], `"`))
+			}
+		}
+	}
+	return list
+}
+
+// parseHostIP parses ip, ip:port, [ipv6] and [ipv6]:port.
+func parseHostIP(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
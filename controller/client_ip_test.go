@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tp, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("bad cidr accepted")
+	}
+
+	cases := []struct {
+		remote string
+		header map[string]string
+		want   string
+	}{
+		{"1.2.3.4:5678", nil, "1.2.3.4"},
+		{"[2001:db8::2]:443", nil, "2001:db8::2"},
+		// untrusted peers cannot spoof
+		{"1.2.3.4:5678", map[string]string{"X-Forwarded-For": "5.6.7.8"}, "1.2.3.4"},
+		{"10.1.1.1:80", map[string]string{"X-Forwarded-For": "5.6.7.8, 9.9.9.9, 10.2.2.2"}, "9.9.9.9"},
+		{"10.1.1.1:80", map[string]string{"X-Forwarded-For": "10.3.3.3, 10.2.2.2"}, "10.3.3.3"},
+		{"10.1.1.1:80", map[string]string{"X-Real-IP": "5.6.7.8"}, "5.6.7.8"},
+		{"[2001:db8::1]:80", map[string]string{"Forwarded": `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"10.1.1.1:80", map[string]string{"Forwarded": "for=unknown", "X-Forwarded-For": "5.6.7.8"}, "10.1.1.1"},
+	}
+	for _, c := range cases {
+		req := &http.Request{RemoteAddr: c.remote, Header: make(http.Header)}
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		if got := tp.ClientIP(req); got != c.want {
+			t.Errorf("remote %s header %v: got %s, want %s", c.remote, c.header, got, c.want)
+		}
+	}
+}
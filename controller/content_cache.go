@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CONTENT_PATH_PREFIX = "/content/"
+)
+
+type CachedContent struct {
+	Data        []byte
+	GzData      []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// ContentCache keeps the rendered output of every content group, so the controller
+// can serve it at /content/{groupID}{ext} without oss.
+type ContentCache struct {
+	sync.RWMutex
+
+	baseUrl string
+	items   map[string]*CachedContent
+}
+
+func NewContentCache(baseUrl string) *ContentCache {
+	if baseUrl == "" {
+		baseUrl = CONTENT_PATH_PREFIX
+	}
+	return &ContentCache{
+		baseUrl: baseUrl,
+		items:   make(map[string]*CachedContent),
+	}
+}
+
+func contentCacheKey(groupID int64, ext string) string {
+	return fmt.Sprintf("%d%s", groupID, ext)
+}
+
+func (cc *ContentCache) Url(groupID int64, ext string) string {
+	return cc.baseUrl + contentCacheKey(groupID, ext)
+}
+
+func (cc *ContentCache) BaseUrl() string {
+	return cc.baseUrl
+}
+
+// Set stores rendered content. The modify time only moves when the data changes.
+func (cc *ContentCache) Set(groupID int64, rc *RenderedContent, gzData []byte, now time.Time) {
+	sum := md5.Sum(rc.Data)
+	item := &CachedContent{
+		Data:        rc.Data,
+		GzData:      gzData,
+		ContentType: rc.ContentType,
+		ETag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		ModTime:     now,
+	}
+	key := contentCacheKey(groupID, rc.Ext)
+
+	cc.Lock()
+	defer cc.Unlock()
+	if old := cc.items[key]; old != nil && old.ETag == item.ETag {
+		item.ModTime = old.ModTime
+	}
+	cc.items[key] = item
+}
+
+func (cc *ContentCache) DeleteGroup(groupID int64) {
+	prefix := contentCacheKey(groupID, ".")
+	cc.Lock()
+	defer cc.Unlock()
+	for k := range cc.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(cc.items, k)
+		}
+	}
+}
+
+// RetainGroup drops the content of the group in formats no longer published, exts are the ones kept.
+func (cc *ContentCache) RetainGroup(groupID int64, exts []string) {
+	keep := make(map[string]bool)
+	for _, ext := range exts {
+		keep[contentCacheKey(groupID, ext)] = true
+	}
+	prefix := contentCacheKey(groupID, ".")
+	cc.Lock()
+	defer cc.Unlock()
+	for k := range cc.items {
+		if strings.HasPrefix(k, prefix) && !keep[k] {
+			delete(cc.items, k)
+		}
+	}
+}
+
+func (cc *ContentCache) Get(key string) *CachedContent {
+	cc.RLock()
+	defer cc.RUnlock()
+	return cc.items[key]
+}
+
+func (cc *ContentCache) ServeHTTP(rsp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		rsp.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.TrimPrefix(req.URL.Path, CONTENT_PATH_PREFIX)
+	item := cc.Get(key)
+	if item == nil {
+		rsp.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data := item.Data
+	etag := item.ETag
+	rsp.Header().Set("Vary", "Accept-Encoding")
+	if acceptGzip(req) {
+		data = item.GzData
+		etag = strings.TrimSuffix(item.ETag, `"`) + `-gzip"`
+		rsp.Header().Set("Content-Encoding", "gzip")
+	}
+	rsp.Header().Set("Access-Control-Allow-Origin", "*")
+	rsp.Header().Set("Content-Type", item.ContentType)
+	rsp.Header().Set("Cache-Control", "public, max-age=60")
+	rsp.Header().Set("ETag", etag)
+	// ServeContent answers If-None-Match and If-Modified-Since with 304
+	http.ServeContent(rsp, req, key, item.ModTime, bytes.NewReader(data))
+}
+
+func acceptGzip(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(strings.TrimSpace(v), ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		if len(parts) > 1 && strings.Replace(parts[1], " ", "", -1) == "q=0" {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContentCacheServe(t *testing.T) {
+	cc := NewContentCache("")
+	rc := &RenderedContent{Ext: ".json", ContentType: "application/json; charset=utf-8", Data: []byte(`[{"id":1}]`)}
+	gzData, err := GzipBytes(rc.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Unix(1500000000, 0)
+	cc.Set(5, rc, gzData, modTime)
+	// same data must keep etag and modify time
+	cc.Set(5, rc, gzData, modTime.Add(time.Hour))
+
+	req := httptest.NewRequest("GET", "/content/5.json", nil)
+	rsp := httptest.NewRecorder()
+	cc.ServeHTTP(rsp, req)
+	if rsp.Code != 200 || rsp.Body.String() != string(rc.Data) {
+		t.Fatalf("get content error: %d %s", rsp.Code, rsp.Body.String())
+	}
+	etag := rsp.Header().Get("ETag")
+	if etag == "" || rsp.Header().Get("Last-Modified") != modTime.UTC().Format(http.TimeFormat) {
+		t.Fatalf("cache headers error: %v", rsp.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/content/5.json", nil)
+	req.Header.Set("If-None-Match", etag)
+	rsp = httptest.NewRecorder()
+	cc.ServeHTTP(rsp, req)
+	if rsp.Code != 304 {
+		t.Fatalf("If-None-Match should get 304, got %d", rsp.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/content/5.json", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip")
+	rsp = httptest.NewRecorder()
+	cc.ServeHTTP(rsp, req)
+	if rsp.Header().Get("Content-Encoding") != "gzip" || rsp.Body.String() != string(gzData) || rsp.Header().Get("ETag") == etag {
+		t.Fatalf("gzip content error: %v", rsp.Header())
+	}
+
+	req = httptest.NewRequest("GET", "/content/6.json", nil)
+	rsp = httptest.NewRecorder()
+	cc.ServeHTTP(rsp, req)
+	if rsp.Code != 404 {
+		t.Fatalf("unknown group should get 404, got %d", rsp.Code)
+	}
+}
+
+func TestContentCacheRetainGroup(t *testing.T) {
+	cc := NewContentCache("")
+	now := time.Unix(1500000000, 0)
+	for _, ext := range []string{".json", ".rss", ".xml"} {
+		cc.Set(5, &RenderedContent{Ext: ext, Data: []byte("5")}, nil, now)
+		cc.Set(55, &RenderedContent{Ext: ext, Data: []byte("55")}, nil, now)
+	}
+	// rss is no longer a format of group 5
+	cc.RetainGroup(5, []string{".json", ".xml"})
+	for key, want := range map[string]bool{"5.json": true, "5.xml": true, "5.rss": false, "55.rss": true} {
+		if got := cc.Get(key) != nil; got != want {
+			t.Errorf("%s cached: got %v, want %v", key, got, want)
+		}
+	}
+}
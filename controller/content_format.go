@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	CONTENT_FORMAT_JSON  = "json"
+	CONTENT_FORMAT_JSONP = "jsonp"
+	CONTENT_FORMAT_RSS   = "rss"
+	CONTENT_FORMAT_ATOM  = "atom"
+)
+
+const (
+	DEFAULT_JSONP_CALLBACK = "callback"
+)
+
+var jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$.]*$`)
+
+type ContentFeedItem struct {
+	Video      Video
+	UpdateTime int64
+}
+
+// ContentFeed is what every output format of a content group is rendered from.
+type ContentFeed struct {
+	Group      *ContentGroupInfo
+	Link       string
+	UpdateTime int64
+	Items      []*ContentFeedItem
+}
+
+type RenderedContent struct {
+	Format      string
+	Ext         string
+	ContentType string
+	Data        []byte
+}
+
+// ContentFormats returns the configured formats of the group, json by default.
+func ContentFormats(group *ContentGroupInfo) []string {
+	if len(group.Formats) == 0 {
+		return []string{CONTENT_FORMAT_JSON}
+	}
+	return group.Formats
+}
+
+func CheckContentFormats(formats []string, jsonpCallback string) error {
+	for _, v := range formats {
+		switch v {
+		case CONTENT_FORMAT_JSON, CONTENT_FORMAT_RSS, CONTENT_FORMAT_ATOM:
+		case CONTENT_FORMAT_JSONP:
+			if jsonpCallback != "" && !jsonpCallbackRegexp.MatchString(jsonpCallback) {
+				return fmt.Errorf("invalid jsonp callback[%s].", jsonpCallback)
+			}
+		default:
+			return fmt.Errorf("unknown content format[%s].", v)
+		}
+	}
+	return nil
+}
+
+func RenderContent(format string, feed *ContentFeed) (*RenderedContent, error) {
+	switch format {
+	case CONTENT_FORMAT_JSON:
+		data, err := feed.marshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedContent{Format: format, Ext: ".json", ContentType: "application/json; charset=utf-8", Data: data}, nil
+	case CONTENT_FORMAT_JSONP:
+		data, err := feed.marshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		callback := feed.Group.JsonpCallback
+		if callback == "" {
+			callback = DEFAULT_JSONP_CALLBACK
+		}
+		if !jsonpCallbackRegexp.MatchString(callback) {
+			return nil, fmt.Errorf("invalid jsonp callback[%s].", callback)
+		}
+		data = []byte(callback + "(" + string(data) + ");")
+		return &RenderedContent{Format: format, Ext: ".js", ContentType: "application/javascript; charset=utf-8", Data: data}, nil
+	case CONTENT_FORMAT_RSS:
+		data, err := feed.marshalRSS()
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedContent{Format: format, Ext: ".rss", ContentType: "application/rss+xml; charset=utf-8", Data: data}, nil
+	case CONTENT_FORMAT_ATOM:
+		data, err := feed.marshalAtom()
+		if err != nil {
+			return nil, err
+		}
+		return &RenderedContent{Format: format, Ext: ".atom", ContentType: "application/atom+xml; charset=utf-8", Data: data}, nil
+	}
+	return nil, fmt.Errorf("unknown content format[%s].", format)
+}
+
+func (feed *ContentFeed) marshalJSON() ([]byte, error) {
+	list := make([]Video, 0, len(feed.Items))
+	for _, v := range feed.Items {
+		list = append(list, v.Video)
+	}
+	return json.Marshal(list)
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Guid        rssGuid `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name    `xml:"rss"`
+	Version string      `xml:"version,attr"`
+	Channel *rssChannel `xml:"channel"`
+}
+
+// marshalRSS uses the content update times only, so the same content always renders the same bytes.
+func (feed *ContentFeed) marshalRSS() ([]byte, error) {
+	channel := &rssChannel{
+		Title:       feed.Group.Name,
+		Link:        feed.Link,
+		Description: feed.Group.Name,
+	}
+	if feed.UpdateTime != 0 {
+		channel.LastBuildDate = time.Unix(feed.UpdateTime, 0).UTC().Format(time.RFC1123Z)
+	}
+	for _, v := range feed.Items {
+		item := &rssItem{
+			Title:       v.Video.Title,
+			Link:        v.Video.VideoSrc,
+			Description: v.Video.Content,
+			Guid:        rssGuid{Value: strconv.FormatInt(v.Video.ID, 10)},
+		}
+		if v.UpdateTime != 0 {
+			item.PubDate = time.Unix(v.UpdateTime, 0).UTC().Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return marshalXML(&rssFeed{Version: "2.0", Channel: channel})
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated string    `xml:"updated"`
+	Link    *atomLink `xml:"link"`
+	Summary string    `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Link    *atomLink    `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+func (feed *ContentFeed) marshalAtom() ([]byte, error) {
+	af := &atomFeed{
+		ID:      fmt.Sprintf("urn:x-real-control:content-group:%d", feed.Group.ID),
+		Title:   feed.Group.Name,
+		Updated: time.Unix(feed.UpdateTime, 0).UTC().Format(time.RFC3339),
+		Link:    &atomLink{Href: feed.Link, Rel: "self"},
+	}
+	for _, v := range feed.Items {
+		af.Entries = append(af.Entries, &atomEntry{
+			ID:      fmt.Sprintf("urn:x-real-control:content:%d", v.Video.ID),
+			Title:   v.Video.Title,
+			Updated: time.Unix(v.UpdateTime, 0).UTC().Format(time.RFC3339),
+			Link:    &atomLink{Href: v.Video.VideoSrc},
+			Summary: v.Video.Content,
+		})
+	}
+	return marshalXML(af)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// GzipBytes compresses data without a timestamp, so equal input gives equal output.
+func GzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
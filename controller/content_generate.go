@@ -1,37 +1,59 @@
 package controller
 
 import (
-	"bytes"
 	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
-	"github.com/aliyun/aliyun-oss-go-sdk/oss"
-	"github.com/reechou/x-real-control/config"
 	"github.com/reechou/x-real-control/utils"
 )
 
+const (
+	PUBLISH_BACKOFF_BASE = time.Minute
+	PUBLISH_BACKOFF_MAX  = 30 * time.Minute
+
+	PUBLISH_LOG_ERROR_MAX     = 1024
+	PUBLISH_LOG_DEFAULT_LIMIT = 50
+	PUBLISH_LOG_MAX_LIMIT     = 500
+)
+
 type ContentGenerate struct {
 	groupInfo *ContentGroupInfo
-	w         *utils.TimingWheel
+	task      *utils.Task
+	clock     utils.Clock
 	logic     *ControllerLogic
 	cdb       *ControllerDB
 
 	groupUpdateTime int64
 	updateTime      int64
-	aliyunInfo      *config.AliyunOss
+	checkTime       int64
+	publisher       Publisher
+	cache           *ContentCache
+	log             *utils.Logger
+
+	stateMutex sync.Mutex
+	state      PublishState
 
-	stop chan struct{}
-	done chan struct{}
+	publishC chan chan error
+	stop     chan struct{}
+	done     chan struct{}
 }
 
-func NewContentGenerate(groupInfo *ContentGroupInfo, cdb *ControllerDB, w *utils.TimingWheel, logic *ControllerLogic, aliyunInfo *config.AliyunOss) *ContentGenerate {
+func NewContentGenerate(groupInfo *ContentGroupInfo, cdb *ControllerDB, task *utils.Task, logic *ControllerLogic, publisher Publisher, cache *ContentCache) *ContentGenerate {
 	cg := &ContentGenerate{
-		groupInfo:  groupInfo,
-		cdb:        cdb,
-		w:          w,
-		logic:      logic,
-		aliyunInfo: aliyunInfo,
-		stop:       make(chan struct{}),
-		done:       make(chan struct{}),
+		groupInfo: groupInfo,
+		cdb:       cdb,
+		task:      task,
+		clock:     logic.clock,
+		logic:     logic,
+		publisher: publisher,
+		cache:     cache,
+		log:       logger.With(utils.LOG_GROUP_ID, groupInfo.ID),
+		state:     PublishState{GroupID: groupInfo.ID},
+		publishC:  make(chan chan error),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
 	}
 	cg.init()
 	go cg.run()
@@ -40,34 +62,41 @@ func NewContentGenerate(groupInfo *ContentGroupInfo, cdb *ControllerDB, w *utils
 }
 
 func (cg *ContentGenerate) init() {
-	rule1 := oss.CORSRule{
-		AllowedOrigin: []string{"*"},
-		AllowedMethod: []string{"PUT", "GET"},
-		AllowedHeader: []string{},
-		ExposeHeader:  []string{},
-		MaxAgeSeconds: 200,
-	}
-
-	err := cg.aliyunInfo.AliyunClient.SetBucketCORS(cg.aliyunInfo.Bucket, []oss.CORSRule{rule1})
-	if err != nil {
-		plog.Panic("aliyun set oss cors rule error.", err)
-	}
-
 	// first init json url file
 	cg.onCheck()
 }
 
 func (cg *ContentGenerate) Stop() {
+	cg.task.Cancel()
 	close(cg.stop)
 	<-cg.done
 }
 
+// PublishNow publishes the group immediately, bypassing change detection and backoff.
+func (cg *ContentGenerate) PublishNow() error {
+	result := make(chan error, 1)
+	select {
+	case cg.publishC <- result:
+	case <-cg.done:
+		return fmt.Errorf("content group[%d] is stopped.", cg.groupInfo.ID)
+	}
+	return <-result
+}
+
+func (cg *ContentGenerate) PublishState() PublishState {
+	cg.stateMutex.Lock()
+	defer cg.stateMutex.Unlock()
+	return cg.state
+}
+
 func (cg *ContentGenerate) run() {
-	plog.Infof("content group[%s][%d] start run.\n", cg.groupInfo.Name, cg.groupInfo.ID)
+	cg.log.Infof("content group[%s] start run.\n", cg.groupInfo.Name)
 	for {
 		select {
-		case <-cg.w.Check(cg.groupInfo.ID):
+		case <-cg.task.C():
 			cg.onCheck()
+		case result := <-cg.publishC:
+			result <- cg.publish(true)
 		case <-cg.stop:
 			close(cg.done)
 			return
@@ -76,47 +105,108 @@ func (cg *ContentGenerate) run() {
 }
 
 func (cg *ContentGenerate) onCheck() {
+	cg.publish(false)
+}
+
+func (cg *ContentGenerate) publish(force bool) error {
+	now := cg.clock.Now()
+	if !force && now.Unix() < cg.PublishState().NextRetry {
+		return nil
+	}
+
 	list := &ContentList{
 		GroupID: cg.groupInfo.ID,
 	}
 	err := cg.cdb.GetContentGroupFromID(cg.groupInfo)
 	if err != nil {
-		plog.Errorf("get content group error: %v\n", err)
+		cg.log.Errorf("get content group error: %v\n", err)
+	} else {
+		cg.task.SetInterval(cg.logic.checkInterval(cg.groupInfo.CheckInterval))
 	}
 	err = cg.cdb.GetContentList(list)
 	if err != nil {
-		plog.Errorf("get content list error: %v\n", err)
-		return
+		cg.log.Errorf("get content list error: %v\n", err)
+		// nothing was published, the failure shows in the publish status and history all the same
+		cg.recordPublish(now, nil, fmt.Errorf("get content list error: %v", err))
+		return err
 	}
-	if list.UpdateTime > cg.updateTime || cg.groupInfo.UpdateTime > cg.groupUpdateTime {
-		err = cg.saveAndPublish(list)
+	if force || list.UpdateTime > cg.updateTime || cg.groupInfo.UpdateTime > cg.groupUpdateTime || list.CrossedBoundary(cg.checkTime, now.Unix()) {
+		urls, err := cg.saveAndPublish(list, now.Unix())
+		cg.recordPublish(now, urls, err)
 		if err != nil {
-			plog.Errorf("save and publish error: %v\n", err)
-			return
+			cg.log.Errorf("save and publish error: %v\n", err)
+			return err
 		}
 		cg.updateTime = list.UpdateTime
 		cg.groupUpdateTime = cg.groupInfo.UpdateTime
 	}
+	cg.checkTime = now.Unix()
+
+	return nil
 }
 
-func (cg *ContentGenerate) saveAndPublish(list *ContentList) error {
-	var dataList []interface{}
-	var dataListMain []interface{}
-	for _, v := range cg.groupInfo.MainContent {
-		for _, cv := range list.ContentList {
-			if cv.ID == v {
-				var info Video
-				err := json.Unmarshal([]byte(cv.Value), &info)
-				if err != nil {
-					continue
-				}
-				info.ID = cv.ID
-				dataListMain = append(dataListMain, info)
-				break
-			}
+func (cg *ContentGenerate) recordPublish(now time.Time, urls map[string]string, err error) {
+	entry := &PublishLogInfo{GroupID: cg.groupInfo.ID, Success: err == nil, JsonUrl: cg.groupInfo.JsonUrl}
+	if err != nil {
+		entry.Error = err.Error()
+		if len(entry.Error) > PUBLISH_LOG_ERROR_MAX {
+			entry.Error = entry.Error[:PUBLISH_LOG_ERROR_MAX]
 		}
 	}
+	if logErr := cg.cdb.InsertPublishLog(entry); logErr != nil {
+		cg.log.Errorf("record publish log error: %v\n", logErr)
+	}
+
+	if err == nil {
+		cg.stateMutex.Lock()
+		cg.state.LastSuccess = now.Unix()
+		cg.state.ConsecutiveFailures = 0
+		cg.state.NextRetry = 0
+		cg.state.JsonUrl = cg.groupInfo.JsonUrl
+		cg.state.Urls = urls
+		cg.stateMutex.Unlock()
+		// outside the lock, the webhook deliveries are written to db
+		cg.logic.publish(EVENT_CONTENT_PUBLISHED, cg.groupInfo.TenantID, &ContentPublishedEvent{
+			GroupID: cg.groupInfo.ID,
+			JsonUrl: cg.groupInfo.JsonUrl,
+			Urls:    urls,
+		})
+		return
+	}
+
+	cg.stateMutex.Lock()
+	defer cg.stateMutex.Unlock()
+	cg.state.LastFailure = now.Unix()
+	cg.state.ConsecutiveFailures++
+	cg.state.LastError = err.Error()
+	cg.state.NextRetry = now.Add(publishBackoff(cg.state.ConsecutiveFailures)).Unix()
+	cg.log.Warningf("content group publish failed %d times, next retry at %s.\n",
+		cg.state.ConsecutiveFailures, time.Unix(cg.state.NextRetry, 0).Format("2006-01-02 15:04:05"))
+}
+
+// publishBackoff doubles the wait for every consecutive failure, up to PUBLISH_BACKOFF_MAX.
+func publishBackoff(failures int64) time.Duration {
+	d := PUBLISH_BACKOFF_BASE
+	for i := int64(1); i < failures; i++ {
+		d *= 2
+		if d >= PUBLISH_BACKOFF_MAX {
+			return PUBLISH_BACKOFF_MAX
+		}
+	}
+	return d
+}
+
+func (cg *ContentGenerate) saveAndPublish(list *ContentList, now int64) (map[string]string, error) {
+	feed := &ContentFeed{
+		Group:      cg.groupInfo,
+		Link:       cg.baseUrl(),
+		UpdateTime: list.UpdateTime,
+	}
+	// list is ordered by pinned, position, id
 	for _, v := range list.ContentList {
+		if !v.Enabled || !v.IsLive(now) {
+			continue
+		}
 		switch cg.groupInfo.Type {
 		case CONTENT_TYPE_VIDEO:
 			var info Video
@@ -125,39 +215,68 @@ func (cg *ContentGenerate) saveAndPublish(list *ContentList) error {
 				continue
 			}
 			info.ID = v.ID
-			var ifMain bool
-			for _, mv := range cg.groupInfo.MainContent {
-				if v.ID == mv {
-					ifMain = true
-					break
-				}
+			feed.Items = append(feed.Items, &ContentFeedItem{Video: info, UpdateTime: v.UpdateTime})
+		}
+	}
+
+	urls := make(map[string]string)
+	var mainUrl string
+	var exts []string
+	for _, format := range ContentFormats(cg.groupInfo) {
+		rc, err := RenderContent(format, feed)
+		if err != nil {
+			cg.log.Errorf("render content format[%s] error: %v\n", format, err)
+			return nil, err
+		}
+		gzData, err := GzipBytes(rc.Data)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, rc.Ext)
+		var url string
+		if cg.cache != nil {
+			cg.cache.Set(cg.groupInfo.ID, rc, gzData, time.Unix(now, 0))
+			url = cg.cache.Url(cg.groupInfo.ID, rc.Ext)
+		}
+		if cg.publisher != nil {
+			filename := cg.groupInfo.Name + rc.Ext
+			url, err = cg.publisher.Publish(&PublishObject{Name: filename, Data: rc.Data, ContentType: rc.ContentType})
+			if err != nil {
+				return nil, err
 			}
-			if !ifMain {
-				dataList = append(dataList, info)
+			_, err = cg.publisher.Publish(&PublishObject{Name: filename + ".gz", Data: gzData, ContentType: rc.ContentType, ContentEncoding: "gzip"})
+			if err != nil {
+				return nil, err
 			}
 		}
+		urls[format] = url
+		if mainUrl == "" || format == CONTENT_FORMAT_JSON {
+			mainUrl = url
+		}
 	}
-	data := append(dataListMain, dataList...)
-	dataListBytes, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
-	filename := cg.groupInfo.Name + ".json"
 
-	bucket, err := cg.aliyunInfo.AliyunClient.Bucket(cg.aliyunInfo.Bucket)
-	if err != nil {
-		plog.Errorf("create bucket[%v] error: %v\n", cg.aliyunInfo, err)
-		return err
+	if cg.cache != nil {
+		cg.cache.RetainGroup(cg.groupInfo.ID, exts)
 	}
-	err = bucket.PutObject(filename, bytes.NewReader(dataListBytes), []oss.Option{oss.ContentType("text/html"), oss.ContentEncoding("utf-8")}...)
+
+	cg.groupInfo.JsonUrl = mainUrl
+	err := cg.cdb.UpdateContentJsonUrl(cg.groupInfo)
 	if err != nil {
-		plog.Errorf("put object bucket[%v] error: %v\n", cg.aliyunInfo, err)
-		return err
+		cg.log.Errorf("update content json url[%s] error: %v\n", cg.groupInfo.JsonUrl, err)
+		return nil, err
 	}
-	plog.Infof("aliyun publish file[%s] success.\n", filename)
-	cg.groupInfo.JsonUrl = cg.aliyunInfo.Url + filename
-	cg.cdb.UpdateContentJsonUrl(cg.groupInfo)
-	plog.Infof("update content json url[%s] success.\n", cg.groupInfo.JsonUrl)
+	cg.log.Infof("update content json url[%s] success.\n", cg.groupInfo.JsonUrl)
 
-	return nil
+	return urls, nil
+}
+
+// baseUrl is where the published content can be fetched, oss first.
+func (cg *ContentGenerate) baseUrl() string {
+	if cg.publisher != nil {
+		return cg.publisher.BaseUrl()
+	}
+	if cg.cache != nil {
+		return cg.cache.BaseUrl()
+	}
+	return ""
 }
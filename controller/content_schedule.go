@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"sort"
+	"time"
+)
+
+// IsLive reports whether the content is inside its [publishAt, expireAt) window.
+func (ci *ContentInfo) IsLive(now int64) bool {
+	if ci.PublishAt != 0 && now < ci.PublishAt {
+		return false
+	}
+	if ci.ExpireAt != 0 && now >= ci.ExpireAt {
+		return false
+	}
+	return true
+}
+
+// CrossedBoundary reports whether any enabled content enters or leaves its
+// window in (from, to].
+func (list *ContentList) CrossedBoundary(from, to int64) bool {
+	for _, v := range list.ContentList {
+		if !v.Enabled {
+			continue
+		}
+		if v.PublishAt > from && v.PublishAt <= to {
+			return true
+		}
+		if v.ExpireAt > from && v.ExpireAt <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpcomingSchedule returns the window changes after now, ordered by time.
+func (list *ContentList) UpcomingSchedule(now int64) []*ContentScheduleInfo {
+	result := make([]*ContentScheduleInfo, 0)
+	for _, v := range list.ContentList {
+		if !v.Enabled {
+			continue
+		}
+		if v.PublishAt > now {
+			result = append(result, newContentScheduleInfo(v.ID, SCHEDULE_ACTION_PUBLISH, v.PublishAt))
+		}
+		if v.ExpireAt > now {
+			result = append(result, newContentScheduleInfo(v.ID, SCHEDULE_ACTION_EXPIRE, v.ExpireAt))
+		}
+	}
+	sort.Sort(contentScheduleSorter(result))
+	return result
+}
+
+func newContentScheduleInfo(id int64, action string, at int64) *ContentScheduleInfo {
+	return &ContentScheduleInfo{
+		ContentID: id,
+		Action:    action,
+		At:        at,
+		Time:      time.Unix(at, 0).Format("2006-01-02 15:04:05"),
+	}
+}
+
+type contentScheduleSorter []*ContentScheduleInfo
+
+func (s contentScheduleSorter) Len() int      { return len(s) }
+func (s contentScheduleSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s contentScheduleSorter) Less(i, j int) bool {
+	if s[i].At != s[j].At {
+		return s[i].At < s[j].At
+	}
+	return s[i].ContentID < s[j].ContentID
+}
@@ -10,8 +10,9 @@ import (
 )
 
 type XHttpServer struct {
-	logic *ControllerLogic
-	hs    *HttpSrv
+	logic      *ControllerLogic
+	hs         *HttpSrv
+	domainsTpl *TemplateCache
 }
 
 type HttpHandler func(rsp http.ResponseWriter, req *http.Request) (interface{}, error)
@@ -23,7 +24,8 @@ func NewXHttpServer(addr string, port int, logic *ControllerLogic) *XHttpServer
 			HttpPort: port,
 			Routers:  make(map[string]http.HandlerFunc),
 		},
-		logic: logic,
+		logic:      logic,
+		domainsTpl: NewTemplateCache(),
 	}
 	xhs.registerHandlers()
 
@@ -34,6 +36,10 @@ func (xhs *XHttpServer) Run() {
 	xhs.hs.Run()
 }
 
+func (xhs *XHttpServer) Handler() http.Handler {
+	return xhs.hs.Handler()
+}
+
 func (xhs *XHttpServer) registerHandlers() {
 	xhs.hs.Route("/", xhs.Index)
 
@@ -51,27 +57,93 @@ func (xhs *XHttpServer) registerHandlers() {
 	xhs.hs.Route("/domain/add_video_content", xhs.httpWrap(xhs.addVideoContent))
 	xhs.hs.Route("/domain/get_content_group", xhs.httpWrap(xhs.getContentGroup))
 	xhs.hs.Route("/domain/get_content_list", xhs.httpWrap(xhs.getContentList))
+	xhs.hs.Route("/domain/setting_content_group", xhs.httpWrap(xhs.settingContentGroup))
+	xhs.hs.Route("/domain/setting_content", xhs.httpWrap(xhs.settingContent))
+	xhs.hs.Route("/domain/reorder_content", xhs.httpWrap(xhs.reorderContent))
+	xhs.hs.Route("/domain/set_content_schedule", xhs.httpWrap(xhs.setContentSchedule))
+	xhs.hs.Route("/domain/get_content_schedule", xhs.httpWrap(xhs.getContentSchedule))
+	xhs.hs.Route("/domain/publish_content", xhs.httpWrap(xhs.publishContent))
+	xhs.hs.Route("/domain/get_publish_status", xhs.httpWrap(xhs.getPublishStatus))
+	xhs.hs.Route("/domain/provision_bucket", xhs.httpWrap(xhs.provisionBucket))
+	xhs.hs.Route("/domain/get_schedule", xhs.httpWrap(xhs.getSchedule))
+	xhs.hs.Route("/domain/check_now", xhs.httpWrap(xhs.checkNow))
+	xhs.hs.Route("/domain/set_check_interval", xhs.httpWrap(xhs.setCheckInterval))
+	xhs.hs.Route("/domain/get_config", xhs.httpWrap(xhs.getConfig))
+	xhs.hs.Route("/domain/reload_config", xhs.httpWrap(xhs.reloadConfig))
 	xhs.hs.Route("/domain/get_data", xhs.httpWrap(xhs.getData))
+	xhs.hs.Route("/domain/update_domain_group", xhs.httpWrap(xhs.updateDomainGroup))
+	xhs.hs.Route("/domain/update_domain", xhs.httpWrap(xhs.updateDomain))
+	xhs.hs.Route("/domain/update_content_group", xhs.httpWrap(xhs.updateContentGroup))
+	xhs.hs.Route("/domain/update_video_content", xhs.httpWrap(xhs.updateVideoContent))
+	xhs.hs.Route("/domain/delete_domain_group", xhs.httpWrap(xhs.deleteDomainGroup))
+	xhs.hs.Route("/domain/delete_domain", xhs.httpWrap(xhs.deleteDomain))
+	xhs.hs.Route("/domain/delete_content_group", xhs.httpWrap(xhs.deleteContentGroup))
+	xhs.hs.Route("/domain/delete_content", xhs.httpWrap(xhs.deleteContent))
+	xhs.hs.Route("/domain/get_health_history", xhs.httpWrap(xhs.getHealthHistory))
+	xhs.hs.Route("/domain/import_domains", xhs.httpWrap(xhs.importDomains))
+	xhs.hs.Route("/domain/export_domains", xhs.httpWrap(xhs.exportDomains))
+	xhs.hs.Route("/domain/set_domain_expiry", xhs.httpWrap(xhs.setDomainExpiry))
+	xhs.hs.Route("/domain/get_expiring_domains", xhs.httpWrap(xhs.getExpiringDomains))
+	xhs.hs.Route("/domain/probe_certs", xhs.httpWrap(xhs.probeCerts))
+	xhs.hs.Route("/domain/set_show_groups", xhs.httpWrap(xhs.setShowGroups))
+	xhs.hs.Route("/domain/get_show_topology", xhs.httpWrap(xhs.getShowTopology))
+	xhs.hs.Route("/domain/add_tenant", xhs.httpWrap(xhs.addTenant))
+	xhs.hs.Route("/domain/update_tenant", xhs.httpWrap(xhs.updateTenant))
+	xhs.hs.Route("/domain/delete_tenant", xhs.httpWrap(xhs.deleteTenant))
+	xhs.hs.Route("/domain/get_tenants", xhs.httpWrap(xhs.getTenants))
+	xhs.hs.Route("/domain/add_api_key", xhs.httpWrap(xhs.addApiKey))
+	xhs.hs.Route("/domain/get_api_keys", xhs.httpWrap(xhs.getApiKeys))
+	xhs.hs.Route("/domain/delete_api_key", xhs.httpWrap(xhs.deleteApiKey))
+	xhs.hs.Route("/domain/set_group_tenant", xhs.httpWrap(xhs.setGroupTenant))
+	xhs.hs.Route("/domain/add_webhook", xhs.httpWrap(xhs.addWebhook))
+	xhs.hs.Route("/domain/update_webhook", xhs.httpWrap(xhs.updateWebhook))
+	xhs.hs.Route("/domain/delete_webhook", xhs.httpWrap(xhs.deleteWebhook))
+	xhs.hs.Route("/domain/get_webhooks", xhs.httpWrap(xhs.getWebhooks))
+	xhs.hs.Route("/domain/get_webhook_deliveries", xhs.httpWrap(xhs.getWebhookDeliveries))
+	xhs.hs.Route("/domain/redeliver_webhook", xhs.httpWrap(xhs.redeliverWebhook))
+	xhs.hs.Route("/domain/get_publish_history", xhs.httpWrap(xhs.getPublishHistory))
+	xhs.hs.Route("/domain/get_audit_log", xhs.httpWrap(xhs.getAuditLog))
+
+	xhs.hs.Route(ADMIN_UI_PATH, xhs.adminUI)
+	xhs.hs.Route(ADMIN_LOGIN_PATH, xhs.httpWrap(xhs.adminLogin))
+	xhs.hs.Route(ADMIN_LOGOUT_PATH, xhs.httpWrap(xhs.adminLogout))
+
+	xhs.hs.Route("/api/v2/stats", xhs.httpWrap(xhs.getStats))
+	xhs.hs.Route("/metrics", xhs.metrics)
+	xhs.hs.Route("/api/v2/events", xhs.events)
 
 	xhs.hs.Route("/domain/get_all_domains", xhs.getAllDomains)
+
+	if xhs.logic.contentCache != nil {
+		xhs.hs.Route(CONTENT_PATH_PREFIX, xhs.logic.contentCache.ServeHTTP)
+	}
+	// the limiter runs first, a caller guessing keys is limited by ip, the audit last with the caller known
+	xhs.auditRoutes()
+	xhs.authRoutes()
+	xhs.limitRoutes()
 }
 
 func (xhs *XHttpServer) httpWrap(handler HttpHandler) func(rsp http.ResponseWriter, req *http.Request) {
 	f := func(rsp http.ResponseWriter, req *http.Request) {
 		logURL := req.URL.String()
 		start := time.Now()
+		// handlers read the id back from the request header
+		req.Header.Set(REQUEST_ID_HEADER, requestID(req))
+		rsp.Header().Set(REQUEST_ID_HEADER, req.Header.Get(REQUEST_ID_HEADER))
+		log := requestLogger(req)
 		defer func() {
-			plog.Debugf("[XHttpServer][httpWrap] http: request url[%s] use_time[%v]", logURL, time.Now().Sub(start))
+			log.Debugf("[XHttpServer][httpWrap] http: request url[%s] use_time[%v]", logURL, time.Now().Sub(start))
 		}()
 		obj, err := handler(rsp, req)
 		// check err
 	HAS_ERR:
 		rsp.Header().Set("Access-Control-Allow-Origin", "*")
 		rsp.Header().Set("Access-Control-Allow-Methods", "POST")
-		rsp.Header().Set("Access-Control-Allow-Headers", "x-requested-with,content-type")
+		rsp.Header().Set("Access-Control-Allow-Headers", "x-requested-with,content-type,x-request-id,x-api-key")
+		rsp.Header().Set("Access-Control-Expose-Headers", REQUEST_ID_HEADER)
 
 		if err != nil {
-			plog.Debugf("[XHttpServer][httpWrap] http: request url[%s] error: %v", logURL, err)
+			log.Debugf("[XHttpServer][httpWrap] http: request url[%s] error: %v", logURL, err)
 			code := 500
 			errMsg := err.Error()
 			if strings.Contains(errMsg, "Permission denied") || strings.Contains(errMsg, "ACL not found") {
@@ -128,7 +200,7 @@ type ClientInfo struct {
 
 func (xhs *XHttpServer) GetClientInfo(req *http.Request) *ClientInfo {
 	return &ClientInfo{
-		IP:        strings.Split(req.RemoteAddr, ":")[0],
+		IP:        xhs.logic.TrustedProxies().ClientIP(req),
 		UserAgent: req.UserAgent(),
 		Referrer:  req.Referer(),
 	}
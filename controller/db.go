@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -24,8 +25,12 @@ func NewControllerDB(cfg *utils.MysqlInfo) (*ControllerDB, error) {
 	return cdb, nil
 }
 
+func (cdb *ControllerDB) SetMaxConns(maxOpenConns, maxIdleConns int) {
+	cdb.db.SetMaxConns(maxOpenConns, maxIdleConns)
+}
+
 func (cdb *ControllerDB) InsertDomainGroup(info *DomainGroupInfo) error {
-	id, err := cdb.db.Insert("insert into domain_group(name,status,share_status,ads_status) values(?,?,?,?)", info.Name, info.Status, info.ShareStatus, info.AdsStatus)
+	id, err := cdb.db.Insert("insert into domain_group(name,type,status,share_status,ads_status,tenant_id) values(?,?,?,?,?,?)", info.Name, info.Type, info.Status, info.ShareStatus, info.AdsStatus, info.TenantID)
 	if err != nil {
 		return err
 	}
@@ -43,7 +48,7 @@ func (cdb *ControllerDB) InsertDomain(info *DomainInfo) error {
 }
 
 func (cdb *ControllerDB) InsertContentGroup(info *ContentGroupInfo) error {
-	id, err := cdb.db.Insert("insert into content_group(name,type) values(?,?)", info.Name, info.Type)
+	id, err := cdb.db.Insert("insert into content_group(name,type,formats,jsonp_callback,tenant_id) values(?,?,?,?,?)", info.Name, info.Type, strings.Join(info.Formats, ","), info.JsonpCallback, info.TenantID)
 	if err != nil {
 		return err
 	}
@@ -52,7 +57,8 @@ func (cdb *ControllerDB) InsertContentGroup(info *ContentGroupInfo) error {
 }
 
 func (cdb *ControllerDB) InsertContent(info *ContentInfo) error {
-	id, err := cdb.db.Insert("insert into content(group_id,value,type) values(?,?,?)", info.GroupID, info.Value, info.Type)
+	id, err := cdb.db.Insert("insert into content(group_id,value,type,position,enabled,pinned,publish_at,expire_at) values(?,?,?,?,?,?,FROM_UNIXTIME(NULLIF(?,0)),FROM_UNIXTIME(NULLIF(?,0)))",
+		info.GroupID, info.Value, info.Type, info.Position, info.Enabled, info.Pinned, info.PublishAt, info.ExpireAt)
 	if err != nil {
 		return err
 	}
@@ -60,68 +66,138 @@ func (cdb *ControllerDB) InsertContent(info *ContentInfo) error {
 	return nil
 }
 
-func (cdb *ControllerDB) GetAllDomain() ([]string, error) {
-	rows, err := cdb.db.FetchRows("select domain from domain where status=0 group by domain")
+// GetDomains returns a page of the domains matching query, and the number of all matching.
+// Distinct rows take the smallest id, group and status of a domain. A limit of 0 returns every row.
+func (cdb *ControllerDB) GetDomains(query *DomainQuery) ([]*DomainListItem, int64, error) {
+	var where []string
+	var args []interface{}
+	if query.GroupID != 0 {
+		where = append(where, "d.group_id=?")
+		args = append(args, query.GroupID)
+	}
+	if query.TenantID != TENANT_ALL {
+		where = append(where, "g.tenant_id=?")
+		args = append(args, query.TenantID)
+	}
+	if query.Status >= 0 {
+		where = append(where, "d.status=?")
+		args = append(args, query.Status)
+	}
+	if query.Type >= 0 {
+		where = append(where, "g.type=?")
+		args = append(args, query.Type)
+	}
+	if query.Name != "" {
+		where = append(where, "d.domain like ?")
+		args = append(args, "%"+likeEscaper.Replace(query.Name)+"%")
+	}
+	from := " from domain d join domain_group g on g.id=d.group_id"
+	if len(where) != 0 {
+		from += " where " + strings.Join(where, " and ")
+	}
+
+	countSql := "select count(*) as total" + from
+	sqlstr := "select d.id,d.group_id,g.name as group_name,g.type as group_type,d.domain,d.status,1 as group_count,d.time" + from + " order by d.id"
+	if query.Distinct {
+		countSql = "select count(distinct d.domain) as total" + from
+		sqlstr = "select min(d.id) as id,min(d.group_id) as group_id,'' as group_name,min(g.type) as group_type,d.domain,min(d.status) as status," +
+			"count(*) as group_count,min(d.time) as time" + from + " group by d.domain order by id"
+	}
+	row, err := cdb.db.FetchRow(countSql, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	total, err := strconv.ParseInt((*row)["total"], 10, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if query.Limit > 0 {
+		sqlstr += " limit ?,?"
+		args = append(args, query.Offset, query.Limit)
+	}
+	rows, err := cdb.db.FetchRows(sqlstr, args...)
+	if err != nil {
+		return nil, 0, err
 	}
-	var list []string
+	list := make([]*DomainListItem, 0, len(*rows))
 	for _, v := range *rows {
-		list = append(list, v["domain"])
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		groupID, _ := strconv.ParseInt(v["group_id"], 10, 0)
+		groupType, _ := strconv.ParseInt(v["group_type"], 10, 0)
+		status, _ := strconv.ParseInt(v["status"], 10, 0)
+		groups, _ := strconv.ParseInt(v["group_count"], 10, 0)
+		list = append(list, &DomainListItem{
+			ID:        id,
+			GroupID:   groupID,
+			GroupName: v["group_name"],
+			GroupType: groupType,
+			Domain:    v["domain"],
+			Status:    status,
+			Groups:    groups,
+			Time:      v["time"],
+		})
 	}
-	return list, nil
+	return list, total, nil
 }
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func (cdb *ControllerDB) GetDomainGroupFromID(info *DomainGroupInfo) error {
-	row, err := cdb.db.FetchRow("select name,status,share_status,ads_status,type,show_group_list,time from domain_group where id=?", info.ID)
+	row, err := cdb.db.FetchRow("select name,status,share_status,ads_status,type,check_interval,tenant_id,time from domain_group where id=?", info.ID)
 	if err != nil {
 		return err
 	}
 	status, err := strconv.ParseInt((*row)["status"], 10, 0)
 	if err != nil {
-		plog.Errorf("GetDomainGroupFromID parse status[%s] error: %v\n", (*row)["status"], err)
-		return err
+		return fmt.Errorf("domain group[%d] status[%s] error: %v", info.ID, (*row)["status"], err)
 	}
 	shareStatus, err := strconv.ParseInt((*row)["share_status"], 10, 0)
 	if err != nil {
-		plog.Errorf("GetDomainGroupFromID parse share_status[%s] error: %v\n", (*row)["share_status"], err)
-		return err
+		return fmt.Errorf("domain group[%d] share_status[%s] error: %v", info.ID, (*row)["share_status"], err)
 	}
 	adsStatus, err := strconv.ParseInt((*row)["ads_status"], 10, 0)
 	if err != nil {
-		plog.Errorf("GetDomainGroupFromID parse ads_status[%s] error: %v\n", (*row)["ads_status"], err)
-		return err
+		return fmt.Errorf("domain group[%d] ads_status[%s] error: %v", info.ID, (*row)["ads_status"], err)
 	}
 	t, err := strconv.ParseInt((*row)["type"], 10, 0)
 	if err != nil {
-		plog.Errorf("GetDomainGroupFromID parse type[%s] error: %v\n", (*row)["type"], err)
-		return err
+		return fmt.Errorf("domain group[%d] type[%s] error: %v", info.ID, (*row)["type"], err)
+	}
+	checkInterval, err := strconv.ParseInt((*row)["check_interval"], 10, 0)
+	if err != nil {
+		return fmt.Errorf("domain group[%d] check_interval[%s] error: %v", info.ID, (*row)["check_interval"], err)
+	}
+	tenantID, err := strconv.ParseInt((*row)["tenant_id"], 10, 0)
+	if err != nil {
+		return fmt.Errorf("domain group[%d] tenant_id[%s] error: %v", info.ID, (*row)["tenant_id"], err)
 	}
 	info.Name = (*row)["name"]
 	info.Status = status
 	info.ShareStatus = shareStatus
 	info.AdsStatus = adsStatus
 	info.Type = t
+	info.CheckInterval = checkInterval
+	info.TenantID = tenantID
 	info.Time = (*row)["time"]
-	if (*row)["show_group_list"] != "" && (*row)["show_group_list"] != info.ShowListStr {
-		info.ShowListStr = (*row)["show_group_list"]
-		showList := strings.Split((*row)["show_group_list"], ",")
-		info.ShowGroupList = nil
-		for _, v := range showList {
-			sId, err := strconv.ParseInt(v, 10, 0)
-			if err != nil {
-				plog.Errorf("GetDomainGroupFromID show_group_list[%s] strconv error: %v", v, err)
-				continue
-			}
-			info.ShowGroupList = append(info.ShowGroupList, sId)
-		}
+	shows, err := cdb.GetDomainGroupShows(info.ID)
+	if err != nil {
+		return err
 	}
+	info.SetShowGroups(shows[info.ID])
 
 	return nil
 }
 
 func (cdb *ControllerDB) GetDomainGroupList(maxID int64) ([]*DomainGroupInfo, int64, error) {
-	rows, err := cdb.db.FetchRows("select id,name,status,share_status,ads_status,type,show_group_list,time from domain_group where id>?", maxID)
+	rows, err := cdb.db.FetchRows("select id,name,status,share_status,ads_status,type,check_interval,tenant_id,time from domain_group where id>?", maxID)
+	if err != nil {
+		return nil, 0, err
+	}
+	shows, err := cdb.GetDomainGroupShows(0)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -148,38 +224,38 @@ func (cdb *ControllerDB) GetDomainGroupList(maxID int64) ([]*DomainGroupInfo, in
 		if err != nil {
 			continue
 		}
+		checkInterval, err := strconv.ParseInt(v["check_interval"], 10, 0)
+		if err != nil {
+			continue
+		}
+		tenantID, err := strconv.ParseInt(v["tenant_id"], 10, 0)
+		if err != nil {
+			continue
+		}
 
 		if id > newMaxID {
 			newMaxID = id
 		}
 		info := &DomainGroupInfo{
-			ID:          id,
-			Name:        v["name"],
-			Status:      status,
-			ShareStatus: shareStatus,
-			AdsStatus:   adsStatus,
-			Type:        t,
-			Time:        v["time"],
-		}
-		if v["show_group_list"] != "" {
-			info.ShowListStr = v["show_group_list"]
-			showList := strings.Split(v["show_group_list"], ",")
-			for _, v := range showList {
-				sId, err := strconv.ParseInt(v, 10, 0)
-				if err != nil {
-					plog.Errorf("GetDomainGroupFromID show_group_list[%s] strconv error: %v", v, err)
-					continue
-				}
-				info.ShowGroupList = append(info.ShowGroupList, sId)
-			}
+			ID:            id,
+			Name:          v["name"],
+			Status:        status,
+			ShareStatus:   shareStatus,
+			AdsStatus:     adsStatus,
+			Type:          t,
+			CheckInterval: checkInterval,
+			TenantID:      tenantID,
+			Time:          v["time"],
 		}
+		info.SetShowGroups(shows[id])
 		list = append(list, info)
 	}
 	return list, newMaxID, nil
 }
 
 func (cdb *ControllerDB) GetDomainList(list *DomainList) error {
-	rows, err := cdb.db.FetchRows("select id,domain,status,time,UNIX_TIMESTAMP(time) as utime from domain where group_id=?", list.GroupID)
+	rows, err := cdb.db.FetchRows("select id,domain,status,IFNULL(UNIX_TIMESTAMP(registration_expires_at),0) as registration_expires_at,"+
+		"IFNULL(UNIX_TIMESTAMP(cert_expires_at),0) as cert_expires_at,time,UNIX_TIMESTAMP(time) as utime from domain where group_id=?", list.GroupID)
 	if err != nil {
 		return err
 	}
@@ -199,12 +275,16 @@ func (cdb *ControllerDB) GetDomainList(list *DomainList) error {
 		if uTime > list.UpdateTime {
 			list.UpdateTime = uTime
 		}
+		registrationExpiresAt, _ := strconv.ParseInt(v["registration_expires_at"], 10, 0)
+		certExpiresAt, _ := strconv.ParseInt(v["cert_expires_at"], 10, 0)
 		info := &DomainInfo{
-			ID:      id,
-			GroupID: list.GroupID,
-			Domain:  v["domain"],
-			Status:  status,
-			Time:    v["time"],
+			ID:                    id,
+			GroupID:               list.GroupID,
+			Domain:                v["domain"],
+			Status:                status,
+			RegistrationExpiresAt: registrationExpiresAt,
+			CertExpiresAt:         certExpiresAt,
+			Time:                  v["time"],
 		}
 		list.DomainList = append(list.DomainList, info)
 	}
@@ -212,7 +292,7 @@ func (cdb *ControllerDB) GetDomainList(list *DomainList) error {
 }
 
 func (cdb *ControllerDB) GetContentGroupFromID(info *ContentGroupInfo) error {
-	row, err := cdb.db.FetchRow("select name,json_url,type,main_content,time,UNIX_TIMESTAMP(time) as utime from content_group where id=?", info.ID)
+	row, err := cdb.db.FetchRow("select name,json_url,type,formats,jsonp_callback,check_interval,tenant_id,time,UNIX_TIMESTAMP(time) as utime from content_group where id=?", info.ID)
 	if err != nil {
 		return err
 	}
@@ -220,34 +300,33 @@ func (cdb *ControllerDB) GetContentGroupFromID(info *ContentGroupInfo) error {
 	if err != nil {
 		return err
 	}
+	checkInterval, err := strconv.ParseInt((*row)["check_interval"], 10, 0)
+	if err != nil {
+		return err
+	}
 	utime, err := strconv.ParseInt((*row)["utime"], 10, 0)
 	if err != nil {
 		return err
 	}
+	tenantID, err := strconv.ParseInt((*row)["tenant_id"], 10, 0)
+	if err != nil {
+		return err
+	}
 	info.Name = (*row)["name"]
 	info.JsonUrl = (*row)["json_url"]
 	info.Type = t
+	info.Formats = splitContentFormats((*row)["formats"])
+	info.JsonpCallback = (*row)["jsonp_callback"]
+	info.CheckInterval = checkInterval
+	info.TenantID = tenantID
 	info.Time = (*row)["time"]
 	info.UpdateTime = utime
-	if (*row)["main_content"] != "" {
-		mainList := strings.Split((*row)["main_content"], ",")
-		info.MainContent = nil
-		for _, v := range mainList {
-			cId, err := strconv.ParseInt(v, 10, 0)
-			if err != nil {
-				plog.Errorf("main content[%s] strconv error: %v", v, err)
-				continue
-			}
-			info.MainContent = append(info.MainContent, cId)
-		}
-		plog.Debugf("content_group_id[%d] main_content: %v\n", info.ID, info.MainContent)
-	}
 
 	return nil
 }
 
 func (cdb *ControllerDB) GetContentGroupList(maxID int64) ([]*ContentGroupInfo, int64, error) {
-	rows, err := cdb.db.FetchRows("select id,name,json_url,time from content_group where id>?", maxID)
+	rows, err := cdb.db.FetchRows("select id,name,json_url,type,formats,jsonp_callback,check_interval,tenant_id,time from content_group where id>?", maxID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -258,14 +337,31 @@ func (cdb *ControllerDB) GetContentGroupList(maxID int64) ([]*ContentGroupInfo,
 		if err != nil {
 			continue
 		}
+		t, err := strconv.ParseInt(v["type"], 10, 0)
+		if err != nil {
+			continue
+		}
+		checkInterval, err := strconv.ParseInt(v["check_interval"], 10, 0)
+		if err != nil {
+			continue
+		}
+		tenantID, err := strconv.ParseInt(v["tenant_id"], 10, 0)
+		if err != nil {
+			continue
+		}
 		if id > newMaxID {
 			newMaxID = id
 		}
 		info := &ContentGroupInfo{
-			ID:      id,
-			Name:    v["name"],
-			JsonUrl: v["json_url"],
-			Time:    v["time"],
+			ID:            id,
+			Name:          v["name"],
+			JsonUrl:       v["json_url"],
+			Type:          t,
+			Formats:       splitContentFormats(v["formats"]),
+			JsonpCallback: v["jsonp_callback"],
+			CheckInterval: checkInterval,
+			TenantID:      tenantID,
+			Time:          v["time"],
 		}
 		list = append(list, info)
 	}
@@ -273,7 +369,7 @@ func (cdb *ControllerDB) GetContentGroupList(maxID int64) ([]*ContentGroupInfo,
 }
 
 func (cdb *ControllerDB) GetContentList(list *ContentList) error {
-	rows, err := cdb.db.FetchRows("select id,value,type,time,UNIX_TIMESTAMP(time) as utime from content where group_id=?", list.GroupID)
+	rows, err := cdb.db.FetchRows("select id,value,type,position,enabled,pinned,IFNULL(UNIX_TIMESTAMP(publish_at),0) as publish_at,IFNULL(UNIX_TIMESTAMP(expire_at),0) as expire_at,time,UNIX_TIMESTAMP(time) as utime from content where group_id=? order by pinned desc,position,id", list.GroupID)
 	if err != nil {
 		return err
 	}
@@ -286,6 +382,18 @@ func (cdb *ControllerDB) GetContentList(list *ContentList) error {
 		if err != nil {
 			continue
 		}
+		position, err := strconv.ParseInt(v["position"], 10, 0)
+		if err != nil {
+			continue
+		}
+		publishAt, err := strconv.ParseInt(v["publish_at"], 10, 0)
+		if err != nil {
+			continue
+		}
+		expireAt, err := strconv.ParseInt(v["expire_at"], 10, 0)
+		if err != nil {
+			continue
+		}
 		uTime, err := strconv.ParseInt(v["utime"], 10, 0)
 		if err != nil {
 			continue
@@ -294,11 +402,17 @@ func (cdb *ControllerDB) GetContentList(list *ContentList) error {
 			list.UpdateTime = uTime
 		}
 		info := &ContentInfo{
-			ID:      id,
-			GroupID: list.GroupID,
-			Value:   v["value"],
-			Type:    cType,
-			Time:    v["time"],
+			ID:         id,
+			GroupID:    list.GroupID,
+			Value:      v["value"],
+			Type:       cType,
+			Position:   position,
+			Enabled:    v["enabled"] != "0",
+			Pinned:     v["pinned"] != "0",
+			PublishAt:  publishAt,
+			ExpireAt:   expireAt,
+			Time:       v["time"],
+			UpdateTime: uTime,
 		}
 		list.ContentList = append(list.ContentList, info)
 	}
@@ -313,8 +427,15 @@ func (cdb *ControllerDB) UpdateDomainStatus(info *DomainInfo) error {
 	return nil
 }
 
-func (cdb *ControllerDB) UpdateDomainsStatus(info *DomainInfo) error {
-	_, err := cdb.db.Exec("update domain set status=? where domain=?", info.Status, info.Domain)
+// UpdateDomainsStatus sets the status of a domain in every group, of the groups of a tenant unless tenantID is TENANT_ALL.
+func (cdb *ControllerDB) UpdateDomainsStatus(info *DomainInfo, tenantID int64) error {
+	var err error
+	if tenantID == TENANT_ALL {
+		_, err = cdb.db.Exec("update domain set status=? where domain=?", info.Status, info.Domain)
+	} else {
+		_, err = cdb.db.Exec("update domain set status=? where domain=? and group_id in (select id from domain_group where tenant_id=?)",
+			info.Status, info.Domain, tenantID)
+	}
 	if err != nil {
 		return err
 	}
@@ -329,6 +450,22 @@ func (cdb *ControllerDB) UpdateDomainGroupStatus(info *DomainGroupInfo) error {
 	return nil
 }
 
+func (cdb *ControllerDB) UpdateDomainGroupCheckInterval(info *DomainGroupInfo) error {
+	_, err := cdb.db.Exec("update domain_group set check_interval=? where id=?", info.CheckInterval, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) UpdateContentGroupCheckInterval(info *ContentGroupInfo) error {
+	_, err := cdb.db.Exec("update content_group set check_interval=? where id=?", info.CheckInterval, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (cdb *ControllerDB) UpdateContentJsonUrl(info *ContentGroupInfo) error {
 	_, err := cdb.db.Exec("update content_group set json_url=? where id=?", info.JsonUrl, info.ID)
 	if err != nil {
@@ -336,3 +473,881 @@ func (cdb *ControllerDB) UpdateContentJsonUrl(info *ContentGroupInfo) error {
 	}
 	return nil
 }
+
+func (cdb *ControllerDB) UpdateContentGroupFormats(info *ContentGroupInfo) error {
+	_, err := cdb.db.Exec("update content_group set formats=?,jsonp_callback=? where id=?", strings.Join(info.Formats, ","), info.JsonpCallback, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateContentSetting sets the fields of info that are not nil.
+func (cdb *ControllerDB) UpdateContentSetting(info *ContentSetting) error {
+	var sets []string
+	var args []interface{}
+	if info.Enabled != nil {
+		sets = append(sets, "enabled=?")
+		args = append(args, *info.Enabled)
+	}
+	if info.Pinned != nil {
+		sets = append(sets, "pinned=?")
+		args = append(args, *info.Pinned)
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("nothing to set, send enabled or pinned.")
+	}
+	n, err := cdb.db.Exec("update content set "+strings.Join(sets, ",")+" where id=?", append(args, info.ID)...)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// mysql counts changed rows, a row already set this way is not missing
+		return cdb.GetContentFromID(&ContentInfo{ID: info.ID})
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) UpdateContentSchedule(info *ContentInfo) error {
+	_, err := cdb.db.Exec("update content set publish_at=FROM_UNIXTIME(NULLIF(?,0)),expire_at=FROM_UNIXTIME(NULLIF(?,0)) where id=?", info.PublishAt, info.ExpireAt, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// positions are assigned in the order of ids, starting from 1
+func (cdb *ControllerDB) UpdateContentPositions(groupID int64, ids []int64) error {
+	argsList := make([][]interface{}, 0, len(ids))
+	for i, id := range ids {
+		argsList = append(argsList, []interface{}{i + 1, id, groupID})
+	}
+	_, err := cdb.db.ExecBatch("update content set position=? where id=? and group_id=?", argsList...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) InsertServeStats(list []*ServeStatInfo) error {
+	argsList := make([][]interface{}, 0, len(list))
+	for _, v := range list {
+		argsList = append(argsList, []interface{}{v.Time, v.Kind, v.GroupID, v.DomainID, v.Count})
+	}
+	_, err := cdb.db.ExecBatch("insert into serve_stats(minute,kind,group_id,domain_id,count) values(FROM_UNIXTIME(?),?,?,?,?) on duplicate key update count=count+values(count)", argsList...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) GetServeStats(query *ServeStatQuery) ([]*ServeStatInfo, error) {
+	sqlstr := "select UNIX_TIMESTAMP(minute) div ? * ? as t,kind,group_id,domain_id,sum(count) as count from serve_stats where minute>=FROM_UNIXTIME(?) and minute<FROM_UNIXTIME(?)"
+	args := []interface{}{query.Step, query.Step, query.From, query.To}
+	if query.Kind != "" {
+		sqlstr += " and kind=?"
+		args = append(args, query.Kind)
+	}
+	if query.GroupID != 0 {
+		sqlstr += " and group_id=?"
+		args = append(args, query.GroupID)
+	}
+	// filtered before the limit, so the rows of other tenants do not crowd out those of the tenant
+	if query.TenantID != TENANT_ALL {
+		sqlstr += " and (kind=? and group_id in (select id from domain_group where tenant_id=?)" +
+			" or kind=? and group_id in (select id from content_group where tenant_id=?))"
+		args = append(args, SERVE_STAT_DOMAIN, query.TenantID, SERVE_STAT_CONTENT, query.TenantID)
+	}
+	sqlstr += " group by t,kind,group_id,domain_id order by t,kind,group_id,domain_id limit ?"
+	args = append(args, SERVE_STATS_MAX_ROWS)
+	rows, err := cdb.db.FetchRows(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ServeStatInfo, 0, len(*rows))
+	for _, v := range *rows {
+		t, _ := strconv.ParseInt(v["t"], 10, 0)
+		groupID, _ := strconv.ParseInt(v["group_id"], 10, 0)
+		domainID, _ := strconv.ParseInt(v["domain_id"], 10, 0)
+		count, _ := strconv.ParseInt(v["count"], 10, 0)
+		list = append(list, &ServeStatInfo{
+			Time:     t,
+			Kind:     v["kind"],
+			GroupID:  groupID,
+			DomainID: domainID,
+			Count:    count,
+		})
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) GetDomainFromID(info *DomainInfo) error {
+	row, err := cdb.db.FetchRow("select group_id,domain,status,IFNULL(UNIX_TIMESTAMP(registration_expires_at),0) as registration_expires_at,"+
+		"IFNULL(UNIX_TIMESTAMP(cert_expires_at),0) as cert_expires_at,time from domain where id=?", info.ID)
+	if err != nil {
+		return err
+	}
+	if len(*row) == 0 {
+		return fmt.Errorf("no this[%d] domain!", info.ID)
+	}
+	groupID, err := strconv.ParseInt((*row)["group_id"], 10, 0)
+	if err != nil {
+		return err
+	}
+	status, err := strconv.ParseInt((*row)["status"], 10, 0)
+	if err != nil {
+		return err
+	}
+	info.GroupID = groupID
+	info.Domain = (*row)["domain"]
+	info.Status = status
+	info.RegistrationExpiresAt, _ = strconv.ParseInt((*row)["registration_expires_at"], 10, 0)
+	info.CertExpiresAt, _ = strconv.ParseInt((*row)["cert_expires_at"], 10, 0)
+	info.Time = (*row)["time"]
+	return nil
+}
+
+func (cdb *ControllerDB) GetContentFromID(info *ContentInfo) error {
+	row, err := cdb.db.FetchRow("select group_id,type from content where id=?", info.ID)
+	if err != nil {
+		return err
+	}
+	if len(*row) == 0 {
+		return fmt.Errorf("no this[%d] content!", info.ID)
+	}
+	groupID, err := strconv.ParseInt((*row)["group_id"], 10, 0)
+	if err != nil {
+		return err
+	}
+	info.GroupID = groupID
+	return nil
+}
+
+// UpdateDomainGroupInfo sets the name and type of a group, and replaces its show groups by info.ShowGroups.
+func (cdb *ControllerDB) UpdateDomainGroupInfo(info *DomainGroupInfo) error {
+	sqls := []string{
+		"update domain_group set name=?,type=? where id=?",
+		"delete from domain_group_show where jump_group_id=?",
+	}
+	argsList := [][]interface{}{
+		{info.Name, info.Type, info.ID},
+		{info.ID},
+	}
+	for _, v := range info.ShowGroups {
+		sqls = append(sqls, "insert into domain_group_show(jump_group_id,show_group_id,weight) values(?,?,?)")
+		argsList = append(argsList, []interface{}{info.ID, v.ShowGroupID, v.Weight})
+	}
+	_, err := cdb.db.ExecTx(sqls, argsList...)
+	return err
+}
+
+// GetDomainGroupShows returns the show groups of a jump group, or of every jump group when jumpGroupID is 0.
+func (cdb *ControllerDB) GetDomainGroupShows(jumpGroupID int64) (map[int64][]*DomainGroupShow, error) {
+	sqlstr := "select jump_group_id,show_group_id,weight from domain_group_show"
+	var args []interface{}
+	if jumpGroupID != 0 {
+		sqlstr += " where jump_group_id=?"
+		args = append(args, jumpGroupID)
+	}
+	rows, err := cdb.db.FetchRows(sqlstr+" order by jump_group_id,show_group_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	shows := make(map[int64][]*DomainGroupShow)
+	for _, v := range *rows {
+		jumpID, err := strconv.ParseInt(v["jump_group_id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		showID, err := strconv.ParseInt(v["show_group_id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		weight, _ := strconv.ParseInt(v["weight"], 10, 0)
+		shows[jumpID] = append(shows[jumpID], &DomainGroupShow{ShowGroupID: showID, Weight: weight})
+	}
+	return shows, nil
+}
+
+// MigrateShowGroupLists moves the show_group_list column into domain_group_show, once per group.
+func (cdb *ControllerDB) MigrateShowGroupLists() (int64, error) {
+	rows, err := cdb.db.FetchRows("select id,show_group_list from domain_group where show_group_list<>''")
+	if err != nil {
+		return 0, err
+	}
+	var migrated int64
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		sqls := []string{"update domain_group set show_group_list='' where id=?"}
+		argsList := [][]interface{}{{id}}
+		for _, sv := range strings.Split(v["show_group_list"], ",") {
+			showID, err := strconv.ParseInt(strings.TrimSpace(sv), 10, 0)
+			if err != nil {
+				plog.Errorf("MigrateShowGroupLists group[%d] show_group_list[%s] strconv error: %v", id, sv, err)
+				continue
+			}
+			sqls = append(sqls, "insert ignore into domain_group_show(jump_group_id,show_group_id,weight) values(?,?,?)")
+			argsList = append(argsList, []interface{}{id, showID, SHOW_GROUP_DEFAULT_WEIGHT})
+		}
+		if _, err := cdb.db.ExecTx(sqls, argsList...); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+func (cdb *ControllerDB) UpdateDomain(info *DomainInfo) error {
+	_, err := cdb.db.Exec("update domain set domain=? where id=?", info.Domain, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) UpdateContentGroupInfo(info *ContentGroupInfo) error {
+	_, err := cdb.db.Exec("update content_group set name=?,type=? where id=?", info.Name, info.Type, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) UpdateContentValue(info *ContentInfo) error {
+	_, err := cdb.db.Exec("update content set value=? where id=?", info.Value, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// domains go first, so a failure never leaves domains without a group
+// DeleteDomainGroup removes a group with its domains and show group links, all or nothing.
+func (cdb *ControllerDB) DeleteDomainGroup(id int64) error {
+	_, err := cdb.db.ExecTx([]string{
+		"delete from domain where group_id=?",
+		"delete from domain_group_show where jump_group_id=? or show_group_id=?",
+		"delete from domain_group where id=?",
+	}, []interface{}{id}, []interface{}{id, id}, []interface{}{id})
+	return err
+}
+
+func (cdb *ControllerDB) DeleteDomain(id int64) error {
+	_, err := cdb.db.Exec("delete from domain where id=?", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteContentGroup removes a group with its contents, all or nothing.
+func (cdb *ControllerDB) DeleteContentGroup(id int64) error {
+	_, err := cdb.db.ExecTx([]string{
+		"delete from content where group_id=?",
+		"delete from content_group where id=?",
+	}, []interface{}{id}, []interface{}{id})
+	return err
+}
+
+func (cdb *ControllerDB) DeleteContent(id int64) error {
+	_, err := cdb.db.Exec("delete from content where id=?", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) InsertDomainHealth(info *DomainHealthInfo) error {
+	id, err := cdb.db.Insert("insert into domain_health_log(group_id,domain_id,domain,result,message) values(?,?,?,?,?)",
+		info.GroupID, info.DomainID, info.Domain, info.Result, info.Message)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+// GetDomainHealthList returns the latest checks first, of a domain when domainID is set, else of a group.
+func (cdb *ControllerDB) GetDomainHealthList(groupID, domainID, limit int64) ([]*DomainHealthInfo, error) {
+	sqlstr := "select id,group_id,domain_id,domain,result,message,time from domain_health_log"
+	var args []interface{}
+	if domainID != 0 {
+		sqlstr += " where domain_id=?"
+		args = append(args, domainID)
+	} else if groupID != 0 {
+		sqlstr += " where group_id=?"
+		args = append(args, groupID)
+	}
+	sqlstr += " order by id desc limit ?"
+	args = append(args, limit)
+	rows, err := cdb.db.FetchRows(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*DomainHealthInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		gID, _ := strconv.ParseInt(v["group_id"], 10, 0)
+		dID, _ := strconv.ParseInt(v["domain_id"], 10, 0)
+		list = append(list, &DomainHealthInfo{
+			ID:       id,
+			GroupID:  gID,
+			DomainID: dID,
+			Domain:   v["domain"],
+			Result:   v["result"],
+			Message:  v["message"],
+			Time:     v["time"],
+		})
+	}
+	return list, nil
+}
+
+// GetDomainsByName returns the rows of every domain in names, in any group.
+func (cdb *ControllerDB) GetDomainsByName(names []string) ([]*DomainInfo, error) {
+	list := make([]*DomainInfo, 0)
+	for start := 0; start < len(names); start += DOMAIN_QUERY_BATCH {
+		end := start + DOMAIN_QUERY_BATCH
+		if end > len(names) {
+			end = len(names)
+		}
+		args := make([]interface{}, 0, end-start)
+		for _, v := range names[start:end] {
+			args = append(args, v)
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+		rows, err := cdb.db.FetchRows("select id,group_id,domain,status,time from domain where domain in ("+marks+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range *rows {
+			id, err := strconv.ParseInt(v["id"], 10, 0)
+			if err != nil {
+				continue
+			}
+			groupID, err := strconv.ParseInt(v["group_id"], 10, 0)
+			if err != nil {
+				continue
+			}
+			status, _ := strconv.ParseInt(v["status"], 10, 0)
+			list = append(list, &DomainInfo{
+				ID:      id,
+				GroupID: groupID,
+				Domain:  v["domain"],
+				Status:  status,
+				Time:    v["time"],
+			})
+		}
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) UpdateDomainRegistrationExpiry(info *DomainInfo) error {
+	_, err := cdb.db.Exec("update domain set registration_expires_at=FROM_UNIXTIME(NULLIF(?,0)) where id=?", info.RegistrationExpiresAt, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateCertExpiry sets the cert expiry of every row of a domain, it returns the rows changed.
+func (cdb *ControllerDB) UpdateCertExpiry(domain string, certExpiresAt int64) (int64, error) {
+	return cdb.db.Exec("update domain set cert_expires_at=FROM_UNIXTIME(NULLIF(?,0)) where domain=? and (cert_expires_at is null or cert_expires_at<>FROM_UNIXTIME(NULLIF(?,0)))",
+		certExpiresAt, domain, certExpiresAt)
+}
+
+// GetExpiringDomains returns the domains whose registration or cert expires before before, expired ones included,
+// of a group when groupID is set, the earliest first.
+func (cdb *ControllerDB) GetExpiringDomains(before, groupID int64) ([]*DomainInfo, error) {
+	sqlstr := "select id,group_id,domain,status,IFNULL(UNIX_TIMESTAMP(registration_expires_at),0) as registration_expires_at," +
+		"IFNULL(UNIX_TIMESTAMP(cert_expires_at),0) as cert_expires_at,time from domain " +
+		"where (registration_expires_at<FROM_UNIXTIME(?) or cert_expires_at<FROM_UNIXTIME(?))"
+	args := []interface{}{before, before}
+	if groupID != 0 {
+		sqlstr += " and group_id=?"
+		args = append(args, groupID)
+	}
+	sqlstr += " order by LEAST(IFNULL(registration_expires_at,cert_expires_at),IFNULL(cert_expires_at,registration_expires_at)),id"
+	rows, err := cdb.db.FetchRows(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*DomainInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		gID, _ := strconv.ParseInt(v["group_id"], 10, 0)
+		status, _ := strconv.ParseInt(v["status"], 10, 0)
+		registrationExpiresAt, _ := strconv.ParseInt(v["registration_expires_at"], 10, 0)
+		certExpiresAt, _ := strconv.ParseInt(v["cert_expires_at"], 10, 0)
+		list = append(list, &DomainInfo{
+			ID:                    id,
+			GroupID:               gID,
+			Domain:                v["domain"],
+			Status:                status,
+			RegistrationExpiresAt: registrationExpiresAt,
+			CertExpiresAt:         certExpiresAt,
+			Time:                  v["time"],
+		})
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) InsertTenant(info *TenantInfo) error {
+	id, err := cdb.db.Insert("insert into tenant(name,max_domain_groups,max_content_groups,max_domains) values(?,?,?,?)",
+		info.Name, info.MaxDomainGroups, info.MaxContentGroups, info.MaxDomains)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+func (cdb *ControllerDB) UpdateTenant(info *TenantInfo) error {
+	_, err := cdb.db.Exec("update tenant set name=?,max_domain_groups=?,max_content_groups=?,max_domains=? where id=?",
+		info.Name, info.MaxDomainGroups, info.MaxContentGroups, info.MaxDomains, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteTenant removes a tenant and its api keys, the groups of the tenant must be moved or deleted first.
+func (cdb *ControllerDB) DeleteTenant(id int64) error {
+	_, err := cdb.db.ExecTx([]string{
+		"delete from api_key where tenant_id=?",
+		"delete from tenant where id=?",
+	}, []interface{}{id}, []interface{}{id})
+	return err
+}
+
+func (cdb *ControllerDB) GetTenantFromID(info *TenantInfo) error {
+	list, err := cdb.getTenants("select id,name,max_domain_groups,max_content_groups,max_domains,time from tenant where id=?", info.ID)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("no this[%d] tenant!", info.ID)
+	}
+	*info = *list[0]
+	return nil
+}
+
+func (cdb *ControllerDB) GetTenantList() ([]*TenantInfo, error) {
+	return cdb.getTenants("select id,name,max_domain_groups,max_content_groups,max_domains,time from tenant order by id")
+}
+
+func (cdb *ControllerDB) getTenants(sqlstr string, args ...interface{}) ([]*TenantInfo, error) {
+	rows, err := cdb.db.FetchRows(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*TenantInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		maxDomainGroups, _ := strconv.ParseInt(v["max_domain_groups"], 10, 0)
+		maxContentGroups, _ := strconv.ParseInt(v["max_content_groups"], 10, 0)
+		maxDomains, _ := strconv.ParseInt(v["max_domains"], 10, 0)
+		list = append(list, &TenantInfo{
+			ID:               id,
+			Name:             v["name"],
+			MaxDomainGroups:  maxDomainGroups,
+			MaxContentGroups: maxContentGroups,
+			MaxDomains:       maxDomains,
+			Time:             v["time"],
+		})
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) GetTenantUsage(tenantID int64) (*TenantUsage, error) {
+	row, err := cdb.db.FetchRow("select (select count(*) from domain_group where tenant_id=?) as domain_groups,"+
+		"(select count(*) from content_group where tenant_id=?) as content_groups,"+
+		"(select count(*) from domain d join domain_group g on g.id=d.group_id where g.tenant_id=?) as domains",
+		tenantID, tenantID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	usage := &TenantUsage{}
+	if usage.DomainGroups, err = strconv.ParseInt((*row)["domain_groups"], 10, 0); err != nil {
+		return nil, err
+	}
+	if usage.ContentGroups, err = strconv.ParseInt((*row)["content_groups"], 10, 0); err != nil {
+		return nil, err
+	}
+	if usage.Domains, err = strconv.ParseInt((*row)["domains"], 10, 0); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (cdb *ControllerDB) GetDomainGroupTenant(groupID int64) (int64, error) {
+	row, err := cdb.db.FetchRow("select tenant_id from domain_group where id=?", groupID)
+	if err != nil {
+		return 0, err
+	}
+	if len(*row) == 0 {
+		return 0, fmt.Errorf("no this[%d] domain group!", groupID)
+	}
+	return strconv.ParseInt((*row)["tenant_id"], 10, 0)
+}
+
+func (cdb *ControllerDB) GetContentGroupTenant(groupID int64) (int64, error) {
+	row, err := cdb.db.FetchRow("select tenant_id from content_group where id=?", groupID)
+	if err != nil {
+		return 0, err
+	}
+	if len(*row) == 0 {
+		return 0, fmt.Errorf("no this[%d] content group!", groupID)
+	}
+	return strconv.ParseInt((*row)["tenant_id"], 10, 0)
+}
+
+func (cdb *ControllerDB) UpdateDomainGroupTenant(groupID, tenantID int64) error {
+	_, err := cdb.db.Exec("update domain_group set tenant_id=? where id=?", tenantID, groupID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) UpdateContentGroupTenant(groupID, tenantID int64) error {
+	_, err := cdb.db.Exec("update content_group set tenant_id=? where id=?", tenantID, groupID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) InsertApiKey(info *ApiKeyInfo) error {
+	id, err := cdb.db.Insert("insert into api_key(tenant_id,name,key_hash) values(?,?,?)", info.TenantID, info.Name, info.KeyHash)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+func (cdb *ControllerDB) DeleteApiKey(id int64) error {
+	_, err := cdb.db.Exec("delete from api_key where id=?", id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetApiKeyList returns the keys of a tenant, or every key when tenantID is TENANT_ALL.
+func (cdb *ControllerDB) GetApiKeyList(tenantID int64) ([]*ApiKeyInfo, error) {
+	sqlstr := "select id,tenant_id,name,key_hash,time from api_key"
+	var args []interface{}
+	if tenantID != TENANT_ALL {
+		sqlstr += " where tenant_id=?"
+		args = append(args, tenantID)
+	}
+	rows, err := cdb.db.FetchRows(sqlstr+" order by id", args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ApiKeyInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		tID, _ := strconv.ParseInt(v["tenant_id"], 10, 0)
+		list = append(list, &ApiKeyInfo{
+			ID:       id,
+			TenantID: tID,
+			Name:     v["name"],
+			KeyHash:  v["key_hash"],
+			Time:     v["time"],
+		})
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) InsertWebhook(info *WebhookInfo) error {
+	id, err := cdb.db.Insert("insert into webhook(tenant_id,url,secret,event_types,enabled) values(?,?,?,?,?)",
+		info.TenantID, info.Url, info.Secret, strings.Join(info.EventTypes, ","), info.Enabled)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+// UpdateWebhook sets the url, event types and enabled of a webhook, and its secret when one is given.
+func (cdb *ControllerDB) UpdateWebhook(info *WebhookInfo) error {
+	sqlstr := "update webhook set url=?,event_types=?,enabled=?"
+	args := []interface{}{info.Url, strings.Join(info.EventTypes, ","), info.Enabled}
+	if info.Secret != "" {
+		sqlstr += ",secret=?"
+		args = append(args, info.Secret)
+	}
+	_, err := cdb.db.Exec(sqlstr+" where id=?", append(args, info.ID)...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook with its deliveries.
+func (cdb *ControllerDB) DeleteWebhook(id int64) error {
+	if _, err := cdb.db.Exec("delete from webhook_delivery where webhook_id=?", id); err != nil {
+		return err
+	}
+	if _, err := cdb.db.Exec("delete from webhook where id=?", id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWebhookList returns the webhooks of a tenant, or every webhook when tenantID is TENANT_ALL.
+// Secrets are set, callers showing the list clear them.
+func (cdb *ControllerDB) GetWebhookList(tenantID int64) ([]*WebhookInfo, error) {
+	sqlstr := "select id,tenant_id,url,secret,event_types,enabled,time from webhook"
+	var args []interface{}
+	if tenantID != TENANT_ALL {
+		sqlstr += " where tenant_id=?"
+		args = append(args, tenantID)
+	}
+	rows, err := cdb.db.FetchRows(sqlstr+" order by id", args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*WebhookInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		tID, _ := strconv.ParseInt(v["tenant_id"], 10, 0)
+		list = append(list, &WebhookInfo{
+			ID:         id,
+			TenantID:   tID,
+			Url:        v["url"],
+			Secret:     v["secret"],
+			EventTypes: splitContentFormats(v["event_types"]),
+			Enabled:    v["enabled"] == "1",
+			Time:       v["time"],
+		})
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) InsertWebhookDelivery(info *WebhookDelivery) error {
+	id, err := cdb.db.Insert("insert into webhook_delivery(webhook_id,event_id,event_type,payload,status,next_attempt_at) values(?,?,?,?,?,FROM_UNIXTIME(?))",
+		info.WebhookID, info.EventID, info.EventType, info.Payload, info.Status, info.NextAttemptAt)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+const webhookDeliveryColumns = "d.id,d.webhook_id,d.event_id,d.event_type,d.payload,d.status,d.attempts," +
+	"IFNULL(UNIX_TIMESTAMP(d.next_attempt_at),0) as next_attempt_at,d.response_code,d.last_error," +
+	"IFNULL(UNIX_TIMESTAMP(d.delivered_at),0) as delivered_at,d.time,w.url,w.secret,w.tenant_id"
+
+// GetDueWebhookDeliveries returns the pending deliveries of enabled webhooks due at now, the oldest first.
+func (cdb *ControllerDB) GetDueWebhookDeliveries(now, limit int64) ([]*WebhookDelivery, error) {
+	return cdb.getWebhookDeliveries("select "+webhookDeliveryColumns+" from webhook_delivery d join webhook w on w.id=d.webhook_id"+
+		" where d.status=? and d.next_attempt_at<=FROM_UNIXTIME(?) and w.enabled=1 order by d.id limit ?",
+		WEBHOOK_DELIVERY_PENDING, now, limit)
+}
+
+// GetWebhookDeliveryList returns the latest deliveries of a webhook first, of any status when status is -1.
+func (cdb *ControllerDB) GetWebhookDeliveryList(webhookID, status, limit int64) ([]*WebhookDelivery, error) {
+	sqlstr := "select " + webhookDeliveryColumns + " from webhook_delivery d join webhook w on w.id=d.webhook_id where d.webhook_id=?"
+	args := []interface{}{webhookID}
+	if status >= 0 {
+		sqlstr += " and d.status=?"
+		args = append(args, status)
+	}
+	return cdb.getWebhookDeliveries(sqlstr+" order by d.id desc limit ?", append(args, limit)...)
+}
+
+func (cdb *ControllerDB) GetWebhookDeliveryFromID(info *WebhookDelivery) error {
+	list, err := cdb.getWebhookDeliveries("select "+webhookDeliveryColumns+" from webhook_delivery d join webhook w on w.id=d.webhook_id where d.id=?", info.ID)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("no this[%d] webhook delivery!", info.ID)
+	}
+	*info = *list[0]
+	return nil
+}
+
+func (cdb *ControllerDB) getWebhookDeliveries(sqlstr string, args ...interface{}) ([]*WebhookDelivery, error) {
+	rows, err := cdb.db.FetchRows(sqlstr, args...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*WebhookDelivery, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		webhookID, _ := strconv.ParseInt(v["webhook_id"], 10, 0)
+		eventID, _ := strconv.ParseInt(v["event_id"], 10, 0)
+		status, _ := strconv.ParseInt(v["status"], 10, 0)
+		attempts, _ := strconv.ParseInt(v["attempts"], 10, 0)
+		nextAttemptAt, _ := strconv.ParseInt(v["next_attempt_at"], 10, 0)
+		responseCode, _ := strconv.ParseInt(v["response_code"], 10, 0)
+		deliveredAt, _ := strconv.ParseInt(v["delivered_at"], 10, 0)
+		tenantID, _ := strconv.ParseInt(v["tenant_id"], 10, 0)
+		list = append(list, &WebhookDelivery{
+			ID:            id,
+			WebhookID:     webhookID,
+			EventID:       eventID,
+			EventType:     v["event_type"],
+			Payload:       v["payload"],
+			Status:        status,
+			Attempts:      attempts,
+			NextAttemptAt: nextAttemptAt,
+			ResponseCode:  responseCode,
+			LastError:     v["last_error"],
+			DeliveredAt:   deliveredAt,
+			Time:          v["time"],
+			Url:           v["url"],
+			Secret:        v["secret"],
+			TenantID:      tenantID,
+		})
+	}
+	return list, nil
+}
+
+// ClaimWebhookDelivery moves a pending delivery due at now to leaseUntil, false when another controller took it.
+func (cdb *ControllerDB) ClaimWebhookDelivery(id, now, leaseUntil int64) (bool, error) {
+	n, err := cdb.db.Exec("update webhook_delivery set next_attempt_at=FROM_UNIXTIME(?) where id=? and status=? and next_attempt_at<=FROM_UNIXTIME(?)",
+		leaseUntil, id, WEBHOOK_DELIVERY_PENDING, now)
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// UpdateWebhookDeliveryResult records an attempt of a delivery.
+func (cdb *ControllerDB) UpdateWebhookDeliveryResult(info *WebhookDelivery) error {
+	_, err := cdb.db.Exec("update webhook_delivery set status=?,attempts=?,next_attempt_at=FROM_UNIXTIME(NULLIF(?,0)),response_code=?,last_error=?,"+
+		"delivered_at=FROM_UNIXTIME(NULLIF(?,0)) where id=?",
+		info.Status, info.Attempts, info.NextAttemptAt, info.ResponseCode, info.LastError, info.DeliveredAt, info.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cdb *ControllerDB) InsertPublishLog(info *PublishLogInfo) error {
+	id, err := cdb.db.Insert("insert into content_publish_log(group_id,success,json_url,error) values(?,?,?,?)",
+		info.GroupID, info.Success, info.JsonUrl, info.Error)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+// GetPublishLogList returns the latest publishes of a group first.
+func (cdb *ControllerDB) GetPublishLogList(groupID, limit int64) ([]*PublishLogInfo, error) {
+	rows, err := cdb.db.FetchRows("select id,group_id,success,json_url,error,time from content_publish_log where group_id=? order by id desc limit ?", groupID, limit)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*PublishLogInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		gID, _ := strconv.ParseInt(v["group_id"], 10, 0)
+		list = append(list, &PublishLogInfo{
+			ID:      id,
+			GroupID: gID,
+			Success: v["success"] == "1",
+			JsonUrl: v["json_url"],
+			Error:   v["error"],
+			Time:    v["time"],
+		})
+	}
+	return list, nil
+}
+
+func (cdb *ControllerDB) InsertAuditLog(info *AuditLogInfo) error {
+	id, err := cdb.db.Insert("insert into audit_log(tenant_id,api_key_id,actor,action,request_id,ip,code,message,body) values(?,?,?,?,?,?,?,?,?)",
+		info.TenantID, info.ApiKeyID, info.Actor, info.Action, info.RequestID, info.IP, info.Code, info.Message, info.Body)
+	if err != nil {
+		return err
+	}
+	info.ID = id
+	return nil
+}
+
+// GetAuditLogList returns the latest changes first, of a tenant unless query.TenantID is TENANT_ALL.
+func (cdb *ControllerDB) GetAuditLogList(query *AuditLogQuery) ([]*AuditLogInfo, error) {
+	sqlstr := "select id,tenant_id,api_key_id,actor,action,request_id,ip,code,message,body,time from audit_log where 1=1"
+	var args []interface{}
+	if query.TenantID != TENANT_ALL {
+		sqlstr += " and tenant_id=?"
+		args = append(args, query.TenantID)
+	}
+	if query.Action != "" {
+		sqlstr += " and action=?"
+		args = append(args, query.Action)
+	}
+	if query.BeforeID != 0 {
+		sqlstr += " and id<?"
+		args = append(args, query.BeforeID)
+	}
+	rows, err := cdb.db.FetchRows(sqlstr+" order by id desc limit ?", append(args, query.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*AuditLogInfo, 0, len(*rows))
+	for _, v := range *rows {
+		id, err := strconv.ParseInt(v["id"], 10, 0)
+		if err != nil {
+			continue
+		}
+		tID, _ := strconv.ParseInt(v["tenant_id"], 10, 0)
+		keyID, _ := strconv.ParseInt(v["api_key_id"], 10, 0)
+		code, _ := strconv.ParseInt(v["code"], 10, 0)
+		list = append(list, &AuditLogInfo{
+			ID:        id,
+			TenantID:  tID,
+			ApiKeyID:  keyID,
+			Actor:     v["actor"],
+			Action:    v["action"],
+			RequestID: v["request_id"],
+			IP:        v["ip"],
+			Code:      code,
+			Message:   v["message"],
+			Body:      v["body"],
+			Time:      v["time"],
+		})
+	}
+	return list, nil
+}
+
+func splitContentFormats(s string) []string {
+	var formats []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			formats = append(formats, v)
+		}
+	}
+	return formats
+}
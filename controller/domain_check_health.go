@@ -6,7 +6,6 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"github.com/reechou/x-real-control/config"
 	"github.com/reechou/x-real-control/utils"
 )
 
@@ -20,27 +19,27 @@ type DomainCheckHealth struct {
 	groupInfo  *DomainGroupInfo
 	updateTime int64
 
-	cfg         *config.Config
 	checkUrlIdx int
 
 	cdb   *ControllerDB
-	w     *utils.TimingWheel
+	task  *utils.Task
 	logic *ControllerLogic
 
 	client *http.Client
+	log    *utils.Logger
 
 	stop chan struct{}
 	done chan struct{}
 }
 
-func NewDomainCheckHealth(groupInfo *DomainGroupInfo, cdb *ControllerDB, w *utils.TimingWheel, logic *ControllerLogic, cfg *config.Config) *DomainCheckHealth {
+func NewDomainCheckHealth(groupInfo *DomainGroupInfo, cdb *ControllerDB, task *utils.Task, logic *ControllerLogic) *DomainCheckHealth {
 	dch := &DomainCheckHealth{
 		groupInfo: groupInfo,
-		cfg:       cfg,
 		cdb:       cdb,
-		w:         w,
+		task:      task,
 		logic:     logic,
 		client:    &http.Client{},
+		log:       logger.With(utils.LOG_GROUP_ID, groupInfo.ID),
 		stop:      make(chan struct{}),
 		done:      make(chan struct{}),
 	}
@@ -50,15 +49,16 @@ func NewDomainCheckHealth(groupInfo *DomainGroupInfo, cdb *ControllerDB, w *util
 }
 
 func (dch *DomainCheckHealth) Stop() {
+	dch.task.Cancel()
 	close(dch.stop)
 	<-dch.done
 }
 
 func (dch *DomainCheckHealth) run() {
-	plog.Infof("domain group[%s][%d] start run.\n", dch.groupInfo.Name, dch.groupInfo.ID)
+	dch.log.Infof("domain group[%s] start run.\n", dch.groupInfo.Name)
 	for {
 		select {
-		case <-dch.w.Check(dch.groupInfo.ID):
+		case <-dch.task.C():
 			dch.onCheck()
 		case <-dch.stop:
 			close(dch.done)
@@ -69,13 +69,15 @@ func (dch *DomainCheckHealth) run() {
 
 func (dch *DomainCheckHealth) onCheck() {
 	// get group
+	groupType := dch.groupInfo.Type
 	err := dch.cdb.GetDomainGroupFromID(dch.groupInfo)
 	if err != nil {
-		plog.Errorf("oncheck group[%d] get domain group error: %v\n", dch.groupInfo.ID, err)
+		dch.log.Errorf("oncheck get domain group error: %v\n", err)
 		return
 	}
+	dch.task.SetInterval(dch.logic.checkInterval(dch.groupInfo.CheckInterval))
 	if dch.groupInfo.Status != DOMAIN_STATUS_OK {
-		plog.Infof("domain group[%s][%d] is setted offline.\n", dch.groupInfo.Name, dch.groupInfo.ID)
+		dch.log.Infof("domain group[%s] is setted offline.\n", dch.groupInfo.Name)
 		return
 	}
 	//plog.Debugf("on check get group: %v\n", dch.groupInfo)
@@ -86,9 +88,10 @@ func (dch *DomainCheckHealth) onCheck() {
 	}
 	err = dch.cdb.GetDomainList(list)
 	if err != nil {
-		plog.Errorf("oncheck group[%d] get domain list error: %v\n", dch.groupInfo.ID, err)
+		dch.log.Errorf("oncheck get domain list error: %v\n", err)
 		return
 	}
+	logExpired(dch.log, list, dch.logic.clock.Now().Unix())
 
 	// check
 	checkUpdate := false
@@ -101,17 +104,23 @@ func (dch *DomainCheckHealth) onCheck() {
 			if v.Status != DOMAIN_STATUS_DOWN {
 				v.Status = DOMAIN_STATUS_DOWN
 				dch.cdb.UpdateDomainStatus(v)
+				dch.recordHealth(v, DOMAIN_HEALTH_RESULT_DOWN, "")
+				dch.logic.DomainStatusEvent(v, dch.groupInfo.TenantID, EVENT_SOURCE_CHECK)
 				checkUpdate = true
 			}
 		}
 	}
 
 	// update
-	if checkUpdate || (list.UpdateTime > dch.updateTime) {
+	if checkUpdate || (list.UpdateTime > dch.updateTime) || dch.groupInfo.Type != groupType {
 		dch.logic.UpdateDomainGroup(dch.groupInfo, list)
 	}
 }
 
+const (
+	DOMAIN_HEALTH_MESSAGE_MAX = 1024
+)
+
 const (
 	DOMAIN_CHECK_OK          = "[0]"
 	DOMAIN_CHECK_GRAY        = "[1]"
@@ -120,14 +129,19 @@ const (
 )
 
 func (dch *DomainCheckHealth) checkHealthV2(info *DomainInfo) bool {
-	if len(dch.cfg.CheckDomainUrls) == 0 {
+	checkDomainUrls := dch.logic.Config().CheckDomainUrls
+	if len(checkDomainUrls) == 0 {
 		return true
 	}
-	url := "http://" + dch.cfg.CheckDomainUrls[dch.checkUrlIdx] + "/mt.do?url=" + info.Domain
-	dch.checkUrlIdx = (dch.checkUrlIdx + 1) % len(dch.cfg.CheckDomainUrls)
+	// the list may have shrunk on config reload
+	dch.checkUrlIdx = dch.checkUrlIdx % len(checkDomainUrls)
+	log := dch.log.With(utils.LOG_DOMAIN_ID, info.ID)
+	url := "http://" + checkDomainUrls[dch.checkUrlIdx] + "/mt.do?url=" + info.Domain
+	dch.checkUrlIdx = (dch.checkUrlIdx + 1) % len(checkDomainUrls)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		dch.recordHealth(info, DOMAIN_HEALTH_RESULT_ERROR, err.Error())
 		return false
 	}
 
@@ -138,12 +152,14 @@ func (dch *DomainCheckHealth) checkHealthV2(info *DomainInfo) bool {
 		}
 	}()
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		dch.recordHealth(info, DOMAIN_HEALTH_RESULT_ERROR, err.Error())
 		return false
 	}
 	rspBody, err := ioutil.ReadAll(rsp.Body)
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		dch.recordHealth(info, DOMAIN_HEALTH_RESULT_ERROR, err.Error())
 		return false
 	}
 	rspBody = bytes.Replace(rspBody, []byte(" "), []byte(""), -1)
@@ -153,13 +169,48 @@ func (dch *DomainCheckHealth) checkHealthV2(info *DomainInfo) bool {
 	case DOMAIN_CHECK_OK:
 		return true
 	}
-	plog.Errorf("domain[%s] check health error, check result: %s\n", url, result)
+	log.Errorf("domain[%s] check health error, check result: %s\n", url, result)
+	dch.recordHealth(info, domainHealthResult(result), result)
 	if result == DOMAIN_CHECK_GRAY || result == DOMAIN_CHECK_BLACK {
 		return false
 	}
 	return true
 }
 
+func domainHealthResult(result string) string {
+	switch result {
+	case DOMAIN_CHECK_GRAY:
+		return DOMAIN_HEALTH_RESULT_GRAY
+	case DOMAIN_CHECK_BLACK:
+		return DOMAIN_HEALTH_RESULT_BLACK
+	case DOMAIN_CHECK_QUERY_ERROR:
+		return DOMAIN_HEALTH_RESULT_QUERY_ERROR
+	}
+	return DOMAIN_HEALTH_RESULT_UNKNOWN
+}
+
+// recordHealth keeps failed checks in domain_health_log for the health history.
+func (dch *DomainCheckHealth) recordHealth(info *DomainInfo, result, message string) {
+	if len(message) > DOMAIN_HEALTH_MESSAGE_MAX {
+		message = message[:DOMAIN_HEALTH_MESSAGE_MAX]
+	}
+	health := &DomainHealthInfo{
+		GroupID:  dch.groupInfo.ID,
+		DomainID: info.ID,
+		Domain:   info.Domain,
+		Result:   result,
+		Message:  message,
+	}
+	err := dch.cdb.InsertDomainHealth(health)
+	if err != nil {
+		dch.log.With(utils.LOG_DOMAIN_ID, info.ID).Errorf("record health error: %v\n", err)
+	}
+	// taking the domain down has its own domain_status event
+	if result != DOMAIN_HEALTH_RESULT_DOWN {
+		dch.logic.publish(EVENT_HEALTH_FAILED, dch.groupInfo.TenantID, health)
+	}
+}
+
 type DomainHealthResponse struct {
 	Status  int    `json:"status"`
 	Msg     string `json:"msg"`
@@ -174,10 +225,11 @@ const (
 func (dch *DomainCheckHealth) checkHealth(info *DomainInfo) bool {
 	return true
 
+	log := dch.log.With(utils.LOG_DOMAIN_ID, info.ID)
 	url := "http://app.nf6688.com/___check___/" + info.Domain
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
 		return false
 	}
 
@@ -188,23 +240,23 @@ func (dch *DomainCheckHealth) checkHealth(info *DomainInfo) bool {
 		}
 	}()
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
 		return false
 	}
 	rspBody, err := ioutil.ReadAll(rsp.Body)
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
 		return false
 	}
 
 	var response DomainHealthResponse
 	err = json.Unmarshal(rspBody, &response)
 	if err != nil {
-		plog.Errorf("check health[%s] error: %v\n", info.Domain, err)
+		log.Errorf("check health[%s] error: %v\n", info.Domain, err)
 		return false
 	}
 	if response.Status == DOMAIN_HEALTH_NOT_OK {
-		plog.Infof("group[%s][%d] domain[%s] check unhealth.\n", dch.groupInfo.Name, dch.groupInfo.ID, info.Domain)
+		log.Infof("group[%s] domain[%s] check unhealth.\n", dch.groupInfo.Name, info.Domain)
 		return false
 	}
 	return true
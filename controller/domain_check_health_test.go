@@ -1,13 +1,61 @@
 package controller
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/reechou/x-real-control/config"
 )
 
+// failed checks write domain_health_log, they are covered by the integration tests.
 func TestCheckHealth(t *testing.T) {
-	//dch := NewDomainCheckHealth()
-	//result := dch.checkHealth(&DomainInfo{
-	//	Domain: "http://18750504314and2.applinzi.com",
-	//})
-	//fmt.Println(result)
+	var urls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		urls = append(urls, req.URL.String())
+		fmt.Fprint(rsp, " [0]\n")
+	}))
+	defer ts.Close()
+
+	cl := &ControllerLogic{cfg: &config.Config{}}
+	dch := &DomainCheckHealth{
+		groupInfo: &DomainGroupInfo{ID: 1},
+		logic:     cl,
+		client:    &http.Client{},
+		log:       logger,
+	}
+	domain := &DomainInfo{ID: 10, GroupID: 1, Domain: "a.example.com"}
+	if !dch.checkHealthV2(domain) || len(urls) != 0 {
+		t.Errorf("without check urls every domain is ok, got %v", urls)
+	}
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	cl.cfg.CheckDomainUrls = []string{host, host}
+	for i := 0; i < 3; i++ {
+		if !dch.checkHealthV2(domain) {
+			t.Errorf("check %d: [0] is not ok", i)
+		}
+	}
+	if len(urls) != 3 || urls[0] != "/mt.do?url=a.example.com" {
+		t.Errorf("got %v", urls)
+	}
+	if dch.checkUrlIdx != 1 {
+		t.Errorf("check urls are not taken in turn, idx %d", dch.checkUrlIdx)
+	}
+}
+
+func TestDomainHealthResult(t *testing.T) {
+	cases := map[string]string{
+		DOMAIN_CHECK_GRAY:        DOMAIN_HEALTH_RESULT_GRAY,
+		DOMAIN_CHECK_BLACK:       DOMAIN_HEALTH_RESULT_BLACK,
+		DOMAIN_CHECK_QUERY_ERROR: DOMAIN_HEALTH_RESULT_QUERY_ERROR,
+		"<html>":                 DOMAIN_HEALTH_RESULT_UNKNOWN,
+	}
+	for in, want := range cases {
+		if got := domainHealthResult(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
 }
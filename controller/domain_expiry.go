@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	CERT_PROBE_DEFAULT_INTERVAL = 6 * time.Hour
+	CERT_PROBE_TIMEOUT          = 10 * time.Second
+	CERT_PROBE_WORKERS          = 8
+	CERT_PROBE_PORT             = "443"
+
+	DAY_SECONDS = 24 * 60 * 60
+)
+
+// CertProbe returns the expiry in unix seconds of the certificate served for domain.
+type CertProbe func(domain string) (int64, error)
+
+// ProbeCert reads the leaf certificate served on port 443, or on the port of the domain.
+// The chain is not verified, an expired or mismatched certificate must still be read.
+func ProbeCert(domain string) (int64, error) {
+	host, port := domain, CERT_PROBE_PORT
+	if h, p, err := net.SplitHostPort(domain); err == nil {
+		host, port = h, p
+	}
+	dialer := &net.Dialer{Timeout: CERT_PROBE_TIMEOUT}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return 0, fmt.Errorf("no certificate served")
+	}
+	return certs[0].NotAfter.Unix(), nil
+}
+
+func (cl *ControllerLogic) certProbeInterval() time.Duration {
+	if interval := cl.Config().CertProbeInterval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return CERT_PROBE_DEFAULT_INTERVAL
+}
+
+// ProbeCerts fills the cert expiry of every domain, and reloads the groups whose domains changed.
+// A domain whose probe fails keeps its last expiry.
+func (cl *ControllerLogic) ProbeCerts() error {
+	if !atomic.CompareAndSwapInt32(&cl.probingCerts, 0, 1) {
+		return fmt.Errorf("cert probe is running")
+	}
+	defer atomic.StoreInt32(&cl.probingCerts, 0)
+
+	groupsOf := make(map[string][]int64)
+	query := &DomainQuery{TenantID: TENANT_ALL, Status: -1, Type: -1, Limit: DOMAIN_LIST_MAX_LIMIT}
+	for {
+		list, _, err := cl.cdb.GetDomains(query)
+		if err != nil {
+			logger.Errorf("cert probe get domains error: %v\n", err)
+			return err
+		}
+		for _, v := range list {
+			groupsOf[v.Domain] = append(groupsOf[v.Domain], v.GroupID)
+		}
+		if int64(len(list)) < query.Limit {
+			break
+		}
+		query.Offset += query.Limit
+	}
+
+	domainC := make(chan string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	touched := make(map[int64]bool)
+	var failed int64
+	for i := 0; i < CERT_PROBE_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range domainC {
+				expiresAt, err := cl.certProbe(domain)
+				if err != nil {
+					atomic.AddInt64(&failed, 1)
+					logger.Debugf("cert probe[%s] error: %v\n", domain, err)
+					continue
+				}
+				n, err := cl.cdb.UpdateCertExpiry(domain, expiresAt)
+				if err != nil {
+					logger.Errorf("cert probe[%s] update error: %v\n", domain, err)
+					continue
+				}
+				if n == 0 {
+					continue
+				}
+				mutex.Lock()
+				for _, id := range groupsOf[domain] {
+					touched[id] = true
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for domain := range groupsOf {
+		domainC <- domain
+	}
+	close(domainC)
+	wg.Wait()
+
+	for id := range touched {
+		cl.RunCheckNow(CHECK_TYPE_DOMAIN, id)
+	}
+	logger.Infof("cert probe of %d domains done, %d failed, %d groups changed.\n", len(groupsOf), failed, len(touched))
+	return nil
+}
+
+// ExpiringDomains lists the domains of a tenant expiring within days, and those already expired.
+func (cl *ControllerLogic) ExpiringDomains(days, groupID, tenantID int64) ([]*DomainExpiryInfo, error) {
+	now := cl.clock.Now().Unix()
+	list, err := cl.cdb.GetExpiringDomains(now+days*DAY_SECONDS, groupID)
+	if err != nil {
+		return nil, err
+	}
+	var groups map[int64]bool
+	if tenantID != TENANT_ALL {
+		if groups, _, err = cl.tenantGroups(tenantID); err != nil {
+			return nil, err
+		}
+	}
+	result := make([]*DomainExpiryInfo, 0, len(list))
+	for _, v := range list {
+		if groups != nil && !groups[v.GroupID] {
+			continue
+		}
+		result = append(result, NewDomainExpiryInfo(v, now))
+	}
+	return result, nil
+}
+
+func NewDomainExpiryInfo(info *DomainInfo, now int64) *DomainExpiryInfo {
+	expiresAt := info.RegistrationExpiresAt
+	if expiresAt == 0 || (info.CertExpiresAt != 0 && info.CertExpiresAt < expiresAt) {
+		expiresAt = info.CertExpiresAt
+	}
+	daysLeft := (expiresAt - now) / DAY_SECONDS
+	if expiresAt < now && (expiresAt-now)%DAY_SECONDS != 0 {
+		// a domain expired for half a day has -1 days left, not 0
+		daysLeft--
+	}
+	return &DomainExpiryInfo{
+		ID:                    info.ID,
+		GroupID:               info.GroupID,
+		Domain:                info.Domain,
+		Status:                info.Status,
+		RegistrationExpiresAt: info.RegistrationExpiresAt,
+		CertExpiresAt:         info.CertExpiresAt,
+		ExpiresAt:             expiresAt,
+		DaysLeft:              daysLeft,
+		Expired:               info.Expired(now),
+	}
+}
+
+// logExpired warns once a run about domains withdrawn for expiry.
+func logExpired(log *utils.Logger, list *DomainList, now int64) {
+	for _, v := range list.DomainList {
+		if v.Status == DOMAIN_STATUS_OK && v.Expired(now) {
+			log.With(utils.LOG_DOMAIN_ID, v.ID).Warningf("domain[%s] expired, not handed out.\n", v.Domain)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDomainExpired(t *testing.T) {
+	now := int64(1500000000)
+	cases := []struct {
+		info    DomainInfo
+		expired bool
+	}{
+		{DomainInfo{}, false},
+		{DomainInfo{RegistrationExpiresAt: now + 1}, false},
+		{DomainInfo{RegistrationExpiresAt: now}, true},
+		{DomainInfo{CertExpiresAt: now - 1}, true},
+		{DomainInfo{RegistrationExpiresAt: now + DAY_SECONDS, CertExpiresAt: now - 1}, true},
+	}
+	for i, c := range cases {
+		if got := c.info.Expired(now); got != c.expired {
+			t.Errorf("case %d: expired %v, want %v", i, got, c.expired)
+		}
+	}
+}
+
+func TestNewDomainExpiryInfo(t *testing.T) {
+	now := int64(1500000000)
+	info := NewDomainExpiryInfo(&DomainInfo{RegistrationExpiresAt: now + 10*DAY_SECONDS, CertExpiresAt: now + 3*DAY_SECONDS + 60}, now)
+	if info.ExpiresAt != now+3*DAY_SECONDS+60 || info.DaysLeft != 3 || info.Expired {
+		t.Fatalf("cert first: %+v", info)
+	}
+	info = NewDomainExpiryInfo(&DomainInfo{RegistrationExpiresAt: now + 2*DAY_SECONDS}, now)
+	if info.ExpiresAt != now+2*DAY_SECONDS || info.DaysLeft != 2 {
+		t.Fatalf("registration only: %+v", info)
+	}
+	info = NewDomainExpiryInfo(&DomainInfo{CertExpiresAt: now - DAY_SECONDS/2}, now)
+	if info.DaysLeft != -1 || !info.Expired {
+		t.Fatalf("expired: %+v", info)
+	}
+}
+
+func TestProbeCert(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	expiresAt, err := ProbeCert(strings.TrimPrefix(ts.URL, "https://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(ts.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt != cert.NotAfter.Unix() {
+		t.Fatalf("expires at %d, want %d", expiresAt, cert.NotAfter.Unix())
+	}
+}
@@ -0,0 +1,489 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	DOMAIN_FORMAT_TEXT = "text"
+	DOMAIN_FORMAT_CSV  = "csv"
+	DOMAIN_FORMAT_JSON = "json"
+
+	DOMAIN_IMPORT_MAX_BYTES = 4 << 20
+	DOMAIN_IMPORT_MAX_ROWS  = 5000
+	// domains of one select of GetDomainsByName
+	DOMAIN_QUERY_BATCH = 500
+
+	DOMAIN_MAX_LEN       = 253
+	DOMAIN_LABEL_MAX_LEN = 63
+)
+
+// NormalizeDomain turns a pasted domain or url into the host stored in domain:
+// lowercased, without scheme, user, path, query and trailing dot, and with idn labels in punycode.
+// A port is kept.
+func NormalizeDomain(s string) (string, error) {
+	d := strings.ToLower(strings.TrimSpace(s))
+	if i := strings.Index(d, "://"); i >= 0 {
+		d = d[i+3:]
+	}
+	d = strings.TrimPrefix(d, "//")
+	if i := strings.IndexAny(d, "/?#"); i >= 0 {
+		d = d[:i]
+	}
+	if i := strings.LastIndex(d, "@"); i >= 0 {
+		d = d[i+1:]
+	}
+	port := ""
+	if i := strings.LastIndex(d, ":"); i >= 0 {
+		port = d[i+1:]
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", fmt.Errorf("bad port[%s]", port)
+		}
+		d = d[:i]
+	}
+	d = strings.TrimSuffix(d, ".")
+	if d == "" {
+		return "", fmt.Errorf("empty domain")
+	}
+
+	d, err := utils.IDNToASCII(d)
+	if err != nil {
+		return "", err
+	}
+	if len(d) > DOMAIN_MAX_LEN {
+		return "", fmt.Errorf("longer than %d", DOMAIN_MAX_LEN)
+	}
+	labels := strings.Split(d, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("no top level domain")
+	}
+	for _, label := range labels {
+		if err := checkDomainLabel(label); err != nil {
+			return "", err
+		}
+	}
+	if port != "" {
+		d += ":" + port
+	}
+	return d, nil
+}
+
+func checkDomainLabel(label string) error {
+	if label == "" || len(label) > DOMAIN_LABEL_MAX_LEN {
+		return fmt.Errorf("label[%s] must have 1 to %d chars", label, DOMAIN_LABEL_MAX_LEN)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label[%s] starts or ends with -", label)
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("label[%s] has bad char %q", label, c)
+		}
+	}
+	return nil
+}
+
+// ParseDomainImport reads the rows of an import:
+// text has a domain per line, blank lines and # comments are skipped;
+// csv has a domain per row in its first column, or in the columns of a header
+// with domain and optional status, group_name and group_type, like the export;
+// json is an export, bare or as the response of export_domains.
+func ParseDomainImport(r io.Reader, format string) ([]*DomainImportRow, error) {
+	var rows []*DomainImportRow
+	switch format {
+	case DOMAIN_FORMAT_TEXT:
+		scanner := bufio.NewScanner(r)
+		var line int64
+		for scanner.Scan() {
+			line++
+			v := strings.TrimSpace(scanner.Text())
+			if v == "" || strings.HasPrefix(v, "#") {
+				continue
+			}
+			rows = append(rows, &DomainImportRow{Line: line, Input: v})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case DOMAIN_FORMAT_CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		cols := map[string]int{"domain": 0}
+		if len(records) > 0 && hasCell(records[0], "domain") {
+			cols = make(map[string]int)
+			for i, v := range records[0] {
+				cols[strings.ToLower(strings.TrimSpace(v))] = i
+			}
+			records[0] = nil
+		}
+		for i, record := range records {
+			if record == nil || csvCell(record, cols, "domain") == "" {
+				continue
+			}
+			row := &DomainImportRow{
+				Line:      int64(i + 1),
+				Input:     csvCell(record, cols, "domain"),
+				GroupName: csvCell(record, cols, "group_name"),
+			}
+			if row.Status, err = csvInt(record, cols, "status"); err == nil {
+				row.GroupType, err = csvInt(record, cols, "group_type")
+			}
+			if err != nil {
+				row.Result = DOMAIN_IMPORT_INVALID
+				row.Message = err.Error()
+			}
+			rows = append(rows, row)
+		}
+	case DOMAIN_FORMAT_JSON:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var groups []*DomainGroupExport
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			var response struct {
+				Data []*DomainGroupExport `json:"data"`
+			}
+			err = json.Unmarshal(data, &response)
+			groups = response.Data
+		} else {
+			err = json.Unmarshal(data, &groups)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var line int64
+		for _, g := range groups {
+			if g.DomainGroupInfo == nil {
+				g.DomainGroupInfo = &DomainGroupInfo{}
+			}
+			for _, d := range g.Domains {
+				line++
+				rows = append(rows, &DomainImportRow{
+					Line:      line,
+					Input:     d.Domain,
+					GroupName: g.Name,
+					GroupType: g.Type,
+					Status:    d.Status,
+				})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown format[%s]", format)
+	}
+	if len(rows) > DOMAIN_IMPORT_MAX_ROWS {
+		return nil, fmt.Errorf("%d rows, at most %d in one import", len(rows), DOMAIN_IMPORT_MAX_ROWS)
+	}
+	return rows, nil
+}
+
+func hasCell(record []string, name string) bool {
+	for _, v := range record {
+		if strings.ToLower(strings.TrimSpace(v)) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func csvCell(record []string, cols map[string]int, name string) string {
+	i, ok := cols[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func csvInt(record []string, cols map[string]int, name string) (int64, error) {
+	v := csvCell(record, cols, name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%s[%s] is not a number", name, v)
+	}
+	return n, nil
+}
+
+// ImportDomains adds the rows into the group groupID, or when it is 0 into the groups named by the rows,
+// creating missing groups by name and type. Show group lists are not imported, their ids differ between environments.
+// A domain already in the target group, or twice in the import, is a duplicate;
+// one in another group is skipped as exists unless allowShared.
+// Only the groups of the tenant are seen, a domain of another tenant is skipped as exists, and quotas are kept.
+// With dryRun nothing is written and the report tells what would happen.
+func (cl *ControllerLogic) ImportDomains(log *utils.Logger, groupID int64, rows []*DomainImportRow, dryRun, allowShared bool, tenantID int64) (*DomainImportReport, error) {
+	groups, _, err := cl.cdb.GetDomainGroupList(0)
+	if err != nil {
+		return nil, err
+	}
+	imp := &domainImport{
+		groupByID:   make(map[int64]*DomainGroupInfo),
+		groupByName: make(map[string]*DomainGroupInfo),
+		groupsOf:    make(map[string][]int64),
+		seen:        make(map[string]int64),
+		touched:     make(map[int64]bool),
+		quota:       &importQuota{cl: cl, tenants: make(map[int64]*TenantInfo), usage: make(map[int64]*TenantUsage)},
+		dryRun:      dryRun,
+		allowShared: allowShared,
+		log:         log,
+	}
+	// groups created by name belong to the tenant of the caller, admins create groups of no tenant
+	if tenantID != TENANT_ALL {
+		imp.newTenant = tenantID
+	}
+	for _, g := range filterDomainGroups(groups, tenantID) {
+		imp.groupByID[g.ID] = g
+		if _, ok := imp.groupByName[g.Name]; !ok {
+			imp.groupByName[g.Name] = g
+		}
+	}
+	if groupID != 0 && imp.groupByID[groupID] == nil {
+		return nil, fmt.Errorf("no this[%d] domain group!", groupID)
+	}
+
+	report := &DomainImportReport{DryRun: dryRun, Rows: rows}
+	var names []string
+	for _, row := range rows {
+		if row.Result != "" {
+			continue
+		}
+		d, err := NormalizeDomain(row.Input)
+		if err != nil {
+			row.Result = DOMAIN_IMPORT_INVALID
+			row.Message = err.Error()
+			continue
+		}
+		row.Domain = d
+		names = append(names, d)
+	}
+	existing, err := cl.cdb.GetDomainsByName(names)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range existing {
+		imp.groupsOf[v.Domain] = append(imp.groupsOf[v.Domain], v.GroupID)
+	}
+
+	for _, row := range rows {
+		if row.Result == "" {
+			cl.importDomainRow(row, groupID, imp)
+		}
+		report.Total++
+		switch row.Result {
+		case DOMAIN_IMPORT_ADDED:
+			report.Added++
+		case DOMAIN_IMPORT_DUPLICATE:
+			report.Duplicate++
+		case DOMAIN_IMPORT_EXISTS:
+			report.Exists++
+		case DOMAIN_IMPORT_INVALID:
+			report.Invalid++
+		default:
+			report.Failed++
+		}
+	}
+	for id := range imp.touched {
+		// a group created by the import is only loaded at the next refresh
+		cl.RunCheckNow(CHECK_TYPE_DOMAIN, id)
+	}
+	return report, nil
+}
+
+// domainImport is the state of an import across its rows.
+type domainImport struct {
+	// groups seen by the caller
+	groupByID   map[int64]*DomainGroupInfo
+	groupByName map[string]*DomainGroupInfo
+	// groups of every tenant having a domain
+	groupsOf map[string][]int64
+	// line of the first row of each group and domain
+	seen    map[string]int64
+	touched map[int64]bool
+	quota   *importQuota
+	// tenant of the groups created by name
+	newTenant   int64
+	dryRun      bool
+	allowShared bool
+	log         *utils.Logger
+}
+
+// importQuota counts what an import adds to each tenant against its quotas, a dry run too.
+type importQuota struct {
+	cl      *ControllerLogic
+	tenants map[int64]*TenantInfo
+	usage   map[int64]*TenantUsage
+}
+
+func (q *importQuota) take(tenantID int64, add *TenantUsage) error {
+	if tenantID <= 0 {
+		return nil
+	}
+	if q.tenants[tenantID] == nil {
+		tenant := &TenantInfo{ID: tenantID}
+		if err := q.cl.cdb.GetTenantFromID(tenant); err != nil {
+			return err
+		}
+		usage, err := q.cl.cdb.GetTenantUsage(tenantID)
+		if err != nil {
+			return err
+		}
+		q.tenants[tenantID] = tenant
+		q.usage[tenantID] = usage
+	}
+	usage := q.usage[tenantID]
+	if err := checkQuota(q.tenants[tenantID], usage, add); err != nil {
+		return err
+	}
+	usage.DomainGroups += add.DomainGroups
+	usage.Domains += add.Domains
+	return nil
+}
+
+func (cl *ControllerLogic) importDomainRow(row *DomainImportRow, groupID int64, imp *domainImport) {
+	row.GroupID = groupID
+	group := imp.groupByID[groupID]
+	if groupID == 0 {
+		if row.GroupName == "" {
+			row.Result = DOMAIN_IMPORT_INVALID
+			row.Message = "no target group, set group_id or a group name"
+			return
+		}
+		group = imp.groupByName[row.GroupName]
+		if group == nil {
+			g := &DomainGroupInfo{Name: row.GroupName, Type: row.GroupType, TenantID: imp.newTenant}
+			if err := imp.quota.take(g.TenantID, &TenantUsage{DomainGroups: 1}); err != nil {
+				row.Result = DOMAIN_IMPORT_ERROR
+				row.Message = fmt.Sprintf("create group[%s] error: %v", row.GroupName, err)
+				return
+			}
+			if !imp.dryRun {
+				if err := cl.cdb.InsertDomainGroup(g); err != nil {
+					row.Result = DOMAIN_IMPORT_ERROR
+					row.Message = fmt.Sprintf("create group[%s] error: %v", row.GroupName, err)
+					return
+				}
+				imp.log.With(utils.LOG_GROUP_ID, g.ID).Infof("import created domain group[%s].\n", g.Name)
+				cl.TenantGroupEvent(CHECK_TYPE_DOMAIN, g.ID, g.TenantID, EVENT_ACTION_ADDED)
+			}
+			imp.groupByName[row.GroupName] = g
+			group = g
+		}
+		row.GroupID = group.ID
+	}
+
+	// groups of a dry run have no id yet
+	key := fmt.Sprintf("%d/%s/%s", row.GroupID, row.GroupName, row.Domain)
+	if row.GroupID != 0 {
+		key = fmt.Sprintf("%d/%s", row.GroupID, row.Domain)
+	}
+	if line, ok := imp.seen[key]; ok {
+		row.Result = DOMAIN_IMPORT_DUPLICATE
+		row.Message = fmt.Sprintf("same as line %d", line)
+		return
+	}
+	imp.seen[key] = row.Line
+	otherTenant := false
+	for _, id := range imp.groupsOf[row.Domain] {
+		if id == row.GroupID {
+			row.Result = DOMAIN_IMPORT_DUPLICATE
+			row.Message = "already in the group"
+			return
+		}
+		// groups of other tenants are not shown
+		if imp.groupByID[id] == nil {
+			otherTenant = true
+			continue
+		}
+		row.OtherGroups = append(row.OtherGroups, id)
+	}
+	if otherTenant {
+		row.Result = DOMAIN_IMPORT_EXISTS
+		row.Message = "already used by another tenant"
+		return
+	}
+	if len(row.OtherGroups) != 0 && !imp.allowShared {
+		row.Result = DOMAIN_IMPORT_EXISTS
+		row.Message = "already in other groups"
+		return
+	}
+	if err := imp.quota.take(group.TenantID, &TenantUsage{Domains: 1}); err != nil {
+		row.Result = DOMAIN_IMPORT_ERROR
+		row.Message = err.Error()
+		return
+	}
+
+	if !imp.dryRun {
+		info := &DomainInfo{GroupID: row.GroupID, Domain: row.Domain, Status: row.Status}
+		if err := cl.cdb.InsertDomain(info); err != nil {
+			row.Result = DOMAIN_IMPORT_ERROR
+			row.Message = err.Error()
+			return
+		}
+		row.ID = info.ID
+		imp.touched[row.GroupID] = true
+	}
+	row.Result = DOMAIN_IMPORT_ADDED
+}
+
+// ExportDomains returns a domain group with its domains, or every group of the tenant when groupID is 0.
+func (cl *ControllerLogic) ExportDomains(groupID, tenantID int64) ([]*DomainGroupExport, error) {
+	groups, _, err := cl.cdb.GetDomainGroupList(0)
+	if err != nil {
+		return nil, err
+	}
+	groups = filterDomainGroups(groups, tenantID)
+	list := make([]*DomainGroupExport, 0, len(groups))
+	for _, g := range groups {
+		if groupID != 0 && g.ID != groupID {
+			continue
+		}
+		domainList := &DomainList{GroupID: g.ID}
+		if err := cl.cdb.GetDomainList(domainList); err != nil {
+			return nil, err
+		}
+		if domainList.DomainList == nil {
+			domainList.DomainList = make([]*DomainInfo, 0)
+		}
+		list = append(list, &DomainGroupExport{DomainGroupInfo: g, Domains: domainList.DomainList})
+	}
+	if groupID != 0 && len(list) == 0 {
+		return nil, fmt.Errorf("no this[%d] domain group!", groupID)
+	}
+	return list, nil
+}
+
+// WriteDomainExportCSV writes a domain per row, in the columns ParseDomainImport reads back.
+func WriteDomainExportCSV(w io.Writer, list []*DomainGroupExport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group_id", "group_name", "group_type", "domain", "status"})
+	for _, g := range list {
+		for _, d := range g.Domains {
+			cw.Write([]string{
+				strconv.FormatInt(g.ID, 10),
+				g.Name,
+				strconv.FormatInt(g.Type, 10),
+				d.Domain,
+				strconv.FormatInt(d.Status, 10),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	cases := map[string]string{
+		"Example.COM":                       "example.com",
+		"  www.example.com.  ":              "www.example.com",
+		"https://www.example.com/a/b?c=d#e": "www.example.com",
+		"//cdn.example.com/x":               "cdn.example.com",
+		"http://user:pw@example.com:8080/":  "example.com:8080",
+		"http://Bücher.de/":                 "xn--bcher-kva.de",
+		"a_b.example.com":                   "a_b.example.com",
+	}
+	for in, want := range cases {
+		got, err := NormalizeDomain(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got %s, want %s", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "localhost", "http://", "-a.com", "a..com", "a b.com", "example.com:http", strings.Repeat("a", 64) + ".com"} {
+		if got, err := NormalizeDomain(in); err == nil {
+			t.Errorf("%q: got %s, want error", in, got)
+		}
+	}
+}
+
+func TestParseDomainImport(t *testing.T) {
+	rows, err := ParseDomainImport(strings.NewReader("a.com\n\n# comment\n  b.com  \n"), DOMAIN_FORMAT_TEXT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Input != "a.com" || rows[1].Input != "b.com" || rows[1].Line != 4 {
+		t.Fatalf("text rows: %+v %+v", rows[0], rows[1])
+	}
+
+	// no header, the domain is the first column
+	rows, err = ParseDomainImport(strings.NewReader("a.com,x\nb.com\n"), DOMAIN_FORMAT_CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Input != "a.com" || rows[1].Input != "b.com" {
+		t.Fatalf("csv rows: %+v", rows)
+	}
+
+	rows, err = ParseDomainImport(strings.NewReader("status,Domain\n1,a.com\nx,b.com\n"), DOMAIN_FORMAT_CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Input != "a.com" || rows[0].Status != 1 || rows[0].Line != 2 {
+		t.Fatalf("csv header row: %+v", rows[0])
+	}
+	if rows[1].Result != DOMAIN_IMPORT_INVALID {
+		t.Fatalf("bad status not invalid: %+v", rows[1])
+	}
+
+	if _, err := ParseDomainImport(strings.NewReader(""), "xml"); err == nil {
+		t.Fatal("unknown format parsed")
+	}
+}
+
+func TestDomainExportRoundTrip(t *testing.T) {
+	list := []*DomainGroupExport{
+		{
+			DomainGroupInfo: &DomainGroupInfo{ID: 3, Name: "jump, one", Type: DOMAIN_GROUP_TYPE_JUMP},
+			Domains: []*DomainInfo{
+				{ID: 7, GroupID: 3, Domain: "a.com"},
+				{ID: 8, GroupID: 3, Domain: "b.com", Status: 1},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDomainExportCSV(&buf, list); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ParseDomainImport(&buf, DOMAIN_FORMAT_CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("csv got %d rows", len(rows))
+	}
+	if r := rows[1]; r.Input != "b.com" || r.Status != 1 || r.GroupName != "jump, one" || r.GroupType != DOMAIN_GROUP_TYPE_JUMP {
+		t.Fatalf("csv row: %+v", r)
+	}
+
+	// the response of export_domains is read as it is
+	data := `{"code":0,"msg":"","data":[{"id":3,"name":"g","type":1,"domains":[{"domain":"a.com","status":1}]}]}`
+	rows, err = ParseDomainImport(strings.NewReader(data), DOMAIN_FORMAT_JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Input != "a.com" || rows[0].Status != 1 || rows[0].GroupName != "g" || rows[0].GroupType != 1 {
+		t.Fatalf("json rows: %+v", rows)
+	}
+}
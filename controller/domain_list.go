@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+// ParseDomainQuery reads the params of get_all_domains:
+// group_id, status (0, 1 or all, default 0), type (0, 1 or all), q as a substring of the domain,
+// distinct (default 1), offset, limit, and format (html, text, json or csv, default html).
+// Without offset and limit the html, text and csv lists hold every domain, as the list always did;
+// json pages by DOMAIN_LIST_DEFAULT_LIMIT.
+func ParseDomainQuery(form url.Values) (*DomainQuery, string, error) {
+	query := &DomainQuery{
+		TenantID: TENANT_ALL,
+		Status:   0,
+		Type:     -1,
+		Name:     form.Get("q"),
+		Distinct: true,
+		Limit:    DOMAIN_LIST_DEFAULT_LIMIT,
+	}
+	var err error
+	if v := form.Get("group_id"); v != "" {
+		if query.GroupID, err = strconv.ParseInt(v, 10, 0); err != nil || query.GroupID < 0 {
+			return nil, "", fmt.Errorf("group_id[%s] is not a group id", v)
+		}
+	}
+	if query.Status, err = parseAllOrInt(form, "status", 0); err != nil {
+		return nil, "", err
+	}
+	if query.Type, err = parseAllOrInt(form, "type", -1); err != nil {
+		return nil, "", err
+	}
+	switch form.Get("distinct") {
+	case "", "1", "true":
+	case "0", "false":
+		query.Distinct = false
+	default:
+		return nil, "", fmt.Errorf("distinct[%s] must be 0 or 1", form.Get("distinct"))
+	}
+	if v := form.Get("offset"); v != "" {
+		if query.Offset, err = strconv.ParseInt(v, 10, 0); err != nil || query.Offset < 0 {
+			return nil, "", fmt.Errorf("offset[%s] is not a number", v)
+		}
+	}
+	if v := form.Get("limit"); v != "" {
+		if query.Limit, err = strconv.ParseInt(v, 10, 0); err != nil || query.Limit <= 0 {
+			return nil, "", fmt.Errorf("limit[%s] is not a positive number", v)
+		}
+		if query.Limit > DOMAIN_LIST_MAX_LIMIT {
+			query.Limit = DOMAIN_LIST_MAX_LIMIT
+		}
+	}
+
+	format := form.Get("format")
+	switch format {
+	case "":
+		format = DOMAIN_LIST_HTML
+	case DOMAIN_LIST_HTML, DOMAIN_LIST_TEXT, DOMAIN_LIST_JSON, DOMAIN_LIST_CSV:
+	default:
+		return nil, "", fmt.Errorf("format[%s] must be html, text, json or csv", format)
+	}
+	if format != DOMAIN_LIST_JSON && form.Get("offset") == "" && form.Get("limit") == "" {
+		query.Limit = 0
+	}
+	return query, format, nil
+}
+
+func parseAllOrInt(form url.Values, name string, def int64) (int64, error) {
+	v := form.Get(name)
+	switch v {
+	case "":
+		return def, nil
+	case "all":
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 0)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s[%s] must be a number or all", name, v)
+	}
+	return n, nil
+}
+
+func WriteDomainListText(w io.Writer, list []*DomainListItem) error {
+	for _, v := range list {
+		if _, err := fmt.Fprintln(w, v.Domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func WriteDomainListCSV(w io.Writer, list []*DomainListItem) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "group_id", "group_name", "group_type", "domain", "status", "groups", "time"})
+	for _, v := range list {
+		cw.Write([]string{
+			strconv.FormatInt(v.ID, 10),
+			strconv.FormatInt(v.GroupID, 10),
+			v.GroupName,
+			strconv.FormatInt(v.GroupType, 10),
+			v.Domain,
+			strconv.FormatInt(v.Status, 10),
+			strconv.FormatInt(v.Groups, 10),
+			v.Time,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseDomainQuery(t *testing.T) {
+	query, format, err := ParseDomainQuery(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the defaults list every ok domain once, as the list always did
+	if format != DOMAIN_LIST_HTML || query.Status != 0 || query.Type != -1 || !query.Distinct ||
+		query.Offset != 0 || query.Limit != 0 {
+		t.Fatalf("defaults: %s %+v", format, query)
+	}
+	if query, _, _ = ParseDomainQuery(url.Values{"format": {"json"}}); query.Limit != DOMAIN_LIST_DEFAULT_LIMIT {
+		t.Fatalf("json default limit: %d", query.Limit)
+	}
+	if query, _, _ = ParseDomainQuery(url.Values{"offset": {"10"}}); query.Limit != DOMAIN_LIST_DEFAULT_LIMIT {
+		t.Fatalf("html paged default limit: %d", query.Limit)
+	}
+
+	form := url.Values{
+		"group_id": {"3"},
+		"status":   {"all"},
+		"type":     {"1"},
+		"q":        {"abc"},
+		"distinct": {"0"},
+		"offset":   {"20"},
+		"limit":    {"1000000"},
+		"format":   {"csv"},
+	}
+	query, format, err = ParseDomainQuery(form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != DOMAIN_LIST_CSV || query.GroupID != 3 || query.Status != -1 || query.Type != 1 || query.Name != "abc" ||
+		query.Distinct || query.Offset != 20 || query.Limit != DOMAIN_LIST_MAX_LIMIT {
+		t.Fatalf("params: %s %+v", format, query)
+	}
+
+	for _, bad := range []url.Values{
+		{"status": {"x"}},
+		{"type": {"-1"}},
+		{"offset": {"-1"}},
+		{"limit": {"0"}},
+		{"distinct": {"yes"}},
+		{"format": {"xml"}},
+	} {
+		if _, _, err := ParseDomainQuery(bad); err == nil {
+			t.Errorf("%v: no error", bad)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package controller
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"html/template"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
 )
 
 func (xhs *XHttpServer) addDomainGroup(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
@@ -18,12 +23,26 @@ func (xhs *XHttpServer) addDomainGroup(rsp http.ResponseWriter, req *http.Reques
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.InsertDomainGroup(&info)
+	if info.Type != DOMAIN_GROUP_TYPE_SHOW && info.Type != DOMAIN_GROUP_TYPE_JUMP {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("unknown domain group type[%d].", info.Type)
+		return response, nil
+	}
+
+	tenantID, err := xhs.logic.NewGroupTenant(callerTenant(req), info.TenantID)
+	if err == nil {
+		err = xhs.logic.CheckTenantQuota(tenantID, &TenantUsage{DomainGroups: 1})
+	}
+	if err == nil {
+		info.TenantID = tenantID
+		err = xhs.logic.cdb.InsertDomainGroup(&info)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("add domain group failed: %v", err)
 		return response, nil
 	}
+	xhs.logic.GroupEvent(CHECK_TYPE_DOMAIN, info.ID, EVENT_ACTION_ADDED)
 
 	return response, nil
 }
@@ -37,7 +56,13 @@ func (xhs *XHttpServer) addDomain(rsp http.ResponseWriter, req *http.Request) (i
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.InsertDomain(&info)
+	err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.CheckDomainQuota(info.GroupID, 1)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.InsertDomain(&info)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("add domain failed: %v", err)
@@ -56,12 +81,26 @@ func (xhs *XHttpServer) addContentGroup(rsp http.ResponseWriter, req *http.Reque
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.InsertContentGroup(&info)
+	if err := CheckContentFormats(info.Formats, info.JsonpCallback); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("add content group failed: %v", err)
+		return response, nil
+	}
+
+	tenantID, err := xhs.logic.NewGroupTenant(callerTenant(req), info.TenantID)
+	if err == nil {
+		err = xhs.logic.CheckTenantQuota(tenantID, &TenantUsage{ContentGroups: 1})
+	}
+	if err == nil {
+		info.TenantID = tenantID
+		err = xhs.logic.cdb.InsertContentGroup(&info)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("add content group failed: %v", err)
 		return response, nil
 	}
+	xhs.logic.GroupEvent(CHECK_TYPE_CONTENT, info.ID, EVENT_ACTION_ADDED)
 
 	return response, nil
 }
@@ -69,8 +108,12 @@ func (xhs *XHttpServer) addContentGroup(rsp http.ResponseWriter, req *http.Reque
 func (xhs *XHttpServer) addVideoContent(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	response := &Response{Code: RES_OK}
 	type AddVideoReq struct {
-		GroupID int64       `json:"groupID"`
-		VInfo   interface{} `json:"video"`
+		GroupID   int64       `json:"groupID"`
+		Position  int64       `json:"position"`
+		Pinned    bool        `json:"pinned"`
+		PublishAt int64       `json:"publishAt"`
+		ExpireAt  int64       `json:"expireAt"`
+		VInfo     interface{} `json:"video"`
 	}
 	result, err := ioutil.ReadAll(req.Body)
 	if err != nil {
@@ -94,11 +137,19 @@ func (xhs *XHttpServer) addVideoContent(rsp http.ResponseWriter, req *http.Reque
 	}
 
 	content := &ContentInfo{
-		GroupID: info.GroupID,
-		Value:   string(valueBytes),
-		Type:    CONTENT_TYPE_VIDEO,
+		GroupID:   info.GroupID,
+		Value:     string(valueBytes),
+		Type:      CONTENT_TYPE_VIDEO,
+		Position:  info.Position,
+		Enabled:   true,
+		Pinned:    info.Pinned,
+		PublishAt: info.PublishAt,
+		ExpireAt:  info.ExpireAt,
+	}
+	err = xhs.logic.CheckContentGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.InsertContent(content)
 	}
-	err = xhs.logic.cdb.InsertContent(content)
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("add content failed: %v", err)
@@ -123,9 +174,12 @@ func (xhs *XHttpServer) getDomainGroupDetail(rsp http.ResponseWriter, req *http.
 	domainGroupInfo := &DomainGroupInfo{
 		ID: info.GroupID,
 	}
-	err := xhs.logic.cdb.GetDomainGroupFromID(domainGroupInfo)
+	err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.GetDomainGroupFromID(domainGroupInfo)
+	}
 	if err != nil {
-		plog.Errorf("get domain group detail error: %v\n", err)
+		requestLogger(req).With(utils.LOG_GROUP_ID, info.GroupID).Errorf("get domain group detail error: %v\n", err)
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("get domain group detail error: %v\n", err)
 	} else {
@@ -139,11 +193,11 @@ func (xhs *XHttpServer) getDomainGroup(rsp http.ResponseWriter, req *http.Reques
 	response := &Response{Code: RES_OK}
 	list, _, err := xhs.logic.cdb.GetDomainGroupList(0)
 	if err != nil {
-		plog.Errorf("get domain groups error: %v\n", err)
+		requestLogger(req).Errorf("get domain groups error: %v\n", err)
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("get domain groups error: %v\n", err)
 	} else {
-		response.Data = list
+		response.Data = filterDomainGroups(list, callerTenant(req))
 	}
 
 	return response, nil
@@ -158,7 +212,10 @@ func (xhs *XHttpServer) getDomainList(rsp http.ResponseWriter, req *http.Request
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.GetDomainList(&list)
+	err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), list.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.GetDomainList(&list)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("get domain list failed: %v", err)
@@ -178,12 +235,16 @@ func (xhs *XHttpServer) offDomain(rsp http.ResponseWriter, req *http.Request) (i
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.UpdateDomainStatus(&info)
+	err := xhs.logic.CheckDomainTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateDomainStatus(&info)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("off domain failed: %v", err)
 		return response, nil
 	}
+	xhs.logic.DomainStatusChanged(info.ID)
 
 	return response, nil
 }
@@ -203,12 +264,16 @@ func (xhs *XHttpServer) settingDomainGroup(rsp http.ResponseWriter, req *http.Re
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.UpdateDomainGroupStatus(&info)
+	err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateDomainGroupStatus(&info)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("off domain group failed: %v", err)
 		return response, nil
 	}
+	xhs.logic.GroupEvent(CHECK_TYPE_DOMAIN, info.ID, EVENT_ACTION_UPDATED)
 
 	return response, nil
 }
@@ -228,9 +293,12 @@ func (xhs *XHttpServer) getContentGroupDetail(rsp http.ResponseWriter, req *http
 	contentGroupInfo := &ContentGroupInfo{
 		ID: info.GroupID,
 	}
-	err := xhs.logic.cdb.GetContentGroupFromID(contentGroupInfo)
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.GetContentGroupFromID(contentGroupInfo)
+	}
 	if err != nil {
-		plog.Errorf("get content group detail error: %v\n", err)
+		requestLogger(req).With(utils.LOG_GROUP_ID, info.GroupID).Errorf("get content group detail error: %v\n", err)
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("get content group detail error: %v\n", err)
 	} else {
@@ -244,11 +312,11 @@ func (xhs *XHttpServer) getContentGroup(rsp http.ResponseWriter, req *http.Reque
 	response := &Response{Code: RES_OK}
 	list, _, err := xhs.logic.cdb.GetContentGroupList(0)
 	if err != nil {
-		plog.Errorf("get content groups error: %v\n", err)
+		requestLogger(req).Errorf("get content groups error: %v\n", err)
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("get content groups error: %v\n", err)
 	} else {
-		response.Data = list
+		response.Data = filterContentGroups(list, callerTenant(req))
 	}
 
 	return response, nil
@@ -263,7 +331,10 @@ func (xhs *XHttpServer) getContentList(rsp http.ResponseWriter, req *http.Reques
 		return response, nil
 	}
 
-	err := xhs.logic.cdb.GetContentList(&list)
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), list.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.GetContentList(&list)
+	}
 	if err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("get content list failed: %v", err)
@@ -274,140 +345,1500 @@ func (xhs *XHttpServer) getContentList(rsp http.ResponseWriter, req *http.Reques
 	return response, nil
 }
 
-func (xhs *XHttpServer) getURL(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+func (xhs *XHttpServer) settingContentGroup(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	response := &Response{Code: RES_OK}
-	// type = 0: show domain url
-	// type = 1: jump domain url
-	type GetURLReq struct {
+	var info ContentGroupInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	if info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("content group id cannot be 0.")
+		return response, nil
+	}
+	if err := CheckContentFormats(info.Formats, info.JsonpCallback); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("setting content group failed: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateContentGroupFormats(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("setting content group failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.GroupEvent(CHECK_TYPE_CONTENT, info.ID, EVENT_ACTION_UPDATED)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) settingContent(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info ContentSetting
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	if info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("content id cannot be 0.")
+		return response, nil
+	}
+
+	err := xhs.logic.CheckContentTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateContentSetting(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("setting content failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) reorderContent(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	// contents not in ContentIDs keep their relative order after the listed ones
+	type ReorderContentReq struct {
+		GroupID    int64   `json:"groupID"`
+		ContentIDs []int64 `json:"contentIDs"`
+	}
+	var info ReorderContentReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	list := &ContentList{
+		GroupID: info.GroupID,
+	}
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.GetContentList(list)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get content list failed: %v", err)
+		return response, nil
+	}
+	inGroup := make(map[int64]bool)
+	for _, v := range list.ContentList {
+		inGroup[v.ID] = true
+	}
+	var ids []int64
+	listed := make(map[int64]bool)
+	for _, id := range info.ContentIDs {
+		if !inGroup[id] {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("content[%d] is not in group[%d].", id, info.GroupID)
+			return response, nil
+		}
+		if listed[id] {
+			continue
+		}
+		listed[id] = true
+		ids = append(ids, id)
+	}
+	for _, v := range list.ContentList {
+		if !listed[v.ID] {
+			ids = append(ids, v.ID)
+		}
+	}
+
+	err = xhs.logic.cdb.UpdateContentPositions(info.GroupID, ids)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("reorder content failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) setContentSchedule(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info ContentInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	if info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("content id cannot be 0.")
+		return response, nil
+	}
+	if info.PublishAt != 0 && info.ExpireAt != 0 && info.ExpireAt <= info.PublishAt {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("expireAt must be after publishAt.")
+		return response, nil
+	}
+
+	err := xhs.logic.CheckContentTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateContentSchedule(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set content schedule failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getContentSchedule(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetContentScheduleReq struct {
 		GroupID int64 `json:"groupID"`
-		Type    int64 `json:"type"`
 	}
-	var info GetURLReq
+	var info GetContentScheduleReq
 	if err := xhs.decodeBody(req, &info, nil); err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
 		return response, nil
 	}
-	clientInfo := xhs.GetClientInfo(req)
-	plog.Debugf("get_url: group_ID[%d] type[%d]\n", info.GroupID, info.Type)
-	plog.Debugf("get_url: client_info: %v\n", clientInfo)
 
-	data, err := xhs.logic.GetDomainInfo(info.GroupID, info.Type)
+	list := &ContentList{
+		GroupID: info.GroupID,
+	}
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.cdb.GetContentList(list)
+	}
 	if err != nil {
 		response.Code = RES_ERR
-		response.Msg = fmt.Sprintf("get url failed: %v", err)
+		response.Msg = fmt.Sprintf("get content list failed: %v", err)
 		return response, nil
 	}
-	response.Data = data
+	response.Data = list.UpcomingSchedule(xhs.logic.clock.Now().Unix())
 
 	return response, nil
 }
 
-func (xhs *XHttpServer) getData(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+func (xhs *XHttpServer) publishContent(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	response := &Response{Code: RES_OK}
-	type GetContentReq struct {
-		GroupID        int64 `json:"groupID"`
-		ContentGroupID int64 `json:"contentGroupID"`
+	type PublishContentReq struct {
+		GroupID int64 `json:"groupID"`
 	}
-	var info GetContentReq
+	var info PublishContentReq
 	if err := xhs.decodeBody(req, &info, nil); err != nil {
 		response.Code = RES_ERR
 		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
 		return response, nil
 	}
-	clientInfo := xhs.GetClientInfo(req)
-	plog.Debugf("get_data: client_info: %v\n", clientInfo)
 
-	data, err := xhs.logic.GetContent(info.GroupID, info.ContentGroupID, clientInfo.IP)
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.PublishContent(info.GroupID)
+	}
 	if err != nil {
 		response.Code = RES_ERR
-		response.Msg = fmt.Sprintf("get content failed: %v", err)
+		response.Msg = fmt.Sprintf("publish content failed: %v", err)
 		return response, nil
 	}
-	response.Data = data
 
 	return response, nil
 }
 
-func (xhs *XHttpServer) setDomainStatus(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+func (xhs *XHttpServer) getPublishStatus(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetPublishStatusReq struct {
+		GroupID int64 `json:"groupID"`
+	}
+	var info GetPublishStatusReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	list, err := xhs.logic.GetPublishStates(info.GroupID, callerTenant(req))
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get publish status failed: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+// getStats answers /api/v2/stats?from=&to=&kind=&group_id=&step=minute|hour|day&format=json|csv,
+// from and to are unix seconds, the last day by default.
+func (xhs *XHttpServer) getStats(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
 	req.ParseForm()
-	var domain string
-	var status int64
-	domainV := req.Form["domain"]
-	if domainV == nil {
-		plog.Errorf("set domain status domain is nil\n")
-		return nil, nil
+	now := xhs.logic.clock.Now().Unix()
+	query := &ServeStatQuery{
+		From:     now - SERVE_STATS_DEFAULT_RANGE,
+		To:       now,
+		Kind:     req.Form.Get("kind"),
+		Step:     60,
+		TenantID: callerTenant(req),
 	}
-	statusV := req.Form["status"]
-	if statusV == nil {
-		plog.Errorf("set domain status status is nil \n")
-		return nil, nil
+	var err error
+	if v := req.Form.Get("from"); v != "" {
+		if query.From, err = strconv.ParseInt(v, 10, 0); err != nil {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("from[%s] is not unix seconds", v)
+			return response, nil
+		}
 	}
-	domain = domainV[0]
-	status, _ = strconv.ParseInt(statusV[0], 10, 0)
+	if v := req.Form.Get("to"); v != "" {
+		if query.To, err = strconv.ParseInt(v, 10, 0); err != nil {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("to[%s] is not unix seconds", v)
+			return response, nil
+		}
+	}
+	if v := req.Form.Get("group_id"); v != "" {
+		if query.GroupID, err = strconv.ParseInt(v, 10, 0); err != nil {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("group_id[%s] is not a group id", v)
+			return response, nil
+		}
+	}
+	switch req.Form.Get("step") {
+	case "", "minute":
+	case "hour":
+		query.Step = 60 * 60
+	case "day":
+		query.Step = 24 * 60 * 60
+	default:
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("step[%s] must be minute, hour or day", req.Form.Get("step"))
+		return response, nil
+	}
+	if query.Kind != "" && query.Kind != SERVE_STAT_DOMAIN && query.Kind != SERVE_STAT_CONTENT {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("kind[%s] must be %s or %s", query.Kind, SERVE_STAT_DOMAIN, SERVE_STAT_CONTENT)
+		return response, nil
+	}
+	if query.To <= query.From {
+		response.Code = RES_ERR
+		response.Msg = "to must be after from"
+		return response, nil
+	}
+
+	// counters not flushed yet are part of the answer
+	xhs.logic.FlushServeStats()
+	list, err := xhs.logic.cdb.GetServeStats(query)
+	if err != nil {
+		requestLogger(req).Errorf("get serve stats error: %v\n", err)
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get serve stats error: %v", err)
+		return response, nil
+	}
+
+	if req.Form.Get("format") == "csv" {
+		rsp.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		rsp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=serve_stats_%d_%d.csv", query.From, query.To))
+		return nil, WriteServeStatsCSV(rsp, list)
+	}
+	response.Data = list
+
+	return response, nil
+}
 
+func (xhs *XHttpServer) provisionBucket(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	response := &Response{Code: RES_OK}
-	info := &DomainInfo{
-		Domain: domain,
-		Status: status,
+	err := xhs.logic.ProvisionBucket()
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("provision bucket failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getSchedule(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	response.Data = xhs.logic.sched.Tasks()
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) checkNow(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	// type: domain or content
+	type CheckNowReq struct {
+		Type    string `json:"type"`
+		GroupID int64  `json:"groupID"`
+	}
+	var info CheckNowReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
 	}
 
-	err := xhs.logic.cdb.UpdateDomainsStatus(info)
+	err := xhs.logic.CheckGroupTenant(info.Type, callerTenant(req), info.GroupID)
+	if err == nil {
+		err = xhs.logic.RunCheckNow(info.Type, info.GroupID)
+	}
 	if err != nil {
 		response.Code = RES_ERR
-		response.Msg = fmt.Sprintf("set domain failed: %v", err)
+		response.Msg = fmt.Sprintf("check now failed: %v", err)
 		return response, nil
 	}
 
 	return response, nil
 }
 
-func (xhs *XHttpServer) getAllDomains(rsp http.ResponseWriter, req *http.Request) {
-	//req.ParseForm()
-	//var offset int64
-	//var num int64
-	//offsetV := req.Form["offset"]
-	//if offsetV == nil {
-	//	plog.Errorf("get all domains offset is nil\n")
-	//	rsp.WriteHeader(500)
-	//	rsp.Write([]byte("get all domains offset is nil."))
-	//	return
-	//}
-	//numV := req.Form["num"]
-	//if numV == nil {
-	//	plog.Errorf("get all domains num is nil \n")
-	//	rsp.WriteHeader(500)
-	//	rsp.Write([]byte("get all domains num is nil."))
-	//	return
-	//}
-	//offset, _ = strconv.ParseInt(offsetV[0], 10, 0)
-	//num, _ = strconv.ParseInt(numV[0], 10, 0)
-
-	list, err := xhs.logic.cdb.GetAllDomain()
-	if err != nil {
-		rsp.WriteHeader(500)
-		rsp.Write([]byte("get all domain error."))
-		return
+func (xhs *XHttpServer) setCheckInterval(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	// type: domain or content, interval: seconds, 0 means the default
+	type SetCheckIntervalReq struct {
+		Type     string `json:"type"`
+		GroupID  int64  `json:"groupID"`
+		Interval int64  `json:"interval"`
 	}
-	type HtmlDomains struct {
-		Title   string
-		Domains []string
+	var info SetCheckIntervalReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
 	}
-	htmlDomains := &HtmlDomains{
-		Title:   "domains",
-		Domains: list,
+	if info.Interval < 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("interval cannot be negative.")
+		return response, nil
 	}
-	tpl, err := template.New("domains.tpl").ParseFiles(xhs.logic.cfg.DomainsTpl)
+
+	err := xhs.logic.CheckGroupTenant(info.Type, callerTenant(req), info.GroupID)
 	if err != nil {
-		fmt.Println(err)
-		rsp.WriteHeader(500)
-		rsp.Write([]byte("tpl parse error."))
-		return
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set check interval failed: %v", err)
+		return response, nil
+	}
+	switch info.Type {
+	case CHECK_TYPE_DOMAIN:
+		err = xhs.logic.cdb.UpdateDomainGroupCheckInterval(&DomainGroupInfo{ID: info.GroupID, CheckInterval: info.Interval})
+	case CHECK_TYPE_CONTENT:
+		err = xhs.logic.cdb.UpdateContentGroupCheckInterval(&ContentGroupInfo{ID: info.GroupID, CheckInterval: info.Interval})
+	default:
+		err = fmt.Errorf("unknown check type[%s]", info.Type)
 	}
-	err = tpl.Execute(rsp, htmlDomains)
 	if err != nil {
-		rsp.WriteHeader(500)
-		rsp.Write([]byte("tpl parse error."))
-		return
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set check interval failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.GroupEvent(info.Type, info.GroupID, EVENT_ACTION_UPDATED)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getConfig(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type ConfigData struct {
+		Config     *config.Config    `json:"config"`
+		LastReload *ConfigReloadInfo `json:"lastReload"`
+	}
+	response.Data = &ConfigData{
+		Config:     xhs.logic.Config().Redacted(),
+		LastReload: xhs.logic.LastConfigReload(),
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) reloadConfig(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	info := xhs.logic.ReloadConfig()
+	if !info.Applied {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("reload config failed: %s", info.Error)
 	}
+	response.Data = info
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getURL(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	// type = 0: show domain url
+	// type = 1: jump domain url
+	// tenantID picks the tenant of callers without an api key, 0 is every tenant
+	type GetURLReq struct {
+		GroupID  int64 `json:"groupID"`
+		Type     int64 `json:"type"`
+		TenantID int64 `json:"tenantID"`
+	}
+	var info GetURLReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+	clientInfo := xhs.GetClientInfo(req)
+	log := requestLogger(req).With(utils.LOG_GROUP_ID, info.GroupID)
+	log.Debugf("get_url: type[%d]\n", info.Type)
+	log.Debugf("get_url: client_info: %v\n", clientInfo)
+
+	data, err := xhs.logic.GetDomainInfo(log, info.GroupID, info.Type, publicTenant(req, info.TenantID))
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get url failed: %v", err)
+		return response, nil
+	}
+	response.Data = data
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getData(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetContentReq struct {
+		GroupID        int64 `json:"groupID"`
+		ContentGroupID int64 `json:"contentGroupID"`
+		TenantID       int64 `json:"tenantID"`
+	}
+	var info GetContentReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+	clientInfo := xhs.GetClientInfo(req)
+	log := requestLogger(req).With(utils.LOG_GROUP_ID, info.GroupID)
+	log.Debugf("get_data: client_info: %v\n", clientInfo)
+
+	data, err := xhs.logic.GetContent(log, info.GroupID, info.ContentGroupID, clientInfo.IP, publicTenant(req, info.TenantID))
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get content failed: %v", err)
+		return response, nil
+	}
+	response.Data = data
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) setDomainStatus(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	req.ParseForm()
+	var domain string
+	var status int64
+	domainV := req.Form["domain"]
+	if domainV == nil {
+		requestLogger(req).Errorf("set domain status domain is nil\n")
+		return nil, nil
+	}
+	statusV := req.Form["status"]
+	if statusV == nil {
+		requestLogger(req).Errorf("set domain status status is nil \n")
+		return nil, nil
+	}
+	domain = domainV[0]
+	status, _ = strconv.ParseInt(statusV[0], 10, 0)
+
+	response := &Response{Code: RES_OK}
+	info := &DomainInfo{
+		Domain: domain,
+		Status: status,
+	}
+
+	err := xhs.logic.cdb.UpdateDomainsStatus(info, callerTenant(req))
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set domain failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.DomainsStatusChanged(domain, callerTenant(req))
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getAllDomains(rsp http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	query, format, err := ParseDomainQuery(req.Form)
+	if err != nil {
+		xhs.domainListError(rsp, format, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.TenantID = callerTenant(req)
+	log := requestLogger(req)
+
+	list, total, err := xhs.logic.cdb.GetDomains(query)
+	if err != nil {
+		log.Errorf("get all domains error: %v\n", err)
+		xhs.domainListError(rsp, format, http.StatusInternalServerError, "get all domain error.")
+		return
+	}
+	rsp.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	switch format {
+	case DOMAIN_LIST_JSON:
+		ResponseJSONOK(rsp, &Response{
+			Code: RES_OK,
+			Data: &DomainListPage{Total: total, Offset: query.Offset, Limit: query.Limit, List: list},
+		})
+	case DOMAIN_LIST_TEXT:
+		rsp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		WriteDomainListText(rsp, list)
+	case DOMAIN_LIST_CSV:
+		rsp.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		rsp.Header().Set("Content-Disposition", "attachment; filename=domains.csv")
+		WriteDomainListCSV(rsp, list)
+	default:
+		tpl, err := xhs.domainsTpl.Get(log, xhs.logic.Config().DomainsTpl)
+		if err != nil {
+			log.Errorf("domains tpl error: %v\n", err)
+			xhs.domainListError(rsp, format, http.StatusInternalServerError, "tpl parse error.")
+			return
+		}
+		// Domains keeps templates written for the plain list working
+		type HtmlDomains struct {
+			Title   string
+			Domains []string
+			List    []*DomainListItem
+			Total   int64
+			Offset  int64
+			Limit   int64
+		}
+		htmlDomains := &HtmlDomains{
+			Title:  "domains",
+			List:   list,
+			Total:  total,
+			Offset: query.Offset,
+			Limit:  query.Limit,
+		}
+		for _, v := range list {
+			htmlDomains.Domains = append(htmlDomains.Domains, v.Domain)
+		}
+		var buf bytes.Buffer
+		if err = tpl.Execute(&buf, htmlDomains); err != nil {
+			log.Errorf("domains tpl execute error: %v\n", err)
+			xhs.domainListError(rsp, format, http.StatusInternalServerError, "tpl parse error.")
+			return
+		}
+		rsp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rsp.Write(buf.Bytes())
+	}
+}
+
+func (xhs *XHttpServer) domainListError(rsp http.ResponseWriter, format string, code int, msg string) {
+	if format == DOMAIN_LIST_JSON {
+		ResponseJSON(rsp, code, &Response{Code: RES_ERR, Msg: msg})
+		return
+	}
+	rsp.WriteHeader(code)
+	rsp.Write([]byte(msg))
+}
+
+func (xhs *XHttpServer) updateDomainGroup(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DomainGroupInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	if info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("domain group id cannot be 0.")
+		return response, nil
+	}
+	if err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), info.ID); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update domain group failed: %v", err)
+		return response, nil
+	}
+	if err := xhs.logic.ValidateDomainGroupUpdate(&info); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update domain group failed: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.cdb.UpdateDomainGroupInfo(&info)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update domain group failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RunCheckNow(CHECK_TYPE_DOMAIN, info.ID)
+	xhs.logic.GroupEvent(CHECK_TYPE_DOMAIN, info.ID, EVENT_ACTION_UPDATED)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) updateDomain(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DomainInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	if info.ID == 0 || info.Domain == "" {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("domain id and domain cannot be empty.")
+		return response, nil
+	}
+
+	err := xhs.logic.CheckDomainTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateDomain(&info)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.GetDomainFromID(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update domain failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RunCheckNow(CHECK_TYPE_DOMAIN, info.GroupID)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) updateContentGroup(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info ContentGroupInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	if info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("content group id cannot be 0.")
+		return response, nil
+	}
+
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateContentGroupInfo(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update content group failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RunCheckNow(CHECK_TYPE_CONTENT, info.ID)
+	xhs.logic.GroupEvent(CHECK_TYPE_CONTENT, info.ID, EVENT_ACTION_UPDATED)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) updateVideoContent(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type UpdateVideoReq struct {
+		ID    int64       `json:"id"`
+		VInfo interface{} `json:"video"`
+	}
+	result, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update content ioutil.ReadAll failed: %v", err)
+		return response, nil
+	}
+	var info UpdateVideoReq
+	err = json.Unmarshal(result, &info)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update content json unmarshal failed: %v", err)
+		return response, nil
+	}
+	if info.ID == 0 || info.VInfo == nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("content id and video cannot be empty.")
+		return response, nil
+	}
+
+	valueBytes, err := json.Marshal(&info.VInfo)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request json marshal failed: %v", err)
+		return response, nil
+	}
+
+	content := &ContentInfo{
+		ID:    info.ID,
+		Value: string(valueBytes),
+	}
+	err = xhs.logic.CheckContentTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateContentValue(content)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.GetContentFromID(content)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update content failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RunCheckNow(CHECK_TYPE_CONTENT, content.GroupID)
+
+	return response, nil
+}
+
+type DeleteReq struct {
+	ID int64 `json:"id"`
+}
+
+func (xhs *XHttpServer) deleteDomainGroup(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	// the group is gone from db after delete
+	tenantID := xhs.logic.groupTenant(CHECK_TYPE_DOMAIN, info.ID)
+	err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.DeleteDomainGroup(info.ID)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete domain group failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RemoveDomainGroup(info.ID)
+	xhs.logic.TenantGroupEvent(CHECK_TYPE_DOMAIN, info.ID, tenantID, EVENT_ACTION_DELETED)
+	requestLogger(req).With(utils.LOG_GROUP_ID, info.ID).Infof("domain group deleted.\n")
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) deleteDomain(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	domain := &DomainInfo{ID: info.ID}
+	err := xhs.logic.CheckDomainTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.GetDomainFromID(domain)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.DeleteDomain(info.ID)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete domain failed: %v", err)
+		return response, nil
+	}
+	// the checker reloads the domain list of the group
+	xhs.logic.RunCheckNow(CHECK_TYPE_DOMAIN, domain.GroupID)
+	requestLogger(req).With(utils.LOG_GROUP_ID, domain.GroupID).With(utils.LOG_DOMAIN_ID, domain.ID).Infof("domain[%s] deleted.\n", domain.Domain)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) deleteContentGroup(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	// the group is gone from db after delete
+	tenantID := xhs.logic.groupTenant(CHECK_TYPE_CONTENT, info.ID)
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.DeleteContentGroup(info.ID)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete content group failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RemoveContentGroup(info.ID)
+	xhs.logic.TenantGroupEvent(CHECK_TYPE_CONTENT, info.ID, tenantID, EVENT_ACTION_DELETED)
+	requestLogger(req).With(utils.LOG_GROUP_ID, info.ID).Infof("content group deleted.\n")
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) deleteContent(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	content := &ContentInfo{ID: info.ID}
+	err := xhs.logic.CheckContentTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.GetContentFromID(content)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.DeleteContent(info.ID)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete content failed: %v", err)
+		return response, nil
+	}
+	// a deleted row does not move the update time, so publish at once
+	if err := xhs.logic.PublishContent(content.GroupID); err != nil {
+		response.Msg = fmt.Sprintf("content deleted, publish failed: %v", err)
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getHealthHistory(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetHealthHistoryReq struct {
+		GroupID  int64 `json:"groupID"`
+		DomainID int64 `json:"domainID"`
+		Limit    int64 `json:"limit"`
+	}
+	var info GetHealthHistoryReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+	if info.Limit <= 0 || info.Limit > HEALTH_HISTORY_MAX_LIMIT {
+		info.Limit = HEALTH_HISTORY_DEFAULT_LIMIT
+	}
+
+	var err error
+	tenantID := callerTenant(req)
+	switch {
+	case info.DomainID != 0:
+		err = xhs.logic.CheckDomainTenant(tenantID, info.DomainID)
+	case info.GroupID != 0:
+		err = xhs.logic.CheckDomainGroupTenant(tenantID, info.GroupID)
+	case tenantID != TENANT_ALL:
+		// the latest checks of every group are for admins
+		err = fmt.Errorf("groupID or domainID required")
+	}
+	var list []*DomainHealthInfo
+	if err == nil {
+		list, err = xhs.logic.cdb.GetDomainHealthList(info.GroupID, info.DomainID, info.Limit)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get health history failed: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+// importDomains reads the body as text, csv or json by the format param or the Content-Type,
+// and takes group_id, dry_run and allow_shared from the url.
+func (xhs *XHttpServer) importDomains(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	query := req.URL.Query()
+	var groupID int64
+	if v := query.Get("group_id"); v != "" {
+		var err error
+		if groupID, err = strconv.ParseInt(v, 10, 0); err != nil {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("group_id[%s] is not a group id", v)
+			return response, nil
+		}
+	}
+	format := query.Get("format")
+	if format == "" {
+		contentType := req.Header.Get("Content-Type")
+		switch {
+		case strings.Contains(contentType, "csv"):
+			format = DOMAIN_FORMAT_CSV
+		case strings.Contains(contentType, "json"):
+			format = DOMAIN_FORMAT_JSON
+		default:
+			format = DOMAIN_FORMAT_TEXT
+		}
+	}
+	dryRun := query.Get("dry_run") == "1" || query.Get("dry_run") == "true"
+	allowShared := query.Get("allow_shared") == "1" || query.Get("allow_shared") == "true"
+
+	rows, err := ParseDomainImport(io.LimitReader(req.Body, DOMAIN_IMPORT_MAX_BYTES), format)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("import domains parse failed: %v", err)
+		return response, nil
+	}
+	report, err := xhs.logic.ImportDomains(requestLogger(req), groupID, rows, dryRun, allowShared, callerTenant(req))
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("import domains failed: %v", err)
+		return response, nil
+	}
+	requestLogger(req).With(utils.LOG_GROUP_ID, groupID).Infof("import domains dry_run[%v] total[%d] added[%d] duplicate[%d] exists[%d] invalid[%d] failed[%d].\n",
+		dryRun, report.Total, report.Added, report.Duplicate, report.Exists, report.Invalid, report.Failed)
+	response.Data = report
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) exportDomains(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	req.ParseForm()
+	var groupID int64
+	if v := req.Form.Get("group_id"); v != "" {
+		var err error
+		if groupID, err = strconv.ParseInt(v, 10, 0); err != nil {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("group_id[%s] is not a group id", v)
+			return response, nil
+		}
+	}
+	format := req.Form.Get("format")
+	if format != "" && format != DOMAIN_FORMAT_JSON && format != DOMAIN_FORMAT_CSV {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("format[%s] must be %s or %s", format, DOMAIN_FORMAT_JSON, DOMAIN_FORMAT_CSV)
+		return response, nil
+	}
+
+	list, err := xhs.logic.ExportDomains(groupID, callerTenant(req))
+	if err != nil {
+		requestLogger(req).With(utils.LOG_GROUP_ID, groupID).Errorf("export domains error: %v\n", err)
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("export domains error: %v", err)
+		return response, nil
+	}
+
+	if format == DOMAIN_FORMAT_CSV {
+		rsp.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		rsp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=domains_%d.csv", groupID))
+		return nil, WriteDomainExportCSV(rsp, list)
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) setDomainExpiry(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DomainInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+	if info.RegistrationExpiresAt < 0 {
+		response.Code = RES_ERR
+		response.Msg = "registrationExpiresAt must be unix seconds, 0 clears it."
+		return response, nil
+	}
+
+	err := xhs.logic.CheckDomainTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.UpdateDomainRegistrationExpiry(&info)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.GetDomainFromID(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set domain expiry failed: %v", err)
+		return response, nil
+	}
+	// the checker reloads the domain list, which withdraws or restores the domain
+	xhs.logic.RunCheckNow(CHECK_TYPE_DOMAIN, info.GroupID)
+	response.Data = &info
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getExpiringDomains(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	req.ParseForm()
+	days := int64(DOMAIN_EXPIRY_DEFAULT_DAYS)
+	var groupID int64
+	var err error
+	if v := req.Form.Get("days"); v != "" {
+		if days, err = strconv.ParseInt(v, 10, 0); err != nil || days < 0 {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("days[%s] is not a number of days", v)
+			return response, nil
+		}
+	}
+	if v := req.Form.Get("group_id"); v != "" {
+		if groupID, err = strconv.ParseInt(v, 10, 0); err != nil {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("group_id[%s] is not a group id", v)
+			return response, nil
+		}
+	}
+
+	list, err := xhs.logic.ExpiringDomains(days, groupID, callerTenant(req))
+	if err != nil {
+		requestLogger(req).Errorf("get expiring domains error: %v\n", err)
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get expiring domains error: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) probeCerts(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	// the probe runs in the background, it takes a while for many domains
+	xhs.logic.certTask.RunNow()
+	response.Msg = "cert probe started."
+
+	return response, nil
+}
+
+// setShowGroups replaces the show groups of a jump group, keeping its name and type.
+func (xhs *XHttpServer) setShowGroups(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DomainGroupInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	group := &DomainGroupInfo{ID: info.ID}
+	err := xhs.logic.CheckDomainGroupTenant(callerTenant(req), info.ID)
+	if err == nil {
+		err = xhs.logic.cdb.GetDomainGroupFromID(group)
+	}
+	if err == nil {
+		group.ShowGroups = info.ShowGroups
+		group.ShowGroupList = info.ShowGroupList
+		err = xhs.logic.ValidateDomainGroupUpdate(group)
+	}
+	if err == nil {
+		err = xhs.logic.cdb.UpdateDomainGroupInfo(group)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set show groups failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.RunCheckNow(CHECK_TYPE_DOMAIN, info.ID)
+	xhs.logic.GroupEvent(CHECK_TYPE_DOMAIN, info.ID, EVENT_ACTION_UPDATED)
+	requestLogger(req).With(utils.LOG_GROUP_ID, info.ID).Infof("show groups set to [%s].\n", group.ShowListStr)
+	response.Data = group
+
+	return response, nil
+}
+
+// getShowTopology returns the jump to show graph as json, or with format=dot for graphviz.
+func (xhs *XHttpServer) getShowTopology(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	req.ParseForm()
+	topo := xhs.logic.Topology(callerTenant(req))
+	if req.Form.Get("format") == "dot" {
+		rsp.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		return nil, WriteTopologyDot(rsp, topo)
+	}
+	response.Data = topo
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) addTenant(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info TenantInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+
+	err := CheckTenantInfo(&info)
+	if err == nil {
+		err = xhs.logic.cdb.InsertTenant(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("add tenant failed: %v", err)
+		return response, nil
+	}
+	requestLogger(req).Infof("tenant[%d] %s added.\n", info.ID, info.Name)
+	response.Data = &info
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) updateTenant(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info TenantInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	err := CheckTenantInfo(&info)
+	if err == nil {
+		err = xhs.logic.cdb.GetTenantFromID(&TenantInfo{ID: info.ID})
+	}
+	if err == nil {
+		err = xhs.logic.cdb.UpdateTenant(&info)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update tenant failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) deleteTenant(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.DeleteTenant(info.ID)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete tenant failed: %v", err)
+		return response, nil
+	}
+	requestLogger(req).Infof("tenant[%d] deleted.\n", info.ID)
+
+	return response, nil
+}
+
+// getTenants lists the tenants with their usage, a tenant key only sees its own.
+func (xhs *XHttpServer) getTenants(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	list, err := xhs.logic.TenantDetails(callerTenant(req))
+	if err != nil {
+		requestLogger(req).Errorf("get tenants error: %v\n", err)
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get tenants error: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+// addApiKey answers the new key, it cannot be read again. A tenant key adds keys of its tenant only,
+// an admin key adds keys of any tenant, or admin keys with tenantID 0.
+func (xhs *XHttpServer) addApiKey(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type AddApiKeyReq struct {
+		TenantID int64  `json:"tenantID"`
+		Name     string `json:"name"`
+	}
+	var info AddApiKeyReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+	if callerID := callerTenant(req); callerID != TENANT_ALL {
+		if info.TenantID != 0 && info.TenantID != callerID {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("cannot add keys of tenant[%d].", info.TenantID)
+			return response, nil
+		}
+		info.TenantID = callerID
+	}
+
+	key, err := xhs.logic.AddApiKey(requestLogger(req), info.TenantID, info.Name)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("add api key failed: %v", err)
+		return response, nil
+	}
+	response.Data = key
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getApiKeys(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	list, err := xhs.logic.cdb.GetApiKeyList(callerTenant(req))
+	if err != nil {
+		requestLogger(req).Errorf("get api keys error: %v\n", err)
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get api keys error: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) deleteApiKey(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.DeleteApiKey(requestLogger(req), callerTenant(req), info.ID)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete api key failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+// setGroupTenant moves a domain group or content group to a tenant, 0 for no tenant.
+func (xhs *XHttpServer) setGroupTenant(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	// type: domain or content
+	type SetGroupTenantReq struct {
+		Type     string `json:"type"`
+		GroupID  int64  `json:"groupID"`
+		TenantID int64  `json:"tenantID"`
+	}
+	var info SetGroupTenantReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.GroupID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or group id is 0: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.SetGroupTenant(requestLogger(req), info.Type, info.GroupID, info.TenantID)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("set group tenant failed: %v", err)
+		return response, nil
+	}
+	xhs.logic.TenantGroupEvent(info.Type, info.GroupID, info.TenantID, EVENT_ACTION_UPDATED)
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) addWebhook(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info WebhookInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+	if callerID := callerTenant(req); callerID != TENANT_ALL {
+		if info.TenantID != 0 && info.TenantID != callerID {
+			response.Code = RES_ERR
+			response.Msg = fmt.Sprintf("cannot add webhooks of tenant[%d].", info.TenantID)
+			return response, nil
+		}
+		info.TenantID = callerID
+	}
+	info.Enabled = true
+
+	err := xhs.logic.AddWebhook(requestLogger(req), callerTenant(req), &info)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("add webhook failed: %v", err)
+		return response, nil
+	}
+	response.Data = info
+
+	return response, nil
+}
+
+// updateWebhook replaces the url, event types and enabled of a webhook, the secret only when it is given.
+func (xhs *XHttpServer) updateWebhook(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info WebhookInfo
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.UpdateWebhook(callerTenant(req), &info)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("update webhook failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) deleteWebhook(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.DeleteWebhook(requestLogger(req), callerTenant(req), info.ID)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("delete webhook failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) getWebhooks(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	list, err := xhs.logic.cdb.GetWebhookList(callerTenant(req))
+	if err != nil {
+		requestLogger(req).Errorf("get webhooks error: %v\n", err)
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get webhooks error: %v", err)
+		return response, nil
+	}
+	for _, v := range list {
+		v.Secret = ""
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+// getWebhookDeliveries is the delivery log of a webhook, the latest first. status -1 or absent is any status.
+func (xhs *XHttpServer) getWebhookDeliveries(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetWebhookDeliveriesReq struct {
+		WebhookID int64 `json:"webhookID"`
+		Status    int64 `json:"status"`
+		Limit     int64 `json:"limit"`
+	}
+	info := GetWebhookDeliveriesReq{Status: -1}
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.WebhookID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or webhook id is 0: %v", err)
+		return response, nil
+	}
+	if info.Limit <= 0 || info.Limit > WEBHOOK_DELIVERY_MAX_LIMIT {
+		info.Limit = WEBHOOK_DELIVERY_DEFAULT_LIMIT
+	}
+
+	_, err := xhs.logic.GetWebhook(callerTenant(req), info.WebhookID)
+	var list []*WebhookDelivery
+	if err == nil {
+		list, err = xhs.logic.cdb.GetWebhookDeliveryList(info.WebhookID, info.Status, info.Limit)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get webhook deliveries failed: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+func (xhs *XHttpServer) redeliverWebhook(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	var info DeleteReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.ID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or id is 0: %v", err)
+		return response, nil
+	}
+
+	err := xhs.logic.Redeliver(callerTenant(req), info.ID)
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("redeliver webhook failed: %v", err)
+		return response, nil
+	}
+
+	return response, nil
+}
+
+// getPublishHistory is the publish log of a content group, the latest first.
+func (xhs *XHttpServer) getPublishHistory(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetPublishHistoryReq struct {
+		GroupID int64 `json:"groupID"`
+		Limit   int64 `json:"limit"`
+	}
+	var info GetPublishHistoryReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil || info.GroupID == 0 {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed or group id is 0: %v", err)
+		return response, nil
+	}
+	if info.Limit <= 0 || info.Limit > PUBLISH_LOG_MAX_LIMIT {
+		info.Limit = PUBLISH_LOG_DEFAULT_LIMIT
+	}
+
+	err := xhs.logic.CheckContentGroupTenant(callerTenant(req), info.GroupID)
+	var list []*PublishLogInfo
+	if err == nil {
+		list, err = xhs.logic.cdb.GetPublishLogList(info.GroupID, info.Limit)
+	}
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get publish history failed: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
+}
+
+// getAuditLog is the audit log of the tenant of the caller, the latest first. beforeID pages back.
+func (xhs *XHttpServer) getAuditLog(rsp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	response := &Response{Code: RES_OK}
+	type GetAuditLogReq struct {
+		Action   string `json:"action"`
+		BeforeID int64  `json:"beforeID"`
+		Limit    int64  `json:"limit"`
+	}
+	var info GetAuditLogReq
+	if err := xhs.decodeBody(req, &info, nil); err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("Request decode failed: %v", err)
+		return response, nil
+	}
+	if info.Limit <= 0 || info.Limit > AUDIT_LOG_MAX_LIMIT {
+		info.Limit = AUDIT_LOG_DEFAULT_LIMIT
+	}
+
+	list, err := xhs.logic.cdb.GetAuditLogList(&AuditLogQuery{
+		TenantID: callerTenant(req),
+		Action:   info.Action,
+		BeforeID: info.BeforeID,
+		Limit:    info.Limit,
+	})
+	if err != nil {
+		response.Code = RES_ERR
+		response.Msg = fmt.Sprintf("get audit log failed: %v", err)
+		return response, nil
+	}
+	response.Data = list
+
+	return response, nil
 }
@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	EVENT_DOMAIN_STATUS     = "domain_status"
+	EVENT_GROUP             = "group"
+	EVENT_CONTENT_PUBLISHED = "content_published"
+	EVENT_HEALTH_FAILED     = "health_failed"
+	EVENT_CONFIG_RELOADED   = "config_reloaded"
+	// sent instead of events that left the buffer, the client reloads its state
+	EVENT_RESET = "reset"
+)
+
+const (
+	EVENT_ACTION_ADDED   = "added"
+	EVENT_ACTION_UPDATED = "updated"
+	EVENT_ACTION_DELETED = "deleted"
+
+	EVENT_SOURCE_CHECK = "check"
+	EVENT_SOURCE_API   = "api"
+)
+
+const (
+	DEFAULT_EVENT_BUFFER_SIZE = 1024
+	EVENT_KEEPALIVE_INTERVAL  = 15 * time.Second
+	// milliseconds a browser waits before reconnecting
+	EVENT_RETRY_MS = 3000
+)
+
+// EventBus numbers events from 1 and keeps the latest in a ring, so a client reconnecting
+// with the id of the last event it got receives the ones it missed.
+type EventBus struct {
+	sync.Mutex
+	clock  utils.Clock
+	ring   []*Event
+	lastID int64
+	subs   map[chan struct{}]bool
+}
+
+func NewEventBus(clock utils.Clock, size int) *EventBus {
+	if size <= 0 {
+		size = DEFAULT_EVENT_BUFFER_SIZE
+	}
+	return &EventBus{
+		clock: clock,
+		ring:  make([]*Event, size),
+		subs:  make(map[chan struct{}]bool),
+	}
+}
+
+func (eb *EventBus) Publish(eventType string, tenantID int64, data interface{}) *Event {
+	eb.Lock()
+	defer eb.Unlock()
+
+	eb.lastID++
+	ev := &Event{
+		ID:       eb.lastID,
+		Type:     eventType,
+		Time:     eb.clock.Now().Unix(),
+		Data:     data,
+		TenantID: tenantID,
+	}
+	eb.ring[(ev.ID-1)%int64(len(eb.ring))] = ev
+	for c := range eb.subs {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+	return ev
+}
+
+func (eb *EventBus) LastID() int64 {
+	eb.Lock()
+	defer eb.Unlock()
+	return eb.lastID
+}
+
+// Since returns the events after lastID and the id of the newest event. missed is true, with no events,
+// when events after lastID already left the ring, or lastID was handed out before a restart.
+func (eb *EventBus) Since(lastID int64) (events []*Event, last int64, missed bool) {
+	eb.Lock()
+	defer eb.Unlock()
+
+	oldest := eb.lastID - int64(len(eb.ring)) + 1
+	if lastID > eb.lastID || lastID+1 < oldest {
+		return nil, eb.lastID, true
+	}
+	for id := lastID + 1; id <= eb.lastID; id++ {
+		events = append(events, eb.ring[(id-1)%int64(len(eb.ring))])
+	}
+	return events, eb.lastID, false
+}
+
+// Subscribe returns a channel signalled when events are published, cancel stops the signals.
+func (eb *EventBus) Subscribe() (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	eb.Lock()
+	eb.subs[c] = true
+	eb.Unlock()
+	return c, func() {
+		eb.Lock()
+		delete(eb.subs, c)
+		eb.Unlock()
+	}
+}
+
+// eventVisible tells whether a caller of tenantID may see ev, admins see every event.
+func eventVisible(ev *Event, tenantID int64) bool {
+	return tenantID == TENANT_ALL || ev.TenantID == tenantID
+}
+
+// groupTenant is the tenant of a loaded group, or of the group in db when it is not loaded yet.
+func (cl *ControllerLogic) groupTenant(checkType string, groupID int64) int64 {
+	cl.Lock()
+	switch checkType {
+	case CHECK_TYPE_DOMAIN:
+		if v := cl.domainMap[groupID]; v != nil {
+			cl.Unlock()
+			return v.groupInfo.TenantID
+		}
+	case CHECK_TYPE_CONTENT:
+		if v := cl.contentMap[groupID]; v != nil {
+			cl.Unlock()
+			return v.groupInfo.TenantID
+		}
+	}
+	cl.Unlock()
+
+	var tenantID int64
+	var err error
+	if checkType == CHECK_TYPE_DOMAIN {
+		tenantID, err = cl.cdb.GetDomainGroupTenant(groupID)
+	} else {
+		tenantID, err = cl.cdb.GetContentGroupTenant(groupID)
+	}
+	if err != nil {
+		logger.With(utils.LOG_GROUP_ID, groupID).Errorf("get %s group tenant error: %v\n", checkType, err)
+	}
+	return tenantID
+}
+
+// publish sends an event to the clients of the event stream, and to the outbox of the webhooks
+// wanting it, so no delivery hangs on the ring of the stream.
+func (cl *ControllerLogic) publish(eventType string, tenantID int64, data interface{}) {
+	cl.enqueueWebhooks(cl.events.Publish(eventType, tenantID, data))
+}
+
+// GroupEvent tells the clients of the event stream that a group was added or updated.
+func (cl *ControllerLogic) GroupEvent(checkType string, groupID int64, action string) {
+	cl.TenantGroupEvent(checkType, groupID, cl.groupTenant(checkType, groupID), action)
+}
+
+// TenantGroupEvent is GroupEvent for a group whose tenant is known, as one deleted or moved to another tenant.
+func (cl *ControllerLogic) TenantGroupEvent(checkType string, groupID, tenantID int64, action string) {
+	cl.publish(EVENT_GROUP, tenantID, &GroupEvent{
+		Type:    checkType,
+		GroupID: groupID,
+		Action:  action,
+	})
+}
+
+func (cl *ControllerLogic) DomainStatusEvent(info *DomainInfo, tenantID int64, source string) {
+	cl.publish(EVENT_DOMAIN_STATUS, tenantID, &DomainStatusEvent{
+		DomainID: info.ID,
+		GroupID:  info.GroupID,
+		Domain:   info.Domain,
+		Status:   info.Status,
+		Source:   source,
+	})
+}
+
+// DomainStatusChanged publishes the status a domain was set to through the api.
+func (cl *ControllerLogic) DomainStatusChanged(domainID int64) {
+	info := &DomainInfo{ID: domainID}
+	if err := cl.cdb.GetDomainFromID(info); err != nil {
+		logger.With(utils.LOG_DOMAIN_ID, domainID).Errorf("get domain for event error: %v\n", err)
+		return
+	}
+	cl.DomainStatusEvent(info, cl.groupTenant(CHECK_TYPE_DOMAIN, info.GroupID), EVENT_SOURCE_API)
+}
+
+// DomainsStatusChanged publishes the status of every row of domain in the groups tenantID can see.
+func (cl *ControllerLogic) DomainsStatusChanged(domain string, tenantID int64) {
+	list, err := cl.cdb.GetDomainsByName([]string{domain})
+	if err != nil {
+		logger.Errorf("get domain[%s] for event error: %v\n", domain, err)
+		return
+	}
+	for _, v := range list {
+		groupTenant := cl.groupTenant(CHECK_TYPE_DOMAIN, v.GroupID)
+		if tenantID != TENANT_ALL && groupTenant != tenantID {
+			continue
+		}
+		cl.DomainStatusEvent(v, groupTenant, EVENT_SOURCE_API)
+	}
+}
+
+// events streams the events of the controller as server-sent events. Without Last-Event-ID,
+// or the lastEventID parameter for the first request of a browser, it starts with the next event.
+// types limits the stream to some event types, comma separated.
+func (xhs *XHttpServer) events(rsp http.ResponseWriter, req *http.Request) {
+	flusher, ok := rsp.(http.Flusher)
+	closeNotifier, ok2 := rsp.(http.CloseNotifier)
+	if !ok || !ok2 {
+		ResponseJSON(rsp, http.StatusInternalServerError, &Response{Code: RES_ERR, Msg: "streaming is not supported"})
+		return
+	}
+	req.ParseForm()
+	bus := xhs.logic.events
+	lastID := bus.LastID()
+	if v := req.Header.Get("Last-Event-ID"); v != "" || req.Form.Get("lastEventID") != "" {
+		if v == "" {
+			v = req.Form.Get("lastEventID")
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			ResponseJSON(rsp, http.StatusBadRequest, &Response{Code: RES_ERR, Msg: fmt.Sprintf("bad last event id[%s]", v)})
+			return
+		}
+		lastID = id
+	}
+	types := make(map[string]bool)
+	for _, v := range strings.Split(req.Form.Get("types"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			types[v] = true
+		}
+	}
+	tenantID := callerTenant(req)
+
+	notify, cancel := bus.Subscribe()
+	defer cancel()
+	keepalive := xhs.logic.clock.NewTicker(EVENT_KEEPALIVE_INTERVAL)
+	defer keepalive.Stop()
+	closed := closeNotifier.CloseNotify()
+
+	rsp.Header().Set("Content-Type", "text/event-stream")
+	rsp.Header().Set("Cache-Control", "no-cache")
+	rsp.Header().Set("Access-Control-Allow-Origin", "*")
+	// nginx would hold the stream back
+	rsp.Header().Set("X-Accel-Buffering", "no")
+	rsp.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rsp, "retry: %d\n\n", EVENT_RETRY_MS)
+	log := requestLogger(req)
+	log.Debugf("event stream from[%d] tenant[%d] started.\n", lastID, tenantID)
+	for {
+		events, last, missed := bus.Since(lastID)
+		if missed {
+			events = []*Event{{ID: last, Type: EVENT_RESET, Time: xhs.logic.clock.Now().Unix()}}
+		}
+		for _, ev := range events {
+			if ev.Type != EVENT_RESET && (!eventVisible(ev, tenantID) || len(types) != 0 && !types[ev.Type]) {
+				continue
+			}
+			if err := writeEvent(rsp, ev); err != nil {
+				log.Debugf("event stream write error: %v\n", err)
+				return
+			}
+		}
+		lastID = last
+		flusher.Flush()
+
+		select {
+		case <-notify:
+		case <-keepalive.Chan():
+			// the id moves a reconnecting client past the events it did not see
+			fmt.Fprintf(rsp, ": keepalive\nid: %d\n\n", lastID)
+		case <-closed:
+			log.Debugf("event stream closed by client.\n")
+			return
+		case <-xhs.logic.stop:
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+func TestEventBusSince(t *testing.T) {
+	eb := NewEventBus(utils.NewFakeClock(time.Unix(1000, 0)), 3)
+	if events, last, missed := eb.Since(0); len(events) != 0 || last != 0 || missed {
+		t.Errorf("empty bus: got %d events, last %d, missed %v", len(events), last, missed)
+	}
+	for i := 0; i < 5; i++ {
+		eb.Publish(EVENT_GROUP, 0, nil)
+	}
+	events, last, missed := eb.Since(2)
+	if missed || last != 5 || len(events) != 3 || events[0].ID != 3 || events[2].ID != 5 {
+		t.Errorf("since 2: got %d events, last %d, missed %v", len(events), last, missed)
+	}
+	if events, _, _ := eb.Since(5); len(events) != 0 {
+		t.Errorf("since the last event: got %d events", len(events))
+	}
+	// 2 left the ring
+	if _, last, missed := eb.Since(1); !missed || last != 5 {
+		t.Errorf("since 1: got last %d, missed %v", last, missed)
+	}
+	// an id of before a restart
+	if _, _, missed := eb.Since(9); !missed {
+		t.Errorf("since 9 is not missed")
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1000, 0))
+	cl := &ControllerLogic{clock: clock, events: NewEventBus(clock, 8), stop: make(chan struct{})}
+	xhs := &XHttpServer{logic: cl}
+	ts := httptest.NewServer(http.HandlerFunc(xhs.events))
+	defer ts.Close()
+
+	cl.events.Publish(EVENT_GROUP, 7, &GroupEvent{Type: CHECK_TYPE_DOMAIN, GroupID: 1, Action: EVENT_ACTION_ADDED})
+	cl.events.Publish(EVENT_GROUP, 8, &GroupEvent{Type: CHECK_TYPE_DOMAIN, GroupID: 2, Action: EVENT_ACTION_ADDED})
+	cl.events.Publish(EVENT_CONTENT_PUBLISHED, 7, &ContentPublishedEvent{GroupID: 3})
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Last-Event-ID", "0")
+	req.Header.Set(TENANT_HEADER, "7")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	if ct := rsp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %s", ct)
+	}
+	r := bufio.NewReader(rsp.Body)
+	readEvent := func() []string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return lines
+			}
+			lines = append(lines, line)
+		}
+	}
+	if got := readEvent(); len(got) != 1 || got[0] != "retry: 3000" {
+		t.Errorf("got %v, want the retry first", got)
+	}
+	// the event of tenant 8 is skipped
+	if got := readEvent(); len(got) != 3 || got[0] != "id: 1" || got[1] != "event: group" ||
+		!strings.Contains(got[2], `"groupID":1`) {
+		t.Errorf("got %v", got)
+	}
+	if got := readEvent(); len(got) != 3 || got[0] != "id: 3" || got[1] != "event: content_published" {
+		t.Errorf("got %v", got)
+	}
+
+	cl.events.Publish(EVENT_HEALTH_FAILED, 7, &DomainHealthInfo{DomainID: 4})
+	if got := readEvent(); len(got) != 3 || got[0] != "id: 4" || got[1] != "event: health_failed" {
+		t.Errorf("got %v, want the event published after connecting", got)
+	}
+}
+
+func TestEventsStreamReset(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1000, 0))
+	cl := &ControllerLogic{clock: clock, events: NewEventBus(clock, 2), stop: make(chan struct{})}
+	xhs := &XHttpServer{logic: cl}
+	ts := httptest.NewServer(http.HandlerFunc(xhs.events))
+	defer ts.Close()
+
+	for i := 0; i < 4; i++ {
+		cl.events.Publish(EVENT_GROUP, 0, nil)
+	}
+	rsp, err := http.Get(ts.URL + "?lastEventID=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	r := bufio.NewReader(rsp.Body)
+	var lines []string
+	for len(lines) < 4 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if line = strings.TrimSuffix(line, "\n"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if lines[1] != "id: 4" || lines[2] != "event: reset" {
+		t.Errorf("got %v, want a reset to the last id", lines)
+	}
+
+	rsp2, err := http.Get(ts.URL + "?lastEventID=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp2.Body.Close()
+	if rsp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad id: got status %d", rsp2.StatusCode)
+	}
+}
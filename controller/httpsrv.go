@@ -20,11 +20,17 @@ func (hs *HttpSrv) Run() {
 	if hs.HttpPort != 0 {
 		addr = fmt.Sprintf("%s:%d", hs.HttpAddr, hs.HttpPort)
 	}
-	for p, f := range hs.Routers {
-		http.Handle(p, f)
-	}
-	err := http.ListenAndServe(addr, nil)
+	err := http.ListenAndServe(addr, hs.Handler())
 	if err != nil {
 		panic(err)
 	}
 }
+
+// Handler serves the routes, tests run it in an httptest server.
+func (hs *HttpSrv) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for p, f := range hs.Routers {
+		mux.Handle(p, f)
+	}
+	return mux
+}
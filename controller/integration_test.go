@@ -0,0 +1,643 @@
+//go:build integration
+// +build integration
+
+package controller
+
+// The integration tests boot ControllerLogic with its http api against a real mysql, an in-memory
+// publisher for oss and an httptest stub of the /mt.do check service. Every test creates its own
+// database and drops it at the end, so they need a mysql user allowed to create databases:
+//
+//	docker run -d -p 3306:3306 -e MYSQL_ALLOW_EMPTY_PASSWORD=yes mysql:5.7
+//	XRC_TEST_MYSQL_HOST=127.0.0.1:3306 go test -tags integration ./controller/
+//
+// XRC_TEST_MYSQL_USER and XRC_TEST_MYSQL_PASS default to root and no password. The clock is fake,
+// checks, publishes and refreshes only run when a test asks for them.
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/client"
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
+)
+
+// SCHEMA_FILES builds the tables of the current release, in the order the files were added to sql/.
+var SCHEMA_FILES = []string{
+	"schema.sql",
+	"check_interval.sql",
+	"content_order.sql",
+	"content_schedule.sql",
+	"content_formats.sql",
+	"serve_stats.sql",
+	"domain_health_log.sql",
+	"domain_expiry.sql",
+	"domain_group_show.sql",
+	"tenant.sql",
+	"webhook.sql",
+	"audit_log.sql",
+	"content_publish_log.sql",
+}
+
+const (
+	TEST_OSS_URL      = "http://oss.test/"
+	TEST_WAIT_TIMEOUT = 5 * time.Second
+)
+
+// memPublisher keeps published objects in memory, fail makes every publish fail.
+type memPublisher struct {
+	sync.Mutex
+	objects map[string]*PublishObject
+	fail    error
+}
+
+func newMemPublisher() *memPublisher {
+	return &memPublisher{objects: make(map[string]*PublishObject)}
+}
+
+func (p *memPublisher) Publish(obj *PublishObject) (string, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.fail != nil {
+		return "", p.fail
+	}
+	o := *obj
+	p.objects[obj.Name] = &o
+	return TEST_OSS_URL + obj.Name, nil
+}
+
+func (p *memPublisher) BaseUrl() string {
+	return TEST_OSS_URL
+}
+
+func (p *memPublisher) object(name string) *PublishObject {
+	p.Lock()
+	defer p.Unlock()
+	return p.objects[name]
+}
+
+func (p *memPublisher) setFail(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.fail = err
+}
+
+// checkService answers /mt.do like the check service, [0] for domains without a result.
+type checkService struct {
+	*httptest.Server
+
+	sync.Mutex
+	results map[string]string
+	calls   map[string]int
+}
+
+func newCheckService() *checkService {
+	cs := &checkService{
+		results: make(map[string]string),
+		calls:   make(map[string]int),
+	}
+	cs.Server = httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/mt.do" {
+			http.NotFound(rsp, req)
+			return
+		}
+		domain := req.URL.Query().Get("url")
+		cs.Lock()
+		defer cs.Unlock()
+		cs.calls[domain]++
+		result, ok := cs.results[domain]
+		if !ok {
+			result = DOMAIN_CHECK_OK
+		}
+		fmt.Fprintf(rsp, "%s\n", result)
+	}))
+	return cs
+}
+
+func (cs *checkService) set(domain, result string) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.results[domain] = result
+}
+
+func (cs *checkService) callsOf(domain string) int {
+	cs.Lock()
+	defer cs.Unlock()
+	return cs.calls[domain]
+}
+
+type integration struct {
+	t      *testing.T
+	db     *sql.DB
+	dbName string
+
+	clock   *utils.FakeClock
+	oss     *memPublisher
+	checker *checkService
+	cl      *ControllerLogic
+	api     *httptest.Server
+	c       *client.Client
+}
+
+func newIntegration(t *testing.T) *integration {
+	host := os.Getenv("XRC_TEST_MYSQL_HOST")
+	if host == "" {
+		t.Skip("XRC_TEST_MYSQL_HOST is not set")
+	}
+	mysqlInfo := utils.MysqlInfo{
+		Host:   host,
+		User:   os.Getenv("XRC_TEST_MYSQL_USER"),
+		Pass:   os.Getenv("XRC_TEST_MYSQL_PASS"),
+		DBName: fmt.Sprintf("xrc_test_%d", time.Now().UnixNano()),
+	}
+	if mysqlInfo.User == "" {
+		mysqlInfo.User = utils.DefaultUser
+	}
+	dsn := mysqlInfo.User + ":" + mysqlInfo.Pass + "@tcp(" + host + ")/"
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := &integration{t: t, db: db, dbName: mysqlInfo.DBName}
+	if _, err := db.Exec("CREATE DATABASE " + it.dbName + " DEFAULT CHARSET utf8"); err != nil {
+		db.Close()
+		t.Fatalf("create database: %v", err)
+	}
+	if err := loadSchema(dsn + it.dbName); err != nil {
+		it.dropDB()
+		t.Fatalf("load schema: %v", err)
+	}
+
+	it.clock = utils.NewFakeClock(time.Now())
+	it.oss = newMemPublisher()
+	it.checker = newCheckService()
+	cfg := &config.Config{
+		CheckDomainUrls: []string{strings.TrimPrefix(it.checker.URL, "http://")},
+		RefreshInterval: 1,
+		MysqlInfo:       mysqlInfo,
+		IPFilterConfig:  config.IPFilterConfig{IPDB: TEST_IP_DB},
+	}
+	it.cl = newControllerLogic(cfg, &logicDeps{
+		clock:     it.clock,
+		publisher: it.oss,
+		certProbe: func(domain string) (int64, error) {
+			return it.clock.Now().Add(90 * 24 * time.Hour).Unix(), nil
+		},
+	})
+	it.api = httptest.NewServer(it.cl.xServer.Handler())
+	it.c = client.NewClient(&client.Profile{Url: it.api.URL, Timeout: 10})
+
+	return it
+}
+
+func loadSchema(dsn string) error {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, name := range SCHEMA_FILES {
+		data, err := ioutil.ReadFile(filepath.Join("..", "sql", name))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range strings.Split(string(data), ";\n") {
+			if !hasSQL(stmt) {
+				continue
+			}
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasSQL is false for the comments after the last statement of a file.
+func hasSQL(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *integration) Close() {
+	it.api.Close()
+	it.cl.Stop()
+	it.cl.sched.Stop()
+	it.checker.Close()
+	it.dropDB()
+}
+
+func (it *integration) dropDB() {
+	if _, err := it.db.Exec("DROP DATABASE " + it.dbName); err != nil {
+		it.t.Errorf("drop database %s: %v", it.dbName, err)
+	}
+	it.db.Close()
+}
+
+func (it *integration) call(path string, req, out interface{}) {
+	if err := it.c.Call(path, req, out); err != nil {
+		it.t.Fatalf("%s: %v", path, err)
+	}
+}
+
+func (it *integration) domainGroupID(name string) int64 {
+	var list []*DomainGroupInfo
+	it.call("/domain/get_domain_groups", nil, &list)
+	for _, v := range list {
+		if v.Name == name {
+			return v.ID
+		}
+	}
+	it.t.Fatalf("no domain group %s", name)
+	return 0
+}
+
+func (it *integration) contentGroupID(name string) int64 {
+	var list []*ContentGroupInfo
+	it.call("/domain/get_content_group", nil, &list)
+	for _, v := range list {
+		if v.Name == name {
+			return v.ID
+		}
+	}
+	it.t.Fatalf("no content group %s", name)
+	return 0
+}
+
+func (it *integration) addDomainGroup(name string, domains ...string) int64 {
+	it.call("/domain/add_domain_group", map[string]interface{}{"name": name}, nil)
+	id := it.domainGroupID(name)
+	for _, d := range domains {
+		it.call("/domain/add_domain", map[string]interface{}{"groupID": id, "domain": d}, nil)
+	}
+	return id
+}
+
+// getURL asks get_url for a domain, an empty domain when the controller has none.
+func (it *integration) getURL(groupID, t int64) string {
+	var info DomainInfo
+	if err := it.c.Call("/domain/get_url", map[string]interface{}{"groupID": groupID, "type": t}, &info); err != nil {
+		if strings.Contains(err.Error(), "no useful") {
+			return ""
+		}
+		it.t.Fatalf("get_url: %v", err)
+	}
+	return info.Domain
+}
+
+func (it *integration) getURLs(groupID, t int64, n int) []string {
+	var list []string
+	for i := 0; i < n; i++ {
+		list = append(list, it.getURL(groupID, t))
+	}
+	return list
+}
+
+func (it *integration) checkNow(checkType string, groupID int64) {
+	it.call("/domain/check_now", map[string]interface{}{"type": checkType, "groupID": groupID}, nil)
+}
+
+// refresh lets the refresh interval pass, and waits until the run loop waits for the next one.
+func (it *integration) refresh() {
+	it.waitFor("run loop waiting on the clock", func() bool { return it.clock.Waiters() >= 2 })
+	it.clock.Advance(time.Duration(it.cl.Config().RefreshInterval) * time.Second)
+	it.waitFor("refresh done", func() bool { return it.clock.Waiters() >= 2 })
+}
+
+// waitFor polls cond, the checkers and the run loop work in their own goroutines.
+func (it *integration) waitFor(what string, cond func() bool) {
+	deadline := time.Now().Add(TEST_WAIT_TIMEOUT)
+	for !cond() {
+		if time.Now().After(deadline) {
+			it.t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+func TestIntegrationGetURLRotation(t *testing.T) {
+	it := newIntegration(t)
+	defer it.Close()
+
+	a := it.addDomainGroup("a", "a1.example.com", "a2.example.com")
+	b := it.addDomainGroup("b", "b1.example.com")
+	jump := it.addDomainGroup("jump", "j1.example.com")
+	it.call("/domain/update_domain_group", map[string]interface{}{
+		"id":         jump,
+		"name":       "jump",
+		"type":       DOMAIN_GROUP_TYPE_JUMP,
+		"showGroups": []map[string]int64{{"showGroupID": b, "weight": 1}},
+	}, nil)
+	if d := it.getURL(0, DOMAIN_GROUP_TYPE_SHOW); d != "" {
+		t.Fatalf("got %s before the groups are loaded", d)
+	}
+	it.refresh()
+
+	got := it.getURLs(a, DOMAIN_GROUP_TYPE_SHOW, 3)
+	if want := []string{"a1.example.com", "a2.example.com", "a1.example.com"}; !equalStrings(got, want) {
+		t.Errorf("group a: got %v, want %v", got, want)
+	}
+	if got := it.getURL(b, DOMAIN_GROUP_TYPE_SHOW); got != "b1.example.com" {
+		t.Errorf("group b: got %s", got)
+	}
+	groups := make(map[string]int)
+	for _, d := range it.getURLs(0, DOMAIN_GROUP_TYPE_SHOW, 4) {
+		groups[d[:1]]++
+	}
+	if groups["a"] != 2 || groups["b"] != 2 {
+		t.Errorf("show groups do not take turns: %v", groups)
+	}
+	var info DomainInfo
+	it.call("/domain/get_url", map[string]interface{}{"type": DOMAIN_GROUP_TYPE_JUMP}, &info)
+	if info.Domain != "j1.example.com" || info.ShowGroupID != b {
+		t.Errorf("jump: got %s showing group %d", info.Domain, info.ShowGroupID)
+	}
+}
+
+func TestIntegrationHealthFailover(t *testing.T) {
+	it := newIntegration(t)
+	defer it.Close()
+
+	a := it.addDomainGroup("a", "a1.example.com", "a2.example.com")
+	it.refresh()
+	if got := it.getURLs(a, DOMAIN_GROUP_TYPE_SHOW, 2); !equalStrings(got, []string{"a1.example.com", "a2.example.com"}) {
+		t.Fatalf("before checks: got %v", got)
+	}
+
+	it.checker.set("a1.example.com", DOMAIN_CHECK_BLACK)
+	it.checkNow(CHECK_TYPE_DOMAIN, a)
+	it.waitFor("a1 taken down", func() bool {
+		return equalStrings(it.getURLs(a, DOMAIN_GROUP_TYPE_SHOW, 2), []string{"a2.example.com", "a2.example.com"})
+	})
+	var list DomainList
+	it.call("/domain/get_domain_list", map[string]interface{}{"groupID": a}, &list)
+	for _, v := range list.DomainList {
+		want := int64(DOMAIN_STATUS_OK)
+		if v.Domain == "a1.example.com" {
+			want = DOMAIN_STATUS_DOWN
+		}
+		if v.Status != want {
+			t.Errorf("%s: status %d, want %d", v.Domain, v.Status, want)
+		}
+	}
+	var history []*DomainHealthInfo
+	it.call("/domain/get_health_history", map[string]interface{}{"groupID": a}, &history)
+	// the answer of the check service, then the domain going down
+	results := make(map[string]bool)
+	for _, v := range history {
+		if v.Domain != "a1.example.com" {
+			t.Errorf("health history of %s", v.Domain)
+		}
+		results[v.Result] = true
+	}
+	if !results[DOMAIN_HEALTH_RESULT_BLACK] || !results[DOMAIN_HEALTH_RESULT_DOWN] {
+		t.Errorf("health history results: %v", results)
+	}
+
+	// down domains are not checked again, the last one going gray empties the group
+	calls := it.checker.callsOf("a1.example.com")
+	it.checker.set("a2.example.com", DOMAIN_CHECK_GRAY)
+	it.checkNow(CHECK_TYPE_DOMAIN, a)
+	it.waitFor("a2 taken down", func() bool { return it.getURL(a, DOMAIN_GROUP_TYPE_SHOW) == "" })
+	if n := it.checker.callsOf("a1.example.com"); n != calls {
+		t.Errorf("down domain checked %d more times", n-calls)
+	}
+
+	// a query error of the check service keeps the domain
+	b := it.addDomainGroup("b", "b1.example.com")
+	it.checker.set("b1.example.com", DOMAIN_CHECK_QUERY_ERROR)
+	it.refresh()
+	it.checkNow(CHECK_TYPE_DOMAIN, b)
+	it.waitFor("b1 checked", func() bool { return it.checker.callsOf("b1.example.com") > 0 })
+	if got := it.getURL(b, DOMAIN_GROUP_TYPE_SHOW); got != "b1.example.com" {
+		t.Errorf("query error took b1 down, got %q", got)
+	}
+}
+
+func TestIntegrationContentPublish(t *testing.T) {
+	it := newIntegration(t)
+	defer it.Close()
+
+	it.call("/domain/add_content_group", map[string]interface{}{"name": "videos", "formats": []string{"json", "rss"}}, nil)
+	id := it.contentGroupID("videos")
+	it.refresh()
+	// a loaded group publishes at once
+	if it.oss.object("videos.json") == nil || it.oss.object("videos.rss") == nil {
+		t.Fatalf("videos not published when loaded")
+	}
+
+	video := map[string]interface{}{"title": "first video", "videoSrc": "http://v.test/1.mp4"}
+	it.call("/domain/add_video_content", map[string]interface{}{"groupID": id, "video": video}, nil)
+	var list ContentList
+	it.call("/domain/get_content_list", map[string]interface{}{"groupID": id}, &list)
+	if len(list.ContentList) != 1 {
+		t.Fatalf("content list: %+v", list)
+	}
+	// a setting of pinned alone keeps the content enabled
+	it.call("/domain/setting_content", map[string]interface{}{"id": list.ContentList[0].ID, "pinned": true}, nil)
+	it.call("/domain/get_content_list", map[string]interface{}{"groupID": id}, &list)
+	if v := list.ContentList[0]; !v.Enabled || !v.Pinned {
+		t.Errorf("after pinning: %+v", v)
+	}
+	if err := it.c.Call("/domain/setting_content", map[string]interface{}{"id": 999999, "pinned": true}, nil); err == nil {
+		t.Errorf("setting of a missing content succeeded")
+	}
+	it.call("/domain/publish_content", map[string]interface{}{"groupID": id}, nil)
+	for _, name := range []string{"videos.json", "videos.rss"} {
+		obj := it.oss.object(name)
+		if obj == nil || !strings.Contains(string(obj.Data), "first video") {
+			t.Errorf("%s does not have the video: %+v", name, obj)
+		}
+		gz := it.oss.object(name + ".gz")
+		if gz == nil || gz.ContentEncoding != "gzip" {
+			t.Errorf("%s.gz: %+v", name, gz)
+		}
+	}
+
+	var content RealContentInfo
+	it.call("/domain/get_data", map[string]interface{}{"contentGroupID": id}, &content)
+	if content.ContentUrl != TEST_OSS_URL+"videos.json" {
+		t.Errorf("get_data content url: %s", content.ContentUrl)
+	}
+
+	it.oss.setFail(fmt.Errorf("oss is down"))
+	if err := it.c.Call("/domain/publish_content", map[string]interface{}{"groupID": id}, nil); err == nil || !strings.Contains(err.Error(), "oss is down") {
+		t.Errorf("publish with oss down: %v", err)
+	}
+	var states []PublishState
+	it.call("/domain/get_publish_status", map[string]interface{}{"groupID": id}, &states)
+	if len(states) != 1 || states[0].ConsecutiveFailures != 1 || states[0].LastSuccess == 0 || states[0].JsonUrl != content.ContentUrl {
+		t.Errorf("publish status: %+v", states)
+	}
+
+	it.oss.setFail(nil)
+	it.call("/domain/publish_content", map[string]interface{}{"groupID": id}, nil)
+	it.call("/domain/get_publish_status", map[string]interface{}{"groupID": id}, &states)
+	if len(states) != 1 || states[0].ConsecutiveFailures != 0 {
+		t.Errorf("publish status after recovery: %+v", states)
+	}
+}
+
+func TestIntegrationRefresh(t *testing.T) {
+	it := newIntegration(t)
+	defer it.Close()
+
+	a := it.addDomainGroup("a", "a1.example.com")
+	it.refresh()
+	if got := it.getURL(a, DOMAIN_GROUP_TYPE_SHOW); got != "a1.example.com" {
+		t.Fatalf("got %q", got)
+	}
+
+	// groups added later are loaded by the next refresh
+	b := it.addDomainGroup("b", "b1.example.com")
+	it.call("/domain/add_content_group", map[string]interface{}{"name": "later"}, nil)
+	cg := it.contentGroupID("later")
+	if got := it.getURL(b, DOMAIN_GROUP_TYPE_SHOW); got != "" {
+		t.Errorf("group b handed out before refresh: %s", got)
+	}
+	if err := it.c.Call("/domain/get_data", map[string]interface{}{"contentGroupID": cg}, nil); err == nil {
+		t.Errorf("content group served before refresh")
+	}
+	it.refresh()
+	if got := it.getURL(b, DOMAIN_GROUP_TYPE_SHOW); got != "b1.example.com" {
+		t.Errorf("group b after refresh: got %q", got)
+	}
+	var content RealContentInfo
+	it.call("/domain/get_data", map[string]interface{}{"contentGroupID": cg}, &content)
+	if content.ContentUrl != TEST_OSS_URL+"later.json" {
+		t.Errorf("content url after refresh: %s", content.ContentUrl)
+	}
+
+	// domains added to a loaded group come with its next check
+	it.call("/domain/add_domain", map[string]interface{}{"groupID": a, "domain": "a2.example.com"}, nil)
+	it.checkNow(CHECK_TYPE_DOMAIN, a)
+	it.waitFor("a2 loaded", func() bool {
+		got := it.getURLs(a, DOMAIN_GROUP_TYPE_SHOW, 2)
+		return got[0] != got[1]
+	})
+}
+
+func TestIntegrationWebhook(t *testing.T) {
+	it := newIntegration(t)
+	defer it.Close()
+
+	var mu sync.Mutex
+	var bodies []string
+	status := http.StatusInternalServerError
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Header.Get(WEBHOOK_SIGNATURE_HEADER) != SignWebhook(secret, body) {
+			t.Errorf("bad signature %s", req.Header.Get(WEBHOOK_SIGNATURE_HEADER))
+		}
+		bodies = append(bodies, string(body))
+		rsp.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	var wh WebhookInfo
+	it.call("/domain/add_webhook", map[string]interface{}{
+		"url":        receiver.URL,
+		"eventTypes": []string{EVENT_DOMAIN_STATUS},
+	}, &wh)
+	mu.Lock()
+	secret = wh.Secret
+	mu.Unlock()
+	if secret == "" {
+		t.Fatalf("no secret generated: %+v", wh)
+	}
+
+	a := it.addDomainGroup("a", "a1.example.com", "a2.example.com")
+	it.refresh()
+	it.checker.set("a1.example.com", DOMAIN_CHECK_BLACK)
+	it.checkNow(CHECK_TYPE_DOMAIN, a)
+
+	deliveries := func() []*WebhookDelivery {
+		var list []*WebhookDelivery
+		it.call("/domain/get_webhook_deliveries", map[string]interface{}{"webhookID": wh.ID}, &list)
+		return list
+	}
+	// the receiver fails, the delivery waits for its retry
+	it.waitFor("first attempt", func() bool {
+		list := deliveries()
+		return len(list) == 1 && list[0].Attempts == 1
+	})
+	d := deliveries()[0]
+	if d.Status != WEBHOOK_DELIVERY_PENDING || d.ResponseCode != http.StatusInternalServerError || d.EventType != EVENT_DOMAIN_STATUS {
+		t.Errorf("failed delivery: %+v", d)
+	}
+
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	it.call("/domain/redeliver_webhook", map[string]interface{}{"id": d.ID}, nil)
+	it.waitFor("delivered", func() bool { return deliveries()[0].Status == WEBHOOK_DELIVERY_DELIVERED })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || bodies[0] != bodies[1] || !strings.Contains(bodies[1], `"domain":"a1.example.com"`) {
+		t.Errorf("bodies: %v", bodies)
+	}
+}
+
+func TestIntegrationServeStatsTenant(t *testing.T) {
+	it := newIntegration(t)
+	defer it.Close()
+
+	cdb := it.cl.cdb
+	mine := &DomainGroupInfo{Name: "mine", TenantID: 7}
+	other := &DomainGroupInfo{Name: "other", TenantID: 8}
+	content := &ContentGroupInfo{Name: "mine", TenantID: 7}
+	for _, err := range []error{cdb.InsertDomainGroup(mine), cdb.InsertDomainGroup(other), cdb.InsertContentGroup(content)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	minute := it.clock.Now().Unix() / 60 * 60
+	err := cdb.InsertServeStats([]*ServeStatInfo{
+		{Time: minute, Kind: SERVE_STAT_DOMAIN, GroupID: mine.ID, DomainID: 1, Count: 1},
+		{Time: minute, Kind: SERVE_STAT_DOMAIN, GroupID: other.ID, DomainID: 2, Count: 2},
+		{Time: minute, Kind: SERVE_STAT_CONTENT, GroupID: content.ID, Count: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := &ServeStatQuery{From: minute, To: minute + 60, Step: 60, TenantID: 7}
+	list, err := cdb.GetServeStats(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counts []int64
+	for _, v := range list {
+		counts = append(counts, v.Count)
+	}
+	// content rows sort before domain rows
+	if !equalIDs(counts, []int64{3, 1}) {
+		t.Errorf("tenant 7 got counts %v", counts)
+	}
+	query.TenantID = TENANT_ALL
+	if list, err = cdb.GetServeStats(query); err != nil || len(list) != 3 {
+		t.Errorf("admin got %d rows %v", len(list), err)
+	}
+}
@@ -1,19 +1,28 @@
 package controller
 
 import (
-	"fmt"
-	"github.com/wangtuanjie/ip17mon"
+	"os"
 	"testing"
+
+	"github.com/wangtuanjie/ip17mon"
 )
 
+// the ip db of the repo, as set by IPDB of the config
+const TEST_IP_DB = "../17monipdb.dat"
+
 func TestIP(t *testing.T) {
-	if err := ip17mon.Init("/Users/reezhou/Desktop/xman/src/github.com/reechou/x-real-control/17monipdb.dat"); err != nil {
-		panic(err)
+	if _, err := os.Stat(TEST_IP_DB); err != nil {
+		t.Skipf("no ip db: %v", err)
+	}
+	if err := ip17mon.Init(TEST_IP_DB); err != nil {
+		t.Fatalf("init ip db: %v", err)
 	}
 	loc, err := ip17mon.Find("60.177.43.30")
 	if err != nil {
-		fmt.Println("err:", err)
-		return
+		t.Fatal(err)
+	}
+	// FilterLocation of the config lists cities like this
+	if loc.City != "杭州" {
+		t.Errorf("got %+v", loc)
 	}
-	fmt.Println(loc)
 }
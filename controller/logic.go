@@ -2,8 +2,12 @@ package controller
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
@@ -17,13 +21,28 @@ const (
 	CacheDir = ".cache"
 )
 
+const (
+	DEFAULT_CHECK_INTERVAL   = time.Minute
+	DEFAULT_REFRESH_INTERVAL = 30 * time.Second
+)
+
+const (
+	CHECK_TYPE_DOMAIN  = "domain"
+	CHECK_TYPE_CONTENT = "content"
+)
+
 var plog = capnslog.NewPackageLogger("github.com/reezhou/x-real-control", "controller")
 
+// logger adds the group, domain and request of the work to log lines
+var logger = utils.NewLogger(plog, "controller")
+
 type DomainMapInfo struct {
 	groupInfo  *DomainGroupInfo
 	domainList *DomainList
 	dhc        *DomainCheckHealth
 	idx        int64
+	// running weights of the show groups of a jump group
+	showWeights map[int64]int64
 }
 
 type ContentMapInfo struct {
@@ -35,66 +54,160 @@ type ContentMapInfo struct {
 type ControllerLogic struct {
 	sync.Mutex
 
-	cfg *config.Config
+	cfgMutex       sync.RWMutex
+	cfg            *config.Config
+	trustedProxies TrustedProxies
+	lastReload     *ConfigReloadInfo
+	clock          utils.Clock
 
-	aliyunOss *config.AliyunOss
+	aliyunOss    *config.AliyunOss
+	ossPublisher *OssPublisher
+	publisher    Publisher
+	// bucket provisioning error, publishing is degraded while it is set
+	provisionErr error
+	contentCache *ContentCache
 
 	detector *detector.Detector
 	cdb      *ControllerDB
-	w        *utils.TimingWheel
+	sched    *utils.Scheduler
 	xServer  *XHttpServer
 
+	stats     *ServeStats
+	statsTask *utils.Task
+	events    *EventBus
+
+	// refreshes run by the loop, and those which met an error
+	refreshes     int64
+	refreshErrors int64
+
+	certProbe    CertProbe
+	certTask     *utils.Task
+	probingCerts int32
+
+	webhookClient *http.Client
+	// for webhooks of tenants, reaches public addresses only
+	tenantWebhookClient *http.Client
+	webhookTask         *utils.Task
+	deliveringWebhooks  int32
+	outbox              WebhookOutbox
+
+	webhookMutex sync.RWMutex
+	// every webhook, looked up on each event
+	webhooks []*WebhookInfo
+
+	publicLimiter *utils.RateLimiter
+	adminLimiter  *utils.RateLimiter
+
+	keyMutex sync.RWMutex
+	// api keys by their sha256
+	apiKeys  map[string]*ApiKeyInfo
+	sessions *AdminSessions
+
+	// round robin positions are kept per tenant, so callers of a tenant take turns among its groups
 	domainMap       map[int64]*DomainMapInfo
 	domainGroupList []int64
-	domainGroupIdx  int64
+	domainGroupIdx  map[int64]int64
 	jumpDomainGroup []int64
-	jumpDomainIdx   int64
+	jumpDomainIdx   map[int64]int64
 	groupMaxID      int64
 
 	contentMap        map[int64]*ContentMapInfo
 	contentGroupList  []int64
-	contentGroupIdx   int64
+	contentGroupIdx   map[int64]int64
 	contentGroupMaxID int64
 
 	stop chan struct{}
 	done chan struct{}
 }
 
+// logicDeps are what the controller talks to besides mysql, tests replace them with fakes.
+// A nil publisher publishes to the aliyun oss of the config.
+type logicDeps struct {
+	clock     utils.Clock
+	publisher Publisher
+	certProbe CertProbe
+}
+
 func NewControllerLogic(cfg *config.Config) *ControllerLogic {
-	w := utils.NewTimingWheel(500*time.Millisecond, 120)
+	cl := newControllerLogic(cfg, &logicDeps{clock: utils.RealClock, certProbe: ProbeCert})
+	touchCacheDir()
+
+	return cl
+}
+
+func newControllerLogic(cfg *config.Config, deps *logicDeps) *ControllerLogic {
+	setupLogging(cfg)
+	trustedProxies, err := ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		plog.Panicf("trusted proxies error: %v\n", err)
+	}
+	clock := deps.clock
+	sched := utils.NewScheduler(clock, 500*time.Millisecond, 120)
 	d := detector.NewDetector(cfg)
 	cl := &ControllerLogic{
-		cfg:              cfg,
-		aliyunOss:        &cfg.AliyunOss,
-		w:                w,
-		detector:         d,
-		domainMap:        make(map[int64]*DomainMapInfo),
-		domainGroupList:  make([]int64, 0),
-		jumpDomainGroup:  make([]int64, 0),
-		contentMap:       make(map[int64]*ContentMapInfo),
-		contentGroupList: make([]int64, 0),
-		stop:             make(chan struct{}),
-		done:             make(chan struct{}),
-	}
-	aliyunClient, err := oss.New(cl.aliyunOss.Endpoint, cl.aliyunOss.AccessKeyId, cl.aliyunOss.AccessKeySecret)
-	if err != nil {
-		plog.Panicf("aliyun oss new error: %v\n", err)
+		cfg:                 cfg,
+		trustedProxies:      trustedProxies,
+		clock:               clock,
+		aliyunOss:           &cfg.AliyunOss,
+		sched:               sched,
+		stats:               NewServeStats(),
+		statsTask:           sched.Schedule("serve_stats", SERVE_STATS_FLUSH_INTERVAL, 0),
+		events:              NewEventBus(clock, cfg.EventBufferSize),
+		certProbe:           deps.certProbe,
+		webhookClient:       &http.Client{Timeout: WEBHOOK_TIMEOUT},
+		tenantWebhookClient: newTenantWebhookClient(),
+		webhookTask:         sched.Schedule("webhook_delivery", WEBHOOK_DELIVERY_INTERVAL, 0),
+		publicLimiter:       newRateLimiter(clock, cfg.PublicRateLimit, cfg.PublicRateBurst),
+		adminLimiter:        newRateLimiter(clock, cfg.AdminRateLimit, cfg.AdminRateBurst),
+		detector:            d,
+		apiKeys:             make(map[string]*ApiKeyInfo),
+		sessions:            NewAdminSessions(clock),
+		domainMap:           make(map[int64]*DomainMapInfo),
+		domainGroupList:     make([]int64, 0),
+		domainGroupIdx:      make(map[int64]int64),
+		jumpDomainGroup:     make([]int64, 0),
+		jumpDomainIdx:       make(map[int64]int64),
+		contentMap:          make(map[int64]*ContentMapInfo),
+		contentGroupList:    make([]int64, 0),
+		contentGroupIdx:     make(map[int64]int64),
+		stop:                make(chan struct{}),
+		done:                make(chan struct{}),
+	}
+	if deps.publisher != nil {
+		cl.publisher = deps.publisher
+	} else if cl.aliyunOss.Endpoint != "" {
+		aliyunClient, err := oss.New(cl.aliyunOss.Endpoint, cl.aliyunOss.AccessKeyId, cl.aliyunOss.AccessKeySecret)
+		if err != nil {
+			plog.Panicf("aliyun oss new error: %v\n", err)
+		}
+		cl.aliyunOss.AliyunClient = aliyunClient
+		cl.ossPublisher = NewOssPublisher(cl.aliyunOss)
+		cl.publisher = cl.ossPublisher
+		cl.ProvisionBucket()
+	} else if !cfg.IfServeContent {
+		logger.Warningf("no aliyun oss endpoint, serve content from controller.\n")
+		cfg.IfServeContent = true
+	}
+	if cfg.IfServeContent {
+		cl.contentCache = NewContentCache(cfg.ContentBaseUrl)
 	}
-	cl.aliyunOss.AliyunClient = aliyunClient
 	db, err := NewControllerDB(&cfg.MysqlInfo)
 	if err != nil {
 		plog.Panicf("db controller new error: %v\n", err)
 	}
 	cl.cdb = db
+	cl.outbox = db
 	err = cl.Init()
 	if err != nil {
 		plog.Panicf("logic init error: %v\n", err)
 	}
+	cl.certTask = sched.Schedule("cert_probe", cl.certProbeInterval(), 0)
+	// probe at start, the interval is long
+	cl.certTask.RunNow()
 	go cl.run()
+	go cl.watchConfig()
 
 	cl.xServer = NewXHttpServer(cfg.ListenAddr, cfg.ListenPort, cl)
-	setupLogging(cfg)
-	touchCacheDir()
 
 	return cl
 }
@@ -109,9 +222,25 @@ func (cl *ControllerLogic) Stop() {
 }
 
 func (cl *ControllerLogic) Init() error {
+	migrated, err := cl.cdb.MigrateShowGroupLists()
+	if err != nil {
+		logger.Errorf("[logic] init migrate show group lists error: %v\n", err)
+		return err
+	}
+	if migrated != 0 {
+		logger.Infof("[logic] moved show_group_list of %d groups into domain_group_show.\n", migrated)
+	}
+	if err := cl.LoadApiKeys(); err != nil {
+		logger.Errorf("[logic] init load api keys error: %v\n", err)
+		return err
+	}
+	if err := cl.LoadWebhooks(); err != nil {
+		logger.Errorf("[logic] init load webhooks error: %v\n", err)
+		return err
+	}
 	groupList, groupMaxID, err := cl.cdb.GetDomainGroupList(0)
 	if err != nil {
-		plog.Error("[logic] init get domain group list error: %v\n", err)
+		logger.Errorf("[logic] init get domain group list error: %v\n", err)
 		return err
 	}
 	cl.groupMaxID = groupMaxID
@@ -121,10 +250,10 @@ func (cl *ControllerLogic) Init() error {
 		}
 		err := cl.cdb.GetDomainList(domainList)
 		if err != nil {
-			plog.Error("[logic] init get domain list error: %v\n", err)
+			logger.With(utils.LOG_GROUP_ID, v.ID).Errorf("[logic] init get domain list error: %v\n", err)
 			return err
 		}
-		dhc := NewDomainCheckHealth(v, cl.cdb, cl.w, cl, cl.cfg)
+		dhc := NewDomainCheckHealth(v, cl.cdb, cl.domainTask(v), cl)
 		cl.domainMap[v.ID] = &DomainMapInfo{
 			groupInfo:  v,
 			domainList: domainList,
@@ -141,7 +270,7 @@ func (cl *ControllerLogic) Init() error {
 	// get content list
 	contentGroupList, contentGroupMaxID, err := cl.cdb.GetContentGroupList(0)
 	if err != nil {
-		plog.Error("[logic] init get content group list error: %v\n", err)
+		logger.Errorf("[logic] init get content group list error: %v\n", err)
 		return err
 	}
 	cl.contentGroupMaxID = contentGroupMaxID
@@ -151,13 +280,13 @@ func (cl *ControllerLogic) Init() error {
 		}
 		err := cl.cdb.GetContentList(contentList)
 		if err != nil {
-			plog.Error("[logic] init get content list error: %v\n", err)
+			logger.With(utils.LOG_GROUP_ID, v.ID).Errorf("[logic] init get content list error: %v\n", err)
 			return err
 		}
 		cl.contentMap[v.ID] = &ContentMapInfo{
 			groupInfo:   v,
 			contentList: contentList,
-			cg:          NewContentGenerate(v, cl.cdb, cl.w, cl, cl.aliyunOss),
+			cg:          NewContentGenerate(v, cl.cdb, cl.contentTask(v), cl, cl.publisher, cl.contentCache),
 		}
 		cl.contentGroupList = append(cl.contentGroupList, v.ID)
 	}
@@ -166,11 +295,24 @@ func (cl *ControllerLogic) Init() error {
 }
 
 func (cl *ControllerLogic) run() {
+	// made once per refresh, the other tasks firing must not put it off
+	refreshC := cl.clock.After(cl.refreshInterval())
 	for {
 		select {
-		case <-time.After(30 * time.Second):
+		case <-refreshC:
 			cl.onRefresh()
+			refreshC = cl.clock.After(cl.refreshInterval())
+		case <-cl.statsTask.C():
+			cl.FlushServeStats()
+		case <-cl.certTask.C():
+			go cl.ProbeCerts()
+		case <-cl.webhookTask.C():
+			go cl.DeliverWebhooks()
 		case <-cl.stop:
+			cl.statsTask.Cancel()
+			cl.certTask.Cancel()
+			cl.webhookTask.Cancel()
+			cl.FlushServeStats()
 			close(cl.done)
 			return
 		}
@@ -178,9 +320,26 @@ func (cl *ControllerLogic) run() {
 }
 
 func (cl *ControllerLogic) onRefresh() {
+	failed := false
+	defer func() {
+		atomic.AddInt64(&cl.refreshes, 1)
+		if failed {
+			atomic.AddInt64(&cl.refreshErrors, 1)
+		}
+	}()
+	// keys added or deleted on another controller
+	if err := cl.LoadApiKeys(); err != nil {
+		logger.Errorf("[onRefresh] load api keys error: %v\n", err)
+		failed = true
+	}
+	if err := cl.LoadWebhooks(); err != nil {
+		logger.Errorf("[onRefresh] load webhooks error: %v\n", err)
+		failed = true
+	}
 	groupList, groupMaxID, err := cl.cdb.GetDomainGroupList(cl.groupMaxID)
 	if err != nil {
-		plog.Error("[onRefresh] get domain group list error: %v\n", err)
+		logger.Errorf("[onRefresh] get domain group list error: %v\n", err)
+		failed = true
 	} else {
 		cl.groupMaxID = groupMaxID
 		for _, v := range groupList {
@@ -189,9 +348,10 @@ func (cl *ControllerLogic) onRefresh() {
 			}
 			err := cl.cdb.GetDomainList(domainList)
 			if err != nil {
-				plog.Error("[onRefresh] get domain list error: %v\n", err)
+				logger.With(utils.LOG_GROUP_ID, v.ID).Errorf("[onRefresh] get domain list error: %v\n", err)
+				failed = true
 			} else {
-				dhc := NewDomainCheckHealth(v, cl.cdb, cl.w, cl, cl.cfg)
+				dhc := NewDomainCheckHealth(v, cl.cdb, cl.domainTask(v), cl)
 				cl.Lock()
 				cl.domainMap[v.ID] = &DomainMapInfo{
 					groupInfo:  v,
@@ -211,7 +371,8 @@ func (cl *ControllerLogic) onRefresh() {
 
 	contentGroupList, contentGroupMaxID, err := cl.cdb.GetContentGroupList(cl.contentGroupMaxID)
 	if err != nil {
-		plog.Error("[logic] init get content group list error: %v\n", err)
+		logger.Errorf("[logic] init get content group list error: %v\n", err)
+		failed = true
 	} else {
 		cl.contentGroupMaxID = contentGroupMaxID
 		for _, v := range contentGroupList {
@@ -220,13 +381,14 @@ func (cl *ControllerLogic) onRefresh() {
 			}
 			err := cl.cdb.GetContentList(contentList)
 			if err != nil {
-				plog.Error("[logic] init get content list error: %v\n", err)
+				logger.With(utils.LOG_GROUP_ID, v.ID).Errorf("[logic] init get content list error: %v\n", err)
+				failed = true
 			} else {
 				cl.Lock()
 				cl.contentMap[v.ID] = &ContentMapInfo{
 					groupInfo:   v,
 					contentList: contentList,
-					cg:          NewContentGenerate(v, cl.cdb, cl.w, cl, cl.aliyunOss),
+					cg:          NewContentGenerate(v, cl.cdb, cl.contentTask(v), cl, cl.publisher, cl.contentCache),
 				}
 				cl.contentGroupList = append(cl.contentGroupList, v.ID)
 				cl.Unlock()
@@ -235,19 +397,172 @@ func (cl *ControllerLogic) onRefresh() {
 	}
 }
 
+// Config returns the active config, it is replaced as a whole on reload.
+func (cl *ControllerLogic) Config() *config.Config {
+	cl.cfgMutex.RLock()
+	defer cl.cfgMutex.RUnlock()
+	return cl.cfg
+}
+
+func (cl *ControllerLogic) TrustedProxies() TrustedProxies {
+	cl.cfgMutex.RLock()
+	defer cl.cfgMutex.RUnlock()
+	return cl.trustedProxies
+}
+
+func (cl *ControllerLogic) LastConfigReload() *ConfigReloadInfo {
+	cl.cfgMutex.RLock()
+	defer cl.cfgMutex.RUnlock()
+	return cl.lastReload
+}
+
+// ReloadConfig reads the config file and applies the live subset of it.
+func (cl *ControllerLogic) ReloadConfig() *ConfigReloadInfo {
+	info := &ConfigReloadInfo{Time: cl.clock.Now().Unix()}
+	cfg, restart, err := cl.Config().Reload()
+	var trustedProxies TrustedProxies
+	if err == nil {
+		trustedProxies, err = ParseTrustedProxies(cfg.TrustedProxies)
+	}
+	if err != nil {
+		logger.Errorf("reload config error, keep the active config: %v\n", err)
+		info.Error = err.Error()
+	} else {
+		cl.cfgMutex.Lock()
+		cl.cfg = cfg
+		cl.trustedProxies = trustedProxies
+		cl.cfgMutex.Unlock()
+		setupLogging(cfg)
+		cl.setRateLimits(cfg)
+		cl.cdb.SetMaxConns(cfg.MaxOpenConns, cfg.MaxIdleConns)
+		cl.certTask.SetInterval(cl.certProbeInterval())
+		info.Applied = true
+		info.RestartRequired = restart
+		logger.Infof("reload config success: %v\n", cfg.Redacted())
+		if len(restart) != 0 {
+			logger.Warningf("config fields %v changed, they take effect after restart.\n", restart)
+		}
+	}
+	cl.cfgMutex.Lock()
+	cl.lastReload = info
+	cl.cfgMutex.Unlock()
+	cl.publish(EVENT_CONFIG_RELOADED, 0, info)
+
+	return info
+}
+
+// watchConfig reloads the config on SIGHUP, and when the file changes if ConfigWatchInterval is set.
+func (cl *ControllerLogic) watchConfig() {
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGHUP)
+	defer signal.Stop(sigC)
+
+	modTime := configModTime(cl.Config().ConfigPath)
+	for {
+		var pollC <-chan time.Time
+		if interval := cl.Config().ConfigWatchInterval; interval > 0 {
+			pollC = cl.clock.After(time.Duration(interval) * time.Second)
+		}
+		select {
+		case <-sigC:
+			logger.Infof("receive SIGHUP, reload config.\n")
+			cl.ReloadConfig()
+			modTime = configModTime(cl.Config().ConfigPath)
+		case <-pollC:
+			mt := configModTime(cl.Config().ConfigPath)
+			if !mt.Equal(modTime) {
+				logger.Infof("config file changed, reload config.\n")
+				cl.ReloadConfig()
+				modTime = mt
+			}
+		case <-cl.stop:
+			return
+		}
+	}
+}
+
+func configModTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+func (cl *ControllerLogic) refreshInterval() time.Duration {
+	if interval := cl.Config().RefreshInterval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return DEFAULT_REFRESH_INTERVAL
+}
+
+// checkInterval is the group check interval, or the configured default when the group has none.
+func (cl *ControllerLogic) checkInterval(groupInterval int64) time.Duration {
+	if groupInterval > 0 {
+		return time.Duration(groupInterval) * time.Second
+	}
+	if cfg := cl.Config(); cfg.CheckInterval > 0 {
+		return time.Duration(cfg.CheckInterval) * time.Second
+	}
+	return DEFAULT_CHECK_INTERVAL
+}
+
+func (cl *ControllerLogic) domainTask(groupInfo *DomainGroupInfo) *utils.Task {
+	return cl.sched.Schedule(fmt.Sprintf("%s[%d]", CHECK_TYPE_DOMAIN, groupInfo.ID),
+		cl.checkInterval(groupInfo.CheckInterval), time.Duration(cl.Config().CheckJitter)*time.Second)
+}
+
+func (cl *ControllerLogic) contentTask(groupInfo *ContentGroupInfo) *utils.Task {
+	return cl.sched.Schedule(fmt.Sprintf("%s[%d]", CHECK_TYPE_CONTENT, groupInfo.ID),
+		cl.checkInterval(groupInfo.CheckInterval), time.Duration(cl.Config().CheckJitter)*time.Second)
+}
+
+// RunCheckNow triggers the check of a domain group or content group at once.
+func (cl *ControllerLogic) RunCheckNow(checkType string, groupID int64) error {
+	cl.Lock()
+	defer cl.Unlock()
+
+	switch checkType {
+	case CHECK_TYPE_DOMAIN:
+		v := cl.domainMap[groupID]
+		if v == nil || v.dhc == nil {
+			return fmt.Errorf("no this[%d] domain group!", groupID)
+		}
+		v.dhc.task.RunNow()
+	case CHECK_TYPE_CONTENT:
+		v := cl.contentMap[groupID]
+		if v == nil || v.cg == nil {
+			return fmt.Errorf("no this[%d] content group!", groupID)
+		}
+		v.cg.task.RunNow()
+	default:
+		return fmt.Errorf("unknown check type[%s]!", checkType)
+	}
+	return nil
+}
+
 func (cl *ControllerLogic) UpdateDomainGroup(groupInfo *DomainGroupInfo, domainList *DomainList) {
 	cl.Lock()
 	defer cl.Unlock()
 
 	v := cl.domainMap[groupInfo.ID]
 	if v != nil {
+		v.groupInfo = groupInfo
 		v.domainList = domainList
 	} else {
 		cl.domainMap[groupInfo.ID] = &DomainMapInfo{
 			groupInfo:  groupInfo,
 			domainList: domainList,
 		}
-		cl.domainGroupList = append(cl.domainGroupList, groupInfo.ID)
+	}
+	// the type may have changed, the group moves to the list of its type
+	switch groupInfo.Type {
+	case DOMAIN_GROUP_TYPE_JUMP:
+		cl.domainGroupList = removeGroupID(cl.domainGroupList, groupInfo.ID)
+		cl.jumpDomainGroup = appendGroupID(cl.jumpDomainGroup, groupInfo.ID)
+	case DOMAIN_GROUP_TYPE_SHOW:
+		cl.jumpDomainGroup = removeGroupID(cl.jumpDomainGroup, groupInfo.ID)
+		cl.domainGroupList = appendGroupID(cl.domainGroupList, groupInfo.ID)
 	}
 }
 
@@ -261,43 +576,133 @@ func (cl *ControllerLogic) UpdateContentGroup(groupInfo *ContentGroupInfo) {
 	}
 }
 
-func (cl *ControllerLogic) GetDomainInfo(id, t int64) (*DomainInfo, error) {
+// RemoveDomainGroup stops the checker of a deleted domain group and stops serving it.
+func (cl *ControllerLogic) RemoveDomainGroup(groupID int64) {
+	cl.Lock()
+	v := cl.domainMap[groupID]
+	cl.Unlock()
+	// stop outside the lock, a running check calls back into the logic
+	if v != nil && v.dhc != nil {
+		v.dhc.Stop()
+	}
+
+	cl.Lock()
+	defer cl.Unlock()
+	delete(cl.domainMap, groupID)
+	cl.domainGroupList = removeGroupID(cl.domainGroupList, groupID)
+	cl.jumpDomainGroup = removeGroupID(cl.jumpDomainGroup, groupID)
+}
+
+// RemoveContentGroup stops the generator of a deleted content group and stops serving it.
+func (cl *ControllerLogic) RemoveContentGroup(groupID int64) {
+	cl.Lock()
+	v := cl.contentMap[groupID]
+	cl.Unlock()
+	if v != nil && v.cg != nil {
+		v.cg.Stop()
+	}
+	if cl.contentCache != nil {
+		cl.contentCache.DeleteGroup(groupID)
+	}
+
+	cl.Lock()
+	defer cl.Unlock()
+	delete(cl.contentMap, groupID)
+	cl.contentGroupList = removeGroupID(cl.contentGroupList, groupID)
+}
+
+// appendGroupID adds groupID to the end of list unless it is there, keeping the turn of the groups.
+func appendGroupID(list []int64, groupID int64) []int64 {
+	for _, v := range list {
+		if v == groupID {
+			return list
+		}
+	}
+	return append(list, groupID)
+}
+
+func removeGroupID(list []int64, groupID int64) []int64 {
+	result := make([]int64, 0, len(list))
+	for _, v := range list {
+		if v != groupID {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// GetDomainInfo hands out a domain of group id, or of the next group of the tenant when id is 0.
+// log is the logger of the request.
+func (cl *ControllerLogic) GetDomainInfo(log *utils.Logger, id, t, tenantID int64) (*DomainInfo, error) {
+	domain, err := cl.getDomainInfo(log, id, t, tenantID)
+	if err == nil {
+		cl.stats.Add(SERVE_STAT_DOMAIN, domain.GroupID, domain.ID, cl.clock.Now())
+	}
+	return domain, err
+}
+
+func (cl *ControllerLogic) getDomainInfo(log *utils.Logger, id, t, tenantID int64) (*DomainInfo, error) {
 	cl.Lock()
 	defer cl.Unlock()
 
 	if t == DOMAIN_GROUP_TYPE_JUMP {
-		oldJumpGroupIdx := cl.jumpDomainIdx
-		for {
-			groupID := cl.jumpDomainGroup[cl.jumpDomainIdx]
-			cl.jumpDomainIdx = (cl.jumpDomainIdx + 1) % int64(len(cl.jumpDomainGroup))
-			domain, err := cl.getDomainFromGroupID(groupID, t)
-			if err == nil {
-				return domain, nil
-			}
-			if cl.jumpDomainIdx == oldJumpGroupIdx {
-				plog.Errorf("no useful jump domain!")
-				return nil, fmt.Errorf("no useful jump domain!")
-			}
+		if len(cl.jumpDomainGroup) == 0 {
+			return nil, fmt.Errorf("no useful jump domain!")
+		}
+		if domain := cl.nextDomain(cl.jumpDomainGroup, cl.jumpDomainIdx, t, tenantID); domain != nil {
+			return domain, nil
 		}
+		log.Errorf("no useful jump domain!\n")
+		return nil, fmt.Errorf("no useful jump domain!")
 	}
 
 	if id != 0 {
+		if !cl.domainGroupInTenant(id, tenantID) {
+			return nil, fmt.Errorf("no useful domain!")
+		}
 		return cl.getDomainFromGroupID(id, t)
 	}
 
-	oldGroupIdx := cl.domainGroupIdx
-	for {
-		groupID := cl.domainGroupList[cl.domainGroupIdx]
-		cl.domainGroupIdx = (cl.domainGroupIdx + 1) % int64(len(cl.domainGroupList))
-		domain, err := cl.getDomainFromGroupID(groupID, t)
-		if err == nil {
-			return domain, nil
+	if len(cl.domainGroupList) == 0 {
+		return nil, fmt.Errorf("no useful domain!")
+	}
+	if domain := cl.nextDomain(cl.domainGroupList, cl.domainGroupIdx, t, tenantID); domain != nil {
+		return domain, nil
+	}
+	log.Errorf("no useful domain!\n")
+	return nil, fmt.Errorf("no useful domain!")
+}
+
+// nextDomain tries the groups of the tenant in list in turn from its position in idx, until one hands out a domain.
+func (cl *ControllerLogic) nextDomain(list []int64, idx map[int64]int64, t, tenantID int64) *DomainInfo {
+	n := int64(len(list))
+	for i := int64(0); i < n; i++ {
+		pos := idx[tenantID] % n
+		idx[tenantID] = (pos + 1) % n
+		if !cl.domainGroupInTenant(list[pos], tenantID) {
+			continue
 		}
-		if cl.domainGroupIdx == oldGroupIdx {
-			plog.Errorf("no useful domain!")
-			return nil, fmt.Errorf("no useful domain!")
+		if domain, err := cl.getDomainFromGroupID(list[pos], t); err == nil {
+			return domain
 		}
 	}
+	return nil
+}
+
+func (cl *ControllerLogic) domainGroupInTenant(groupID, tenantID int64) bool {
+	if tenantID == TENANT_ALL {
+		return true
+	}
+	v := cl.domainMap[groupID]
+	return v != nil && v.groupInfo.TenantID == tenantID
+}
+
+func (cl *ControllerLogic) contentGroupInTenant(groupID, tenantID int64) bool {
+	if tenantID == TENANT_ALL {
+		return true
+	}
+	v := cl.contentMap[groupID]
+	return v != nil && v.groupInfo.TenantID == tenantID
 }
 
 func (cl *ControllerLogic) getDomainFromGroupID(groupID, t int64) (*DomainInfo, error) {
@@ -306,14 +711,17 @@ func (cl *ControllerLogic) getDomainFromGroupID(groupID, t int64) (*DomainInfo,
 		if v.groupInfo.Status == DOMAIN_STATUS_OK {
 			if len(v.domainList.DomainList) > 0 {
 				oldDomainIdx := v.idx
+				now := cl.clock.Now().Unix()
 				for {
-					if v.domainList.DomainList[v.idx].Status == DOMAIN_STATUS_OK {
+					// expired domains are withdrawn until renewed
+					if v.domainList.DomainList[v.idx].Status == DOMAIN_STATUS_OK && !v.domainList.DomainList[v.idx].Expired(now) {
 						resultIdx := v.idx
 						v.idx = (v.idx + 1) % int64(len(v.domainList.DomainList))
 						var domain string
-						if cl.cfg.IfUrlEncoding {
+						cfg := cl.Config()
+						if cfg.IfUrlEncoding {
 							ok := false
-							for _, gv := range cl.cfg.BaiduGroups {
+							for _, gv := range cfg.BaiduGroups {
 								if gv == groupID {
 									domain = BaiduEncoding(v.domainList.DomainList[resultIdx].Domain)
 									ok = true
@@ -321,7 +729,7 @@ func (cl *ControllerLogic) getDomainFromGroupID(groupID, t int64) (*DomainInfo,
 								}
 							}
 							if !ok {
-								for _, gv := range cl.cfg.ZhihuGroups {
+								for _, gv := range cfg.ZhihuGroups {
 									if gv == groupID {
 										domain = ZhihuEncoding(v.domainList.DomainList[resultIdx].Domain)
 										ok = true
@@ -336,25 +744,28 @@ func (cl *ControllerLogic) getDomainFromGroupID(groupID, t int64) (*DomainInfo,
 							domain = v.domainList.DomainList[resultIdx].Domain
 						}
 						result := &DomainInfo{
-							ID:      v.domainList.DomainList[resultIdx].ID,
-							GroupID: v.domainList.DomainList[resultIdx].GroupID,
-							Domain:  domain,
-							Status:  v.domainList.DomainList[resultIdx].Status,
-							Time:    v.domainList.DomainList[resultIdx].Time,
+							ID:                    v.domainList.DomainList[resultIdx].ID,
+							GroupID:               v.domainList.DomainList[resultIdx].GroupID,
+							Domain:                domain,
+							Status:                v.domainList.DomainList[resultIdx].Status,
+							RegistrationExpiresAt: v.domainList.DomainList[resultIdx].RegistrationExpiresAt,
+							CertExpiresAt:         v.domainList.DomainList[resultIdx].CertExpiresAt,
+							Time:                  v.domainList.DomainList[resultIdx].Time,
 						}
 						if t == DOMAIN_GROUP_TYPE_JUMP {
-							ifHasShowGroup := false
-							for _, jv := range v.groupInfo.ShowGroupList {
-								jvg := cl.domainMap[jv]
-								if jvg != nil {
-									if jvg.groupInfo.Status == DOMAIN_STATUS_OK {
-										ifHasShowGroup = true
-										result.ShowGroupID = jvg.groupInfo.ID
-										break
-									}
-								}
+							if v.showWeights == nil {
+								v.showWeights = make(map[int64]int64)
 							}
-							if ifHasShowGroup {
+							show := pickShowGroup(v.groupInfo.ShowGroups, v.showWeights, func(id int64) bool {
+								jvg := cl.domainMap[id]
+								if jvg == nil {
+									return false
+								}
+								healthy, _ := groupHealthy(jvg, now)
+								return healthy
+							})
+							if show != nil {
+								result.ShowGroupID = show.ShowGroupID
 								return result, nil
 							}
 							return nil, fmt.Errorf("no useful jump domain!")
@@ -373,13 +784,23 @@ func (cl *ControllerLogic) getDomainFromGroupID(groupID, t int64) (*DomainInfo,
 	return nil, fmt.Errorf("no useful domain!")
 }
 
-func (cl *ControllerLogic) GetContent(id, contentGroupID int64, clientIP string) (*RealContentInfo, error) {
+// GetContent returns content group contentGroupID, or the next group of the tenant when it is 0.
+// log is the logger of the request.
+func (cl *ControllerLogic) GetContent(log *utils.Logger, id, contentGroupID int64, clientIP string, tenantID int64) (*RealContentInfo, error) {
+	rci, err := cl.getContent(log, id, contentGroupID, clientIP, tenantID)
+	if err == nil {
+		cl.stats.Add(SERVE_STAT_CONTENT, rci.ContentGroupID, 0, cl.clock.Now())
+	}
+	return rci, err
+}
+
+func (cl *ControllerLogic) getContent(log *utils.Logger, id, contentGroupID int64, clientIP string, tenantID int64) (*RealContentInfo, error) {
 	cl.Lock()
 	defer cl.Unlock()
 
 	if contentGroupID != 0 {
 		list := cl.contentMap[contentGroupID]
-		if list == nil {
+		if list == nil || !cl.contentGroupInTenant(contentGroupID, tenantID) {
 			return nil, fmt.Errorf("no this[%d] content group!", contentGroupID)
 		}
 		rci := &RealContentInfo{
@@ -405,11 +826,17 @@ func (cl *ControllerLogic) GetContent(id, contentGroupID int64, clientIP string)
 
 	var idx int64
 	idx = -1
-	if len(cl.contentGroupList) > 0 {
-		idx = cl.contentGroupIdx
-		cl.contentGroupIdx = (cl.contentGroupIdx + 1) % int64(len(cl.contentGroupList))
+	n := int64(len(cl.contentGroupList))
+	for i := int64(0); i < n; i++ {
+		pos := cl.contentGroupIdx[tenantID] % n
+		cl.contentGroupIdx[tenantID] = (pos + 1) % n
+		if cl.contentGroupInTenant(cl.contentGroupList[pos], tenantID) {
+			idx = pos
+			break
+		}
 	}
 	if idx == -1 {
+		log.Errorf("no content group!\n")
 		return nil, fmt.Errorf("no content group!")
 	}
 	list := cl.contentMap[cl.contentGroupList[idx]]
@@ -437,6 +864,80 @@ func (cl *ControllerLogic) GetContent(id, contentGroupID int64, clientIP string)
 	return rci, nil
 }
 
+// FlushServeStats writes the serve counters into serve_stats, they are kept for the next flush on error.
+func (cl *ControllerLogic) FlushServeStats() error {
+	list := cl.stats.Take()
+	if len(list) == 0 {
+		return nil
+	}
+	if err := cl.cdb.InsertServeStats(list); err != nil {
+		logger.Errorf("flush serve stats error: %v\n", err)
+		cl.stats.Restore(list)
+		return err
+	}
+	return nil
+}
+
+// ProvisionBucket sets up the bucket CORS rule. Content workers run whatever the result,
+// a failure is reported as degraded in the publish status.
+func (cl *ControllerLogic) ProvisionBucket() error {
+	if cl.ossPublisher == nil {
+		return fmt.Errorf("aliyun oss is not configured.")
+	}
+	err := cl.ossPublisher.Provision(DefaultCORSRule)
+	if err != nil {
+		logger.Errorf("provision bucket[%s] error, publish is degraded: %v\n", cl.aliyunOss.Bucket, err)
+	}
+	cl.Lock()
+	cl.provisionErr = err
+	cl.Unlock()
+
+	return err
+}
+
+func (cl *ControllerLogic) PublishContent(contentGroupID int64) error {
+	cl.Lock()
+	v := cl.contentMap[contentGroupID]
+	cl.Unlock()
+
+	if v == nil || v.cg == nil {
+		return fmt.Errorf("no this[%d] content group!", contentGroupID)
+	}
+	return v.cg.PublishNow()
+}
+
+// GetPublishStates returns the publish state of one content group, or of all groups when contentGroupID is 0.
+func (cl *ControllerLogic) GetPublishStates(contentGroupID, tenantID int64) ([]PublishState, error) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	if contentGroupID != 0 {
+		v := cl.contentMap[contentGroupID]
+		if v == nil || v.cg == nil || !cl.contentGroupInTenant(contentGroupID, tenantID) {
+			return nil, fmt.Errorf("no this[%d] content group!", contentGroupID)
+		}
+		return []PublishState{cl.publishState(v.cg)}, nil
+	}
+	list := make([]PublishState, 0, len(cl.contentGroupList))
+	for _, id := range cl.contentGroupList {
+		v := cl.contentMap[id]
+		if v == nil || v.cg == nil || !cl.contentGroupInTenant(id, tenantID) {
+			continue
+		}
+		list = append(list, cl.publishState(v.cg))
+	}
+	return list, nil
+}
+
+func (cl *ControllerLogic) publishState(cg *ContentGenerate) PublishState {
+	state := cg.PublishState()
+	if cl.provisionErr != nil {
+		state.Degraded = true
+		state.DegradedReason = fmt.Sprintf("bucket provision failed: %v", cl.provisionErr)
+	}
+	return state
+}
+
 func touchCacheDir() {
 	fi, err := os.Stat(CacheDir)
 	if err != nil {
@@ -451,8 +952,7 @@ func touchCacheDir() {
 }
 
 func setupLogging(cfg *config.Config) {
-	capnslog.SetGlobalLogLevel(capnslog.INFO)
-	if cfg.Debug {
-		capnslog.SetGlobalLogLevel(capnslog.DEBUG)
+	if err := utils.SetupLogging(cfg.LogFormat, cfg.Debug); err != nil {
+		plog.Errorf("setup logging error: %v\n", err)
 	}
 }
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
+)
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestLogicRun drives the loop of the logic on a fake clock, mysql is not connected so every refresh fails.
+func TestLogicRun(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1500000000, 0))
+	sched := utils.NewScheduler(clock, time.Second, 60)
+	defer sched.Stop()
+	cdb := &ControllerDB{db: utils.NewMysqlController()}
+	cl := &ControllerLogic{
+		cfg:         &config.Config{RefreshInterval: 10},
+		clock:       clock,
+		sched:       sched,
+		cdb:         cdb,
+		outbox:      cdb,
+		stats:       NewServeStats(),
+		statsTask:   sched.Schedule("serve_stats", SERVE_STATS_FLUSH_INTERVAL, 0),
+		certTask:    sched.Schedule("cert_probe", time.Hour, 0),
+		webhookTask: sched.Schedule("webhook_delivery", time.Hour, 0),
+		apiKeys:     map[string]*ApiKeyInfo{HashApiKey("admin"): {ID: 1}},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	refreshes := func() int64 { return atomic.LoadInt64(&cl.refreshes) }
+	go cl.run()
+	// the ticker of the scheduler and the refresh wait
+	waitUntil(t, "the loop to wait", func() bool { return clock.Waiters() == 2 })
+
+	clock.Advance(9 * time.Second)
+	if n := refreshes(); n != 0 {
+		t.Fatalf("refreshed %d times before the interval", n)
+	}
+	// the wait running keeps its interval, the next one reads the live config
+	cl.cfgMutex.Lock()
+	cl.cfg = &config.Config{RefreshInterval: 30}
+	cl.cfgMutex.Unlock()
+	clock.Advance(time.Second)
+	waitUntil(t, "the first refresh", func() bool { return refreshes() == 1 })
+	if n := atomic.LoadInt64(&cl.refreshErrors); n != 1 {
+		t.Errorf("refresh errors: got %d", n)
+	}
+	if cl.apiKeyByHash(HashApiKey("admin")) == nil {
+		t.Errorf("a failed refresh dropped the api keys")
+	}
+
+	waitUntil(t, "the loop to wait again", func() bool { return clock.Waiters() == 2 })
+	// another task firing in between must not put the refresh off
+	cl.webhookTask.RunNow()
+	clock.Advance(29 * time.Second)
+	if n := refreshes(); n != 1 {
+		t.Fatalf("refreshed %d times before the new interval", n)
+	}
+	clock.Advance(time.Second)
+	waitUntil(t, "the second refresh", func() bool { return refreshes() == 2 })
+
+	cl.Stop()
+	if n := len(sched.Tasks()); n != 0 {
+		t.Errorf("%d tasks left after stop", n)
+	}
+}
+
+func TestUpdateDomainGroupType(t *testing.T) {
+	cl := &ControllerLogic{domainMap: make(map[int64]*DomainMapInfo)}
+	list := &DomainList{GroupID: 1}
+	cl.UpdateDomainGroup(&DomainGroupInfo{ID: 1, Type: DOMAIN_GROUP_TYPE_JUMP}, list)
+	cl.UpdateDomainGroup(&DomainGroupInfo{ID: 2, Type: DOMAIN_GROUP_TYPE_SHOW}, &DomainList{GroupID: 2})
+	cl.UpdateDomainGroup(&DomainGroupInfo{ID: 3, Type: DOMAIN_GROUP_TYPE_SHOW}, &DomainList{GroupID: 3})
+	if !equalIDs(cl.jumpDomainGroup, []int64{1}) || !equalIDs(cl.domainGroupList, []int64{2, 3}) {
+		t.Fatalf("new groups: jump %v show %v", cl.jumpDomainGroup, cl.domainGroupList)
+	}
+
+	// a group turned into a show group moves over with its new info
+	info := &DomainGroupInfo{ID: 1, Name: "renamed", Type: DOMAIN_GROUP_TYPE_SHOW}
+	cl.UpdateDomainGroup(info, list)
+	if !equalIDs(cl.jumpDomainGroup, nil) || !equalIDs(cl.domainGroupList, []int64{2, 3, 1}) {
+		t.Errorf("after type change: jump %v show %v", cl.jumpDomainGroup, cl.domainGroupList)
+	}
+	if cl.domainMap[1].groupInfo != info {
+		t.Errorf("group info not replaced")
+	}
+	// an update of the same type keeps the turn of the groups
+	cl.UpdateDomainGroup(&DomainGroupInfo{ID: 2, Type: DOMAIN_GROUP_TYPE_SHOW}, &DomainList{GroupID: 2})
+	if !equalIDs(cl.domainGroupList, []int64{2, 3, 1}) {
+		t.Errorf("same type moved the group: %v", cl.domainGroupList)
+	}
+}
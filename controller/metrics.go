@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+// metrics serves counters in the prometheus text format.
+func (xhs *XHttpServer) metrics(rsp http.ResponseWriter, req *http.Request) {
+	rsp.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeRateLimitMetrics(rsp, map[string]utils.RateLimiterStats{
+		ROUTE_CLASS_PUBLIC: xhs.logic.publicLimiter.Stats(),
+		ROUTE_CLASS_ADMIN:  xhs.logic.adminLimiter.Stats(),
+	})
+	writeRefreshMetrics(rsp, atomic.LoadInt64(&xhs.logic.refreshes), atomic.LoadInt64(&xhs.logic.refreshErrors))
+}
+
+func writeRefreshMetrics(w io.Writer, refreshes, errors int64) {
+	fmt.Fprintln(w, "# HELP xrc_refresh_total Reloads of groups and api keys from mysql.")
+	fmt.Fprintln(w, "# TYPE xrc_refresh_total counter")
+	fmt.Fprintf(w, "xrc_refresh_total %d\n", refreshes)
+	fmt.Fprintln(w, "# HELP xrc_refresh_errors_total Reloads which met a mysql error.")
+	fmt.Fprintln(w, "# TYPE xrc_refresh_errors_total counter")
+	fmt.Fprintf(w, "xrc_refresh_errors_total %d\n", errors)
+}
+
+func writeRateLimitMetrics(w io.Writer, stats map[string]utils.RateLimiterStats) {
+	classes := []string{ROUTE_CLASS_PUBLIC, ROUTE_CLASS_ADMIN}
+	fmt.Fprintln(w, "# HELP xrc_rate_limit_allowed_total Requests let through by the rate limiter.")
+	fmt.Fprintln(w, "# TYPE xrc_rate_limit_allowed_total counter")
+	for _, c := range classes {
+		fmt.Fprintf(w, "xrc_rate_limit_allowed_total{class=%q} %d\n", c, stats[c].Allowed)
+	}
+	fmt.Fprintln(w, "# HELP xrc_rate_limit_limited_total Requests answered with 429 by the rate limiter.")
+	fmt.Fprintln(w, "# TYPE xrc_rate_limit_limited_total counter")
+	for _, c := range classes {
+		fmt.Fprintf(w, "xrc_rate_limit_limited_total{class=%q} %d\n", c, stats[c].Limited)
+	}
+	fmt.Fprintln(w, "# HELP xrc_rate_limit_keys Client ips and api keys with a bucket.")
+	fmt.Fprintln(w, "# TYPE xrc_rate_limit_keys gauge")
+	for _, c := range classes {
+		fmt.Fprintf(w, "xrc_rate_limit_keys{class=%q} %d\n", c, stats[c].Keys)
+	}
+	fmt.Fprintln(w, "# HELP xrc_rate_limit_rate Requests per second allowed per key, 0 is unlimited.")
+	fmt.Fprintln(w, "# TYPE xrc_rate_limit_rate gauge")
+	for _, c := range classes {
+		fmt.Fprintf(w, "xrc_rate_limit_rate{class=%q} %g\n", c, stats[c].Rate)
+	}
+}
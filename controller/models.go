@@ -23,7 +23,16 @@ type DomainGroupInfo struct {
 	Type          int64   `json:"type"`
 	ShowGroupList []int64 `json:"showGroupList"`
 	ShowListStr   string  `json:"showGroupListStr"`
-	Time          string  `json:"time"`
+	// show groups of a jump group with their weights, ShowGroupList has the same ids
+	ShowGroups    []*DomainGroupShow `json:"showGroups"`
+	CheckInterval int64              `json:"checkInterval"`
+	TenantID      int64              `json:"tenantID"`
+	Time          string             `json:"time"`
+}
+
+type DomainGroupShow struct {
+	ShowGroupID int64 `json:"showGroupID"`
+	Weight      int64 `json:"weight"`
 }
 
 type DomainInfo struct {
@@ -32,7 +41,16 @@ type DomainInfo struct {
 	Domain      string `json:"domain"`
 	Status      int64  `json:"status"`
 	ShowGroupID int64  `json:"showGroupID"`
-	Time        string `json:"time"`
+	// unix seconds, 0 is unknown
+	RegistrationExpiresAt int64  `json:"registrationExpiresAt"`
+	CertExpiresAt         int64  `json:"certExpiresAt"`
+	Time                  string `json:"time"`
+}
+
+// Expired tells if the registration or the certificate of the domain lapsed at now.
+func (info *DomainInfo) Expired(now int64) bool {
+	return (info.RegistrationExpiresAt != 0 && info.RegistrationExpiresAt <= now) ||
+		(info.CertExpiresAt != 0 && info.CertExpiresAt <= now)
 }
 
 type DomainList struct {
@@ -42,13 +60,17 @@ type DomainList struct {
 }
 
 type ContentGroupInfo struct {
-	ID          int64   `json:"id"`
-	Name        string  `json:"name"`
-	JsonUrl     string  `json:"jsonUrl"`
-	Type        int64   `json:"type"`
-	MainContent []int64 `json:"mainContent"`
-	Time        string  `json:"time"`
-	UpdateTime  int64
+	ID            int64    `json:"id"`
+	Name          string   `json:"name"`
+	JsonUrl       string   `json:"jsonUrl"`
+	Type          int64    `json:"type"`
+	Formats       []string `json:"formats"`
+	JsonpCallback string   `json:"jsonpCallback"`
+	CheckInterval int64    `json:"checkInterval"`
+	TenantID      int64    `json:"tenantID"`
+	Time          string   `json:"time"`
+	// unix seconds of the last change, for the publisher only
+	UpdateTime int64 `json:"-"`
 }
 
 type Video struct {
@@ -62,11 +84,26 @@ type Video struct {
 }
 
 type ContentInfo struct {
-	ID      int64  `json:"id"`
-	GroupID int64  `json:"groupID"`
-	Value   string `json:"value"`
-	Type    int64  `json:"type"`
-	Time    string `json:"time"`
+	ID       int64  `json:"id"`
+	GroupID  int64  `json:"groupID"`
+	Value    string `json:"value"`
+	Type     int64  `json:"type"`
+	Position int64  `json:"position"`
+	Enabled  bool   `json:"enabled"`
+	Pinned   bool   `json:"pinned"`
+	// unix seconds, 0 means no limit
+	PublishAt int64  `json:"publishAt"`
+	ExpireAt  int64  `json:"expireAt"`
+	Time      string `json:"time"`
+	// unix seconds of the last change, for the publisher only
+	UpdateTime int64 `json:"-"`
+}
+
+// ContentSetting changes the fields that are set, a body with only pinned keeps enabled.
+type ContentSetting struct {
+	ID      int64 `json:"id"`
+	Enabled *bool `json:"enabled"`
+	Pinned  *bool `json:"pinned"`
 }
 
 type ContentList struct {
@@ -75,6 +112,47 @@ type ContentList struct {
 	UpdateTime  int64
 }
 
+const (
+	SCHEDULE_ACTION_PUBLISH = "publish"
+	SCHEDULE_ACTION_EXPIRE  = "expire"
+)
+
+type ContentScheduleInfo struct {
+	ContentID int64  `json:"contentID"`
+	Action    string `json:"action"`
+	At        int64  `json:"at"`
+	Time      string `json:"time"`
+}
+
+type PublishState struct {
+	GroupID             int64             `json:"groupID"`
+	JsonUrl             string            `json:"jsonUrl"`
+	Urls                map[string]string `json:"urls"`
+	LastSuccess         int64             `json:"lastSuccess"`
+	LastFailure         int64             `json:"lastFailure"`
+	ConsecutiveFailures int64             `json:"consecutiveFailures"`
+	LastError           string            `json:"lastError"`
+	NextRetry           int64             `json:"nextRetry"`
+	Degraded            bool              `json:"degraded"`
+	DegradedReason      string            `json:"degradedReason"`
+}
+
+type PublishLogInfo struct {
+	ID      int64  `json:"id"`
+	GroupID int64  `json:"groupID"`
+	Success bool   `json:"success"`
+	JsonUrl string `json:"jsonUrl"`
+	Error   string `json:"error"`
+	Time    string `json:"time"`
+}
+
+type ConfigReloadInfo struct {
+	Time            int64    `json:"time"`
+	Applied         bool     `json:"applied"`
+	RestartRequired []string `json:"restartRequired"`
+	Error           string   `json:"error"`
+}
+
 type RealContentInfo struct {
 	ContentGroupID int64  `json:"contentGroupID"`
 	ContentUrl     string `json:"contentUrl"`
@@ -93,3 +171,298 @@ type Response struct {
 	Msg  string      `json:"msg"`
 	Data interface{} `json:"data"`
 }
+
+type ServeStatInfo struct {
+	Time     int64  `json:"time"`
+	Kind     string `json:"kind"`
+	GroupID  int64  `json:"groupID"`
+	DomainID int64  `json:"domainID"`
+	Count    int64  `json:"count"`
+}
+
+type ServeStatQuery struct {
+	From    int64
+	To      int64
+	Kind    string
+	GroupID int64
+	// seconds of one row, a multiple of 60
+	Step int64
+	// rows of the groups of this tenant only, TENANT_ALL for every group
+	TenantID int64
+}
+
+const (
+	DOMAIN_HEALTH_RESULT_GRAY        = "gray"
+	DOMAIN_HEALTH_RESULT_BLACK       = "black"
+	DOMAIN_HEALTH_RESULT_QUERY_ERROR = "query_error"
+	DOMAIN_HEALTH_RESULT_UNKNOWN     = "unknown"
+	DOMAIN_HEALTH_RESULT_ERROR       = "error"
+	DOMAIN_HEALTH_RESULT_DOWN        = "down"
+)
+
+const (
+	HEALTH_HISTORY_DEFAULT_LIMIT = 100
+	HEALTH_HISTORY_MAX_LIMIT     = 1000
+)
+
+type DomainHealthInfo struct {
+	ID       int64  `json:"id"`
+	GroupID  int64  `json:"groupID"`
+	DomainID int64  `json:"domainID"`
+	Domain   string `json:"domain"`
+	Result   string `json:"result"`
+	Message  string `json:"message"`
+	Time     string `json:"time"`
+}
+
+const (
+	DOMAIN_IMPORT_ADDED     = "added"
+	DOMAIN_IMPORT_DUPLICATE = "duplicate"
+	DOMAIN_IMPORT_EXISTS    = "exists"
+	DOMAIN_IMPORT_INVALID   = "invalid"
+	DOMAIN_IMPORT_ERROR     = "error"
+)
+
+type DomainImportRow struct {
+	Line      int64  `json:"line"`
+	Input     string `json:"input"`
+	Domain    string `json:"domain"`
+	GroupID   int64  `json:"groupID"`
+	GroupName string `json:"groupName,omitempty"`
+	GroupType int64  `json:"-"`
+	Status    int64  `json:"status"`
+	Result    string `json:"result"`
+	ID        int64  `json:"id,omitempty"`
+	// other groups that already have the domain
+	OtherGroups []int64 `json:"otherGroups,omitempty"`
+	Message     string  `json:"message,omitempty"`
+}
+
+type DomainImportReport struct {
+	DryRun    bool               `json:"dryRun"`
+	Total     int64              `json:"total"`
+	Added     int64              `json:"added"`
+	Duplicate int64              `json:"duplicate"`
+	Exists    int64              `json:"exists"`
+	Invalid   int64              `json:"invalid"`
+	Failed    int64              `json:"failed"`
+	Rows      []*DomainImportRow `json:"rows"`
+}
+
+type DomainGroupExport struct {
+	*DomainGroupInfo
+	Domains []*DomainInfo `json:"domains"`
+}
+
+const (
+	DOMAIN_LIST_DEFAULT_LIMIT = 1000
+	DOMAIN_LIST_MAX_LIMIT     = 10000
+
+	DOMAIN_LIST_HTML = "html"
+	DOMAIN_LIST_TEXT = "text"
+	DOMAIN_LIST_JSON = "json"
+	DOMAIN_LIST_CSV  = "csv"
+)
+
+// DomainQuery filters GetDomains, -1 in Status or Type matches all.
+type DomainQuery struct {
+	GroupID int64
+	// TENANT_ALL for the domains of every tenant
+	TenantID int64
+	Status   int64
+	Type     int64
+	// substring of the domain
+	Name string
+	// a row per domain instead of per domain and group
+	Distinct bool
+	Offset   int64
+	Limit    int64
+}
+
+type DomainListItem struct {
+	ID        int64  `json:"id"`
+	GroupID   int64  `json:"groupID"`
+	GroupName string `json:"groupName"`
+	GroupType int64  `json:"groupType"`
+	Domain    string `json:"domain"`
+	Status    int64  `json:"status"`
+	// groups having the domain, of distinct rows
+	Groups int64  `json:"groups"`
+	Time   string `json:"time"`
+}
+
+type DomainListPage struct {
+	Total  int64             `json:"total"`
+	Offset int64             `json:"offset"`
+	Limit  int64             `json:"limit"`
+	List   []*DomainListItem `json:"list"`
+}
+
+const (
+	DOMAIN_EXPIRY_DEFAULT_DAYS = 30
+)
+
+type DomainExpiryInfo struct {
+	ID                    int64  `json:"id"`
+	GroupID               int64  `json:"groupID"`
+	Domain                string `json:"domain"`
+	Status                int64  `json:"status"`
+	RegistrationExpiresAt int64  `json:"registrationExpiresAt"`
+	CertExpiresAt         int64  `json:"certExpiresAt"`
+	// the earlier of both
+	ExpiresAt int64 `json:"expiresAt"`
+	DaysLeft  int64 `json:"daysLeft"`
+	Expired   bool  `json:"expired"`
+}
+
+const (
+	SHOW_GROUP_DEFAULT_WEIGHT = 1
+	SHOW_GROUP_MAX_WEIGHT     = 1000
+)
+
+type TopologyGroup struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Type    int64  `json:"type"`
+	Status  int64  `json:"status"`
+	Domains int64  `json:"domains"`
+	// domains that may be handed out, ok and not expired
+	OkDomains int64 `json:"okDomains"`
+	Healthy   bool  `json:"healthy"`
+}
+
+type TopologyEdge struct {
+	From   int64 `json:"from"`
+	To     int64 `json:"to"`
+	Weight int64 `json:"weight"`
+	// the show group is not loaded, it was deleted
+	Missing bool `json:"missing"`
+}
+
+type Topology struct {
+	Groups []*TopologyGroup `json:"groups"`
+	Edges  []*TopologyEdge  `json:"edges"`
+}
+
+const (
+	// scope of admin keys, and of callers without a key before the first key is added
+	TENANT_ALL = -1
+)
+
+type TenantInfo struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// quotas, 0 is unlimited
+	MaxDomainGroups  int64  `json:"maxDomainGroups"`
+	MaxContentGroups int64  `json:"maxContentGroups"`
+	MaxDomains       int64  `json:"maxDomains"`
+	Time             string `json:"time"`
+}
+
+type TenantUsage struct {
+	DomainGroups  int64 `json:"domainGroups"`
+	ContentGroups int64 `json:"contentGroups"`
+	Domains       int64 `json:"domains"`
+}
+
+type TenantDetail struct {
+	*TenantInfo
+	Usage *TenantUsage `json:"usage"`
+}
+
+type ApiKeyInfo struct {
+	ID int64 `json:"id"`
+	// 0 for an admin key
+	TenantID int64  `json:"tenantID"`
+	Name     string `json:"name"`
+	// only set in the answer of add_api_key
+	Key     string `json:"key,omitempty"`
+	KeyHash string `json:"-"`
+	Time    string `json:"time"`
+}
+
+type Event struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Time int64       `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+	// tenant of the group of the event, events of tenant 0 are for admins only
+	TenantID int64 `json:"-"`
+}
+
+type DomainStatusEvent struct {
+	DomainID int64  `json:"domainID"`
+	GroupID  int64  `json:"groupID"`
+	Domain   string `json:"domain"`
+	Status   int64  `json:"status"`
+	// check or api
+	Source string `json:"source"`
+}
+
+type GroupEvent struct {
+	// domain or content
+	Type    string `json:"type"`
+	GroupID int64  `json:"groupID"`
+	// added, updated or deleted
+	Action string `json:"action"`
+}
+
+type ContentPublishedEvent struct {
+	GroupID int64             `json:"groupID"`
+	JsonUrl string            `json:"jsonUrl"`
+	Urls    map[string]string `json:"urls"`
+}
+
+type WebhookInfo struct {
+	ID int64 `json:"id"`
+	// 0 receives the events of every tenant
+	TenantID   int64    `json:"tenantID"`
+	Url        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	Enabled    bool     `json:"enabled"`
+	// only set in the answer of add_webhook
+	Secret string `json:"secret,omitempty"`
+	Time   string `json:"time"`
+}
+
+type WebhookDelivery struct {
+	ID            int64  `json:"id"`
+	WebhookID     int64  `json:"webhookID"`
+	EventID       int64  `json:"eventID"`
+	EventType     string `json:"eventType"`
+	Payload       string `json:"payload"`
+	Status        int64  `json:"status"`
+	Attempts      int64  `json:"attempts"`
+	NextAttemptAt int64  `json:"nextAttemptAt"`
+	ResponseCode  int64  `json:"responseCode"`
+	LastError     string `json:"lastError"`
+	DeliveredAt   int64  `json:"deliveredAt"`
+	Time          string `json:"time"`
+	// of the webhook, set for sending
+	Url      string `json:"-"`
+	Secret   string `json:"-"`
+	TenantID int64  `json:"-"`
+}
+
+type AuditLogInfo struct {
+	ID       int64 `json:"id"`
+	TenantID int64 `json:"tenantID"`
+	// 0 for a caller without a key
+	ApiKeyID  int64  `json:"apiKeyID"`
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	RequestID string `json:"requestID"`
+	IP        string `json:"ip"`
+	Code      int64  `json:"code"`
+	Message   string `json:"message"`
+	Body      string `json:"body"`
+	Time      string `json:"time"`
+}
+
+type AuditLogQuery struct {
+	TenantID int64
+	Action   string
+	// rows older than BeforeID, 0 for the latest
+	BeforeID int64
+	Limit    int64
+}
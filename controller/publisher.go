@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"sort"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/reechou/x-real-control/config"
+)
+
+type PublishObject struct {
+	Name            string
+	Data            []byte
+	ContentType     string
+	ContentEncoding string
+}
+
+// Publisher uploads generated content and returns its public url.
+type Publisher interface {
+	Publish(obj *PublishObject) (string, error)
+	BaseUrl() string
+}
+
+// DefaultCORSRule lets browsers read published content from any origin.
+var DefaultCORSRule = oss.CORSRule{
+	AllowedOrigin: []string{"*"},
+	AllowedMethod: []string{"PUT", "GET"},
+	AllowedHeader: []string{},
+	ExposeHeader:  []string{},
+	MaxAgeSeconds: 200,
+}
+
+type OssPublisher struct {
+	aliyunInfo *config.AliyunOss
+}
+
+func NewOssPublisher(aliyunInfo *config.AliyunOss) *OssPublisher {
+	return &OssPublisher{aliyunInfo: aliyunInfo}
+}
+
+func (op *OssPublisher) Publish(obj *PublishObject) (string, error) {
+	bucket, err := op.aliyunInfo.AliyunClient.Bucket(op.aliyunInfo.Bucket)
+	if err != nil {
+		plog.Errorf("create bucket[%s] error: %v\n", op.aliyunInfo.Bucket, err)
+		return "", err
+	}
+	// oss uses the md5 as etag, so the same data always gets the same etag
+	sum := md5.Sum(obj.Data)
+	options := []oss.Option{
+		oss.ContentType(obj.ContentType),
+		oss.ContentMD5(base64.StdEncoding.EncodeToString(sum[:])),
+	}
+	if obj.ContentEncoding != "" {
+		options = append(options, oss.ContentEncoding(obj.ContentEncoding))
+	}
+	err = bucket.PutObject(obj.Name, bytes.NewReader(obj.Data), options...)
+	if err != nil {
+		plog.Errorf("put object[%s] bucket[%s] error: %v\n", obj.Name, op.aliyunInfo.Bucket, err)
+		return "", err
+	}
+	plog.Infof("aliyun publish file[%s] success.\n", obj.Name)
+
+	return op.aliyunInfo.Url + obj.Name, nil
+}
+
+func (op *OssPublisher) BaseUrl() string {
+	return op.aliyunInfo.Url
+}
+
+// Provision merges rule into the bucket CORS rules, keeping the rules set by others.
+// It only writes the bucket when the rule is not already covered, so it is safe to run repeatedly.
+func (op *OssPublisher) Provision(rule oss.CORSRule) error {
+	client := op.aliyunInfo.AliyunClient
+	var rules []oss.CORSRule
+	result, err := client.GetBucketCORS(op.aliyunInfo.Bucket)
+	if err != nil {
+		serr, ok := err.(oss.ServiceError)
+		if !ok || serr.Code != "NoSuchCORSConfiguration" {
+			plog.Errorf("get bucket[%s] cors error: %v\n", op.aliyunInfo.Bucket, err)
+			return err
+		}
+	} else {
+		rules = result.CORSRules
+	}
+
+	merged, changed := MergeCORSRules(rules, rule)
+	if !changed {
+		plog.Infof("bucket[%s] cors rule already provisioned.\n", op.aliyunInfo.Bucket)
+		return nil
+	}
+	err = client.SetBucketCORS(op.aliyunInfo.Bucket, merged)
+	if err != nil {
+		plog.Errorf("set bucket[%s] cors error: %v\n", op.aliyunInfo.Bucket, err)
+		return err
+	}
+	plog.Infof("bucket[%s] cors rule provisioned.\n", op.aliyunInfo.Bucket)
+
+	return nil
+}
+
+// MergeCORSRules adds the methods and headers of rule to the existing rule with the same origins,
+// or appends rule when there is none. changed is false when rules already cover rule.
+func MergeCORSRules(rules []oss.CORSRule, rule oss.CORSRule) ([]oss.CORSRule, bool) {
+	merged := make([]oss.CORSRule, len(rules))
+	copy(merged, rules)
+	for i, v := range merged {
+		if !sameStringSet(v.AllowedOrigin, rule.AllowedOrigin) {
+			continue
+		}
+		changed := false
+		v.AllowedMethod, changed = unionStrings(v.AllowedMethod, rule.AllowedMethod, changed)
+		v.AllowedHeader, changed = unionStrings(v.AllowedHeader, rule.AllowedHeader, changed)
+		v.ExposeHeader, changed = unionStrings(v.ExposeHeader, rule.ExposeHeader, changed)
+		if rule.MaxAgeSeconds > v.MaxAgeSeconds {
+			v.MaxAgeSeconds = rule.MaxAgeSeconds
+			changed = true
+		}
+		merged[i] = v
+		return merged, changed
+	}
+	return append(merged, rule), true
+}
+
+func unionStrings(dst, src []string, changed bool) ([]string, bool) {
+	result := append([]string{}, dst...)
+	for _, s := range src {
+		found := false
+		for _, d := range dst {
+			if d == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, s)
+			changed = true
+		}
+	}
+	return result, changed
+}
+
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string{}, a...)
+	sb := append([]string{}, b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
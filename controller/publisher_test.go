@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+func TestMergeCORSRules(t *testing.T) {
+	other := oss.CORSRule{
+		AllowedOrigin: []string{"http://a.com"},
+		AllowedMethod: []string{"GET"},
+	}
+
+	merged, changed := MergeCORSRules([]oss.CORSRule{other}, DefaultCORSRule)
+	if !changed || len(merged) != 2 {
+		t.Fatalf("rule should be appended, changed[%v] rules: %v", changed, merged)
+	}
+	if merged[0].AllowedOrigin[0] != "http://a.com" {
+		t.Fatalf("other rule should be kept: %v", merged)
+	}
+
+	merged, changed = MergeCORSRules(merged, DefaultCORSRule)
+	if changed || len(merged) != 2 {
+		t.Fatalf("merge should be idempotent, changed[%v] rules: %v", changed, merged)
+	}
+
+	partial := oss.CORSRule{
+		AllowedOrigin: []string{"*"},
+		AllowedMethod: []string{"GET", "HEAD"},
+		MaxAgeSeconds: 60,
+	}
+	merged, changed = MergeCORSRules([]oss.CORSRule{partial}, DefaultCORSRule)
+	if !changed || len(merged) != 1 {
+		t.Fatalf("rule with same origin should be merged, changed[%v] rules: %v", changed, merged)
+	}
+	if len(merged[0].AllowedMethod) != 3 || merged[0].MaxAgeSeconds != DefaultCORSRule.MaxAgeSeconds {
+		t.Fatalf("merged rule error: %v", merged[0])
+	}
+	if len(partial.AllowedMethod) != 2 {
+		t.Fatalf("existing rules should not be modified: %v", partial)
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	ROUTE_CLASS_PUBLIC = "public"
+	ROUTE_CLASS_ADMIN  = "admin"
+
+	API_KEY_HEADER = "X-API-Key"
+)
+
+// publicRoutes serve end users, every other route is admin.
+var publicRoutes = map[string]bool{
+	"/domain/get_url":   true,
+	"/domain/get_data":  true,
+	CONTENT_PATH_PREFIX: true,
+}
+
+func newRateLimiter(clock utils.Clock, perMinute, burst int) *utils.RateLimiter {
+	return utils.NewRateLimiter(clock, float64(perMinute)/60, burst)
+}
+
+func (cl *ControllerLogic) setRateLimits(cfg *config.Config) {
+	cl.publicLimiter.SetLimit(float64(cfg.PublicRateLimit)/60, cfg.PublicRateBurst)
+	cl.adminLimiter.SetLimit(float64(cfg.AdminRateLimit)/60, cfg.AdminRateBurst)
+}
+
+// rateLimitKey limits by the id of the api key of the caller, of its session for the admin ui.
+// Callers are limited by client ip until their key is known, a made up key has no bucket of its own.
+func (xhs *XHttpServer) rateLimitKey(req *http.Request) string {
+	var info *ApiKeyInfo
+	if key := req.Header.Get(API_KEY_HEADER); key != "" {
+		info = xhs.logic.apiKeyByHash(HashApiKey(key))
+	} else if cookie, err := req.Cookie(ADMIN_SESSION_COOKIE); err == nil && req.Header.Get(ADMIN_SESSION_HEADER) != "" {
+		info = xhs.logic.apiKeyByHash(xhs.logic.sessions.KeyHash(cookie.Value))
+	}
+	if info != nil {
+		return fmt.Sprintf("key:%d", info.ID)
+	}
+	return "ip:" + xhs.logic.TrustedProxies().ClientIP(req)
+}
+
+func (xhs *XHttpServer) rateLimit(limiter *utils.RateLimiter, f http.HandlerFunc) http.HandlerFunc {
+	return func(rsp http.ResponseWriter, req *http.Request) {
+		ok, retryAfter := limiter.Allow(xhs.rateLimitKey(req))
+		if ok {
+			f(rsp, req)
+			return
+		}
+		requestLogger(req).Debugf("rate limited: url[%s] retry after[%v]\n", req.URL.String(), retryAfter)
+		buf, _ := json.Marshal(&Response{Code: RES_ERR, Msg: "too many requests"})
+		rsp.Header().Set("Retry-After", fmt.Sprintf("%d", int64(math.Ceil(retryAfter.Seconds()))))
+		rsp.Header().Set("Content-Type", "application/json")
+		rsp.Header().Set("Access-Control-Allow-Origin", "*")
+		rsp.WriteHeader(http.StatusTooManyRequests)
+		rsp.Write(buf)
+	}
+}
+
+// limitRoutes puts every registered route behind the limiter of its class.
+func (xhs *XHttpServer) limitRoutes() {
+	for p, f := range xhs.hs.Routers {
+		limiter := xhs.logic.adminLimiter
+		if publicRoutes[p] {
+			limiter = xhs.logic.publicLimiter
+		}
+		xhs.hs.Routers[p] = xhs.rateLimit(limiter, f)
+	}
+}
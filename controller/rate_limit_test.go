@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
+)
+
+func TestRateLimitBogusKeys(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1500000000, 0))
+	cl := &ControllerLogic{
+		cfg:          &config.Config{},
+		clock:        clock,
+		apiKeys:      map[string]*ApiKeyInfo{HashApiKey("admin"): {ID: 1}},
+		sessions:     NewAdminSessions(clock),
+		adminLimiter: newRateLimiter(clock, 60, 2),
+	}
+	xhs := &XHttpServer{logic: cl}
+	h := xhs.rateLimit(cl.adminLimiter, func(rsp http.ResponseWriter, req *http.Request) {})
+	call := func(key string) int {
+		req, _ := http.NewRequest("POST", "/domain/add_api_key", nil)
+		req.RemoteAddr = "192.0.2.1:5000"
+		if key != "" {
+			req.Header.Set(API_KEY_HEADER, key)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	// a new made up key on every request shares the bucket of the ip
+	for i := 0; i < 2; i++ {
+		if code := call(fmt.Sprintf("guess-%d", i)); code != http.StatusOK {
+			t.Fatalf("guess %d: got %d", i, code)
+		}
+	}
+	if code := call("guess-2"); code != http.StatusTooManyRequests {
+		t.Errorf("third guess: got %d", code)
+	}
+	if code := call(""); code != http.StatusTooManyRequests {
+		t.Errorf("no key from the same ip: got %d", code)
+	}
+	// a real key has a bucket of its own
+	if code := call("admin"); code != http.StatusOK {
+		t.Errorf("admin key: got %d", code)
+	}
+	if n := cl.adminLimiter.Stats().Keys; n != 2 {
+		t.Errorf("buckets: got %d, want the ip and the key", n)
+	}
+}
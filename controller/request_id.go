@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	REQUEST_ID_HEADER  = "X-Request-ID"
+	REQUEST_ID_MAX_LEN = 64
+)
+
+// requestID returns the X-Request-ID of the caller when it is usable, or a new one.
+func requestID(req *http.Request) string {
+	if id := req.Header.Get(REQUEST_ID_HEADER); validRequestID(id) {
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > REQUEST_ID_MAX_LEN {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+func requestLogger(req *http.Request) *utils.Logger {
+	return logger.With(utils.LOG_REQUEST_ID, req.Header.Get(REQUEST_ID_HEADER))
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SERVE_STAT_DOMAIN  = "domain"
+	SERVE_STAT_CONTENT = "content"
+
+	SERVE_STATS_FLUSH_INTERVAL = time.Minute
+	SERVE_STATS_MAX_ROWS       = 10000
+	SERVE_STATS_DEFAULT_RANGE  = 24 * 60 * 60
+)
+
+type serveStatKey struct {
+	minute   int64
+	kind     string
+	groupID  int64
+	domainID int64
+}
+
+// ServeStats counts served domains and content groups per minute in memory,
+// until they are flushed into serve_stats.
+type ServeStats struct {
+	sync.Mutex
+
+	counts map[serveStatKey]int64
+}
+
+func NewServeStats() *ServeStats {
+	return &ServeStats{counts: make(map[serveStatKey]int64)}
+}
+
+func (ss *ServeStats) Add(kind string, groupID, domainID int64, now time.Time) {
+	key := serveStatKey{
+		minute:   now.Unix() / 60 * 60,
+		kind:     kind,
+		groupID:  groupID,
+		domainID: domainID,
+	}
+	ss.Lock()
+	ss.counts[key]++
+	ss.Unlock()
+}
+
+// Take returns the counts so far and resets them.
+func (ss *ServeStats) Take() []*ServeStatInfo {
+	ss.Lock()
+	counts := ss.counts
+	ss.counts = make(map[serveStatKey]int64)
+	ss.Unlock()
+
+	list := make([]*ServeStatInfo, 0, len(counts))
+	for k, v := range counts {
+		list = append(list, &ServeStatInfo{
+			Time:     k.minute,
+			Kind:     k.kind,
+			GroupID:  k.groupID,
+			DomainID: k.domainID,
+			Count:    v,
+		})
+	}
+	return list
+}
+
+// Restore adds back counts that could not be flushed.
+func (ss *ServeStats) Restore(list []*ServeStatInfo) {
+	ss.Lock()
+	defer ss.Unlock()
+	for _, v := range list {
+		ss.counts[serveStatKey{minute: v.Time, kind: v.Kind, groupID: v.GroupID, domainID: v.DomainID}] += v.Count
+	}
+}
+
+func WriteServeStatsCSV(w io.Writer, list []*ServeStatInfo) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "kind", "group_id", "domain_id", "count"})
+	for _, v := range list {
+		cw.Write([]string{
+			time.Unix(v.Time, 0).Format("2006-01-02 15:04:05"),
+			v.Kind,
+			strconv.FormatInt(v.GroupID, 10),
+			strconv.FormatInt(v.DomainID, 10),
+			strconv.FormatInt(v.Count, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestServeStats(t *testing.T) {
+	ss := NewServeStats()
+	now := time.Unix(1500000030, 0)
+	ss.Add(SERVE_STAT_DOMAIN, 1, 10, now)
+	ss.Add(SERVE_STAT_DOMAIN, 1, 10, now.Add(20*time.Second))
+	ss.Add(SERVE_STAT_DOMAIN, 1, 10, now.Add(40*time.Second))
+	ss.Add(SERVE_STAT_CONTENT, 2, 0, now)
+
+	list := ss.Take()
+	counts := make(map[serveStatKey]int64)
+	for _, v := range list {
+		counts[serveStatKey{minute: v.Time, kind: v.Kind, groupID: v.GroupID, domainID: v.DomainID}] = v.Count
+	}
+	minute := int64(1500000000)
+	if len(list) != 3 ||
+		counts[serveStatKey{minute, SERVE_STAT_DOMAIN, 1, 10}] != 2 ||
+		counts[serveStatKey{minute + 60, SERVE_STAT_DOMAIN, 1, 10}] != 1 ||
+		counts[serveStatKey{minute, SERVE_STAT_CONTENT, 2, 0}] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	if len(ss.Take()) != 0 {
+		t.Fatal("take did not reset")
+	}
+
+	ss.Restore(list)
+	ss.Add(SERVE_STAT_CONTENT, 2, 0, now)
+	for _, v := range ss.Take() {
+		if v.Kind == SERVE_STAT_CONTENT && v.Count != 2 {
+			t.Fatalf("restored count %d", v.Count)
+		}
+	}
+}
+
+func TestWriteServeStatsCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	list := []*ServeStatInfo{{Time: time.Date(2017, 7, 14, 2, 40, 0, 0, time.Local).Unix(), Kind: SERVE_STAT_DOMAIN, GroupID: 1, DomainID: 10, Count: 3}}
+	if err := WriteServeStatsCSV(buf, list); err != nil {
+		t.Fatal(err)
+	}
+	want := "time,kind,group_id,domain_id,count\n2017-07-14 02:40:00,domain,1,10,3\n"
+	if buf.String() != want {
+		t.Fatalf("csv:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetShowGroups sets the show groups of a jump group, with ShowGroupList and ShowListStr kept alike.
+func (info *DomainGroupInfo) SetShowGroups(shows []*DomainGroupShow) {
+	info.ShowGroups = shows
+	info.ShowGroupList = nil
+	ids := make([]string, 0, len(shows))
+	for _, v := range shows {
+		info.ShowGroupList = append(info.ShowGroupList, v.ShowGroupID)
+		ids = append(ids, strconv.FormatInt(v.ShowGroupID, 10))
+	}
+	info.ShowListStr = strings.Join(ids, ",")
+}
+
+// NormalizeShowGroups takes the show groups of a write from ShowGroups, or from ShowGroupList
+// for clients sending ids only, and gives them the default weight when it is 0.
+func NormalizeShowGroups(info *DomainGroupInfo) {
+	shows := info.ShowGroups
+	if len(shows) == 0 {
+		for _, id := range info.ShowGroupList {
+			shows = append(shows, &DomainGroupShow{ShowGroupID: id})
+		}
+	}
+	for _, v := range shows {
+		if v.Weight == 0 {
+			v.Weight = SHOW_GROUP_DEFAULT_WEIGHT
+		}
+	}
+	info.SetShowGroups(shows)
+}
+
+// ValidateShowGroups checks update, the new type and show groups of a group, against all groups:
+// only jump groups have show groups, which must exist, be show groups and not repeat;
+// a group turning into a jump group must not be the show group of others; and no references form a cycle.
+func ValidateShowGroups(groups map[int64]*DomainGroupInfo, update *DomainGroupInfo) error {
+	if update.Type != DOMAIN_GROUP_TYPE_JUMP && len(update.ShowGroups) != 0 {
+		return fmt.Errorf("group[%d] is not a jump group, only jump groups have show groups", update.ID)
+	}
+	seen := make(map[int64]bool)
+	for _, v := range update.ShowGroups {
+		if v.ShowGroupID == update.ID {
+			return fmt.Errorf("group[%d] cannot show itself", update.ID)
+		}
+		if seen[v.ShowGroupID] {
+			return fmt.Errorf("show group[%d] is listed twice", v.ShowGroupID)
+		}
+		seen[v.ShowGroupID] = true
+		if v.Weight < 1 || v.Weight > SHOW_GROUP_MAX_WEIGHT {
+			return fmt.Errorf("show group[%d] weight %d must be in 1..%d", v.ShowGroupID, v.Weight, SHOW_GROUP_MAX_WEIGHT)
+		}
+		g := groups[v.ShowGroupID]
+		if g == nil {
+			return fmt.Errorf("show group[%d] does not exist", v.ShowGroupID)
+		}
+		if g.Type != DOMAIN_GROUP_TYPE_SHOW {
+			return fmt.Errorf("group[%d] is not a show group", v.ShowGroupID)
+		}
+	}
+	if update.Type != DOMAIN_GROUP_TYPE_SHOW {
+		var users []int64
+		for id, g := range groups {
+			if id == update.ID {
+				continue
+			}
+			for _, v := range g.ShowGroups {
+				if v.ShowGroupID == update.ID {
+					users = append(users, id)
+				}
+			}
+		}
+		if len(users) != 0 {
+			sort.Sort(int64Slice(users))
+			return fmt.Errorf("group[%d] is the show group of jump groups %v, remove it there first", update.ID, users)
+		}
+	}
+
+	edges := make(map[int64][]int64)
+	for id, g := range groups {
+		if id == update.ID {
+			continue
+		}
+		for _, v := range g.ShowGroups {
+			edges[id] = append(edges[id], v.ShowGroupID)
+		}
+	}
+	for _, v := range update.ShowGroups {
+		edges[update.ID] = append(edges[update.ID], v.ShowGroupID)
+	}
+	if cycle := findCycle(edges, update.ID); cycle != nil {
+		return fmt.Errorf("show groups form a cycle %v", cycle)
+	}
+	return nil
+}
+
+// findCycle returns a path from start back to a group already on it, or nil.
+func findCycle(edges map[int64][]int64, start int64) []int64 {
+	var path []int64
+	onPath := make(map[int64]bool)
+	done := make(map[int64]bool)
+	var visit func(id int64) []int64
+	visit = func(id int64) []int64 {
+		if onPath[id] {
+			return append(append([]int64{}, path...), id)
+		}
+		if done[id] {
+			return nil
+		}
+		onPath[id] = true
+		path = append(path, id)
+		for _, next := range edges[id] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		onPath[id] = false
+		done[id] = true
+		return nil
+	}
+	return visit(start)
+}
+
+// pickShowGroup selects among the healthy show groups by smooth weighted round robin,
+// current keeps the running weights of a jump group between picks.
+func pickShowGroup(shows []*DomainGroupShow, current map[int64]int64, healthy func(id int64) bool) *DomainGroupShow {
+	var best *DomainGroupShow
+	var total int64
+	for _, v := range shows {
+		if v.Weight <= 0 || !healthy(v.ShowGroupID) {
+			continue
+		}
+		current[v.ShowGroupID] += v.Weight
+		total += v.Weight
+		if best == nil || current[v.ShowGroupID] > current[best.ShowGroupID] {
+			best = v
+		}
+	}
+	if best != nil {
+		current[best.ShowGroupID] -= total
+	}
+	return best
+}
+
+// groupHealthy tells if a group is online and has a domain to hand out at now.
+func groupHealthy(v *DomainMapInfo, now int64) (bool, int64) {
+	var ok int64
+	if v.domainList != nil {
+		for _, d := range v.domainList.DomainList {
+			if d.Status == DOMAIN_STATUS_OK && !d.Expired(now) {
+				ok++
+			}
+		}
+	}
+	return v.groupInfo.Status == DOMAIN_STATUS_OK && ok > 0, ok
+}
+
+// ValidateDomainGroupUpdate normalizes the show groups of update and checks them against the groups of its tenant in db.
+func (cl *ControllerLogic) ValidateDomainGroupUpdate(update *DomainGroupInfo) error {
+	NormalizeShowGroups(update)
+	list, _, err := cl.cdb.GetDomainGroupList(0)
+	if err != nil {
+		return err
+	}
+	var current *DomainGroupInfo
+	for _, v := range list {
+		if v.ID == update.ID {
+			current = v
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("no this[%d] domain group!", update.ID)
+	}
+	// groups of other tenants are not seen as show groups
+	groups := make(map[int64]*DomainGroupInfo, len(list))
+	for _, v := range list {
+		if v.TenantID == current.TenantID {
+			groups[v.ID] = v
+		}
+	}
+	return ValidateShowGroups(groups, update)
+}
+
+// Topology returns the loaded groups of a tenant with their health, and the jump to show references.
+func (cl *ControllerLogic) Topology(tenantID int64) *Topology {
+	cl.Lock()
+	defer cl.Unlock()
+
+	now := cl.clock.Now().Unix()
+	topo := &Topology{
+		Groups: make([]*TopologyGroup, 0, len(cl.domainMap)),
+		Edges:  make([]*TopologyEdge, 0),
+	}
+	for id, v := range cl.domainMap {
+		if !cl.domainGroupInTenant(id, tenantID) {
+			continue
+		}
+		healthy, ok := groupHealthy(v, now)
+		g := &TopologyGroup{
+			ID:        id,
+			Name:      v.groupInfo.Name,
+			Type:      v.groupInfo.Type,
+			Status:    v.groupInfo.Status,
+			OkDomains: ok,
+			Healthy:   healthy,
+		}
+		if v.domainList != nil {
+			g.Domains = int64(len(v.domainList.DomainList))
+		}
+		topo.Groups = append(topo.Groups, g)
+		for _, s := range v.groupInfo.ShowGroups {
+			topo.Edges = append(topo.Edges, &TopologyEdge{
+				From:    id,
+				To:      s.ShowGroupID,
+				Weight:  s.Weight,
+				Missing: cl.domainMap[s.ShowGroupID] == nil,
+			})
+		}
+	}
+	sort.Sort(topologyGroups(topo.Groups))
+	sort.Sort(topologyEdges(topo.Edges))
+	return topo
+}
+
+// WriteTopologyDot writes the topology as a graphviz digraph, unhealthy groups in red and missing ones dashed.
+func WriteTopologyDot(w io.Writer, topo *Topology) error {
+	var buf bytes.Buffer
+	buf.WriteString("digraph show_groups {\n\trankdir=LR;\n")
+	for _, g := range topo.Groups {
+		shape := "box"
+		if g.Type == DOMAIN_GROUP_TYPE_JUMP {
+			shape = "ellipse"
+		}
+		color := "darkgreen"
+		if !g.Healthy {
+			color = "red"
+		}
+		fmt.Fprintf(&buf, "\t%d [label=%q shape=%s color=%s];\n", g.ID,
+			fmt.Sprintf("%d %s\n%d/%d domains ok", g.ID, g.Name, g.OkDomains, g.Domains), shape, color)
+	}
+	for _, e := range topo.Edges {
+		if e.Missing {
+			fmt.Fprintf(&buf, "\t%d [label=%q style=dashed color=gray];\n", e.To, fmt.Sprintf("%d missing", e.To))
+		}
+		fmt.Fprintf(&buf, "\t%d -> %d [label=\"%d\"];\n", e.From, e.To, e.Weight)
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+
+type topologyGroups []*TopologyGroup
+
+func (s topologyGroups) Len() int           { return len(s) }
+func (s topologyGroups) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s topologyGroups) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+type topologyEdges []*TopologyEdge
+
+func (s topologyEdges) Len() int      { return len(s) }
+func (s topologyEdges) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s topologyEdges) Less(i, j int) bool {
+	if s[i].From != s[j].From {
+		return s[i].From < s[j].From
+	}
+	return s[i].To < s[j].To
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidateShowGroups(t *testing.T) {
+	groups := map[int64]*DomainGroupInfo{
+		1: {ID: 1, Type: DOMAIN_GROUP_TYPE_SHOW},
+		2: {ID: 2, Type: DOMAIN_GROUP_TYPE_SHOW},
+		3: {ID: 3, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: []*DomainGroupShow{{ShowGroupID: 1, Weight: 1}}},
+		4: {ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP},
+	}
+	shows := func(ids ...int64) []*DomainGroupShow {
+		var list []*DomainGroupShow
+		for _, id := range ids {
+			list = append(list, &DomainGroupShow{ShowGroupID: id, Weight: 1})
+		}
+		return list
+	}
+
+	ok := []*DomainGroupInfo{
+		{ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: shows(1, 2)},
+		{ID: 3, Type: DOMAIN_GROUP_TYPE_JUMP},
+		{ID: 2, Type: DOMAIN_GROUP_TYPE_SHOW},
+	}
+	for _, update := range ok {
+		if err := ValidateShowGroups(groups, update); err != nil {
+			t.Errorf("group %d: %v", update.ID, err)
+		}
+	}
+
+	bad := map[string]*DomainGroupInfo{
+		"not a jump group": {ID: 2, Type: DOMAIN_GROUP_TYPE_SHOW, ShowGroups: shows(1)},
+		"itself":           {ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: shows(4)},
+		"listed twice":     {ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: shows(1, 1)},
+		"does not exist":   {ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: shows(9)},
+		"is not a show":    {ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: shows(3)},
+		"show group of":    {ID: 1, Type: DOMAIN_GROUP_TYPE_JUMP},
+		"weight":           {ID: 4, Type: DOMAIN_GROUP_TYPE_JUMP, ShowGroups: []*DomainGroupShow{{ShowGroupID: 1, Weight: -1}}},
+	}
+	for want, update := range bad {
+		err := ValidateShowGroups(groups, update)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v", want, err)
+		}
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	edges := map[int64][]int64{1: {2}, 2: {3}, 3: {4}}
+	if cycle := findCycle(edges, 1); cycle != nil {
+		t.Fatalf("chain has cycle %v", cycle)
+	}
+	edges[4] = []int64{2}
+	cycle := findCycle(edges, 1)
+	if len(cycle) != 5 || cycle[0] != 1 || cycle[4] != 2 {
+		t.Fatalf("cycle %v", cycle)
+	}
+}
+
+func TestPickShowGroup(t *testing.T) {
+	shows := []*DomainGroupShow{
+		{ShowGroupID: 1, Weight: 5},
+		{ShowGroupID: 2, Weight: 1},
+		{ShowGroupID: 3, Weight: 1},
+	}
+	current := make(map[int64]int64)
+	all := func(id int64) bool { return true }
+
+	var got []int64
+	for i := 0; i < 7; i++ {
+		got = append(got, pickShowGroup(shows, current, all).ShowGroupID)
+	}
+	// smooth: the heavy group is spread out, not picked 5 times in a row
+	want := []int64{1, 1, 2, 1, 3, 1, 1}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("picks %v, want %v", got, want)
+		}
+	}
+
+	notFirst := func(id int64) bool { return id != 1 }
+	counts := make(map[int64]int)
+	for i := 0; i < 10; i++ {
+		counts[pickShowGroup(shows, current, notFirst).ShowGroupID]++
+	}
+	if counts[1] != 0 || counts[2] != 5 || counts[3] != 5 {
+		t.Fatalf("unhealthy group picked: %v", counts)
+	}
+
+	if pickShowGroup(shows, current, func(id int64) bool { return false }) != nil {
+		t.Fatal("picked without healthy groups")
+	}
+}
+
+func TestWriteTopologyDot(t *testing.T) {
+	topo := &Topology{
+		Groups: []*TopologyGroup{
+			{ID: 1, Name: "show", Type: DOMAIN_GROUP_TYPE_SHOW, Domains: 2, OkDomains: 1, Healthy: true},
+			{ID: 3, Name: "jump", Type: DOMAIN_GROUP_TYPE_JUMP},
+		},
+		Edges: []*TopologyEdge{
+			{From: 3, To: 1, Weight: 2},
+			{From: 3, To: 9, Weight: 1, Missing: true},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteTopologyDot(&buf, topo); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"digraph show_groups {", `3 -> 1 [label="2"]`, "9 [label=\"9 missing\" style=dashed", "color=red", "1/2 domains ok"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in\n%s", want, out)
+		}
+	}
+}
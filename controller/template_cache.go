@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+// TemplateCache keeps a parsed template file, and parses it again only after the file changes.
+type TemplateCache struct {
+	sync.Mutex
+
+	path    string
+	modTime time.Time
+	size    int64
+	tpl     *template.Template
+}
+
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{}
+}
+
+// Get returns the template of path. A file that fails to parse keeps serving its last good version,
+// the error is logged to log, the logger of the request.
+func (tc *TemplateCache) Get(log *utils.Logger, path string) (*template.Template, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.Lock()
+	defer tc.Unlock()
+
+	if tc.tpl != nil && tc.path == path && tc.modTime.Equal(fi.ModTime()) && tc.size == fi.Size() {
+		return tc.tpl, nil
+	}
+	// the template is named by the file, as Execute runs the template of that name
+	tpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		if tc.tpl != nil && tc.path == path {
+			log.Errorf("template[%s] parse error, keep the last one: %v\n", path, err)
+			return tc.tpl, nil
+		}
+		return nil, err
+	}
+	tc.path = path
+	tc.modTime = fi.ModTime()
+	tc.size = fi.Size()
+	tc.tpl = tpl
+	return tpl, nil
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTemplateCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "list.tpl")
+
+	render := func(tc *TemplateCache) string {
+		tpl, err := tc.Get(logger, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, "x"); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	write := func(s string, mtime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tc := NewTemplateCache()
+	now := time.Now()
+	write("a{{.}}", now)
+	if got := render(tc); got != "ax" {
+		t.Fatalf("got %q", got)
+	}
+	first, _ := tc.Get(logger, path)
+	if second, _ := tc.Get(logger, path); second != first {
+		t.Fatal("unchanged file parsed again")
+	}
+
+	write("b{{.}}", now.Add(time.Second))
+	if got := render(tc); got != "bx" {
+		t.Fatalf("changed file: got %q", got)
+	}
+
+	// a broken file keeps the last good template
+	write("c{{.", now.Add(2*time.Second))
+	if got := render(tc); got != "bx" {
+		t.Fatalf("broken file: got %q", got)
+	}
+
+	if _, err := NewTemplateCache().Get(logger, filepath.Join(dir, "missing.tpl")); err == nil {
+		t.Fatal("missing file has a template")
+	}
+}
@@ -0,0 +1,518 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	// set by authorize from the api key of the caller, a value sent by the client is replaced
+	TENANT_HEADER = "X-Xrc-Tenant"
+	// set by authorize like TENANT_HEADER, 0 for callers without a key
+	API_KEY_ID_HEADER = "X-Xrc-Api-Key-Id"
+
+	TENANT_NAME_MAX_LEN = 64
+	API_KEY_BYTES       = 24
+)
+
+// adminRoutes act on the whole controller, tenant keys are refused.
+var adminRoutes = map[string]bool{
+	"/domain/get_config":       true,
+	"/domain/reload_config":    true,
+	"/domain/provision_bucket": true,
+	"/domain/get_schedule":     true,
+	"/domain/probe_certs":      true,
+	"/domain/add_tenant":       true,
+	"/domain/update_tenant":    true,
+	"/domain/delete_tenant":    true,
+	"/domain/set_group_tenant": true,
+	"/domain/add_api_key":      true,
+	"/domain/get_api_keys":     true,
+	"/domain/delete_api_key":   true,
+	"/metrics":                 true,
+}
+
+var (
+	ErrApiKeyRequired = errors.New("api key required")
+	ErrApiKeyInvalid  = errors.New("invalid api key")
+	ErrAdminOnly      = errors.New("admin api key required")
+)
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewApiKey() (string, error) {
+	b := make([]byte, API_KEY_BYTES)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// LoadApiKeys replaces the api keys known to the controller by those in db.
+func (cl *ControllerLogic) LoadApiKeys() error {
+	list, err := cl.cdb.GetApiKeyList(TENANT_ALL)
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*ApiKeyInfo, len(list))
+	for _, v := range list {
+		keys[v.KeyHash] = v
+	}
+	cl.keyMutex.Lock()
+	cl.apiKeys = keys
+	cl.keyMutex.Unlock()
+	return nil
+}
+
+// Authorize returns the tenant of a caller by its api key, TENANT_ALL for admin keys.
+// Callers without a key see every tenant on public routes. On the others they do only until
+// the first api key is added, to add it, and never when RequireApiKey is set.
+func (cl *ControllerLogic) Authorize(key string, public, adminOnly bool) (int64, error) {
+	if key == "" {
+		if public || !cl.Config().RequireApiKey && !cl.hasApiKeys() {
+			return TENANT_ALL, nil
+		}
+		return 0, ErrApiKeyRequired
+	}
+	info := cl.apiKeyByHash(HashApiKey(key))
+	if info == nil {
+		return 0, ErrApiKeyInvalid
+	}
+	return keyTenant(info, adminOnly)
+}
+
+func keyTenant(info *ApiKeyInfo, adminOnly bool) (int64, error) {
+	if info.TenantID == 0 {
+		return TENANT_ALL, nil
+	}
+	if adminOnly {
+		return 0, ErrAdminOnly
+	}
+	return info.TenantID, nil
+}
+
+func (cl *ControllerLogic) hasApiKeys() bool {
+	cl.keyMutex.RLock()
+	defer cl.keyMutex.RUnlock()
+	return len(cl.apiKeys) != 0
+}
+
+func (cl *ControllerLogic) apiKeyByHash(keyHash string) *ApiKeyInfo {
+	cl.keyMutex.RLock()
+	defer cl.keyMutex.RUnlock()
+	return cl.apiKeys[keyHash]
+}
+
+func (cl *ControllerLogic) apiKeyByID(id int64) *ApiKeyInfo {
+	cl.keyMutex.RLock()
+	defer cl.keyMutex.RUnlock()
+	for _, v := range cl.apiKeys {
+		if v.ID == id {
+			return v
+		}
+	}
+	return nil
+}
+
+// authorize sets the tenant and the key id of the caller on the request. Callers of the admin ui
+// send no key but the cookie of their session, with ADMIN_SESSION_HEADER.
+func (xhs *XHttpServer) authorize(path string, f http.HandlerFunc) http.HandlerFunc {
+	public, adminOnly := publicRoutes[path] || adminUIRoutes[path], adminRoutes[path]
+	return func(rsp http.ResponseWriter, req *http.Request) {
+		var tenantID, keyID int64
+		var err error
+		key := req.Header.Get(API_KEY_HEADER)
+		cookie, cookieErr := req.Cookie(ADMIN_SESSION_COOKIE)
+		if key == "" && req.Header.Get(ADMIN_SESSION_HEADER) != "" && cookieErr == nil && !adminUIRoutes[path] {
+			var info *ApiKeyInfo
+			tenantID, info, err = xhs.logic.AuthorizeSession(cookie.Value, adminOnly)
+			if info != nil {
+				keyID = info.ID
+			}
+		} else {
+			tenantID, err = xhs.logic.Authorize(key, public, adminOnly)
+			if key != "" && err == nil {
+				// the keys may have been reloaded since
+				if info := xhs.logic.apiKeyByHash(HashApiKey(key)); info != nil {
+					keyID = info.ID
+				}
+			}
+		}
+		if err != nil {
+			code := http.StatusUnauthorized
+			if err == ErrAdminOnly {
+				code = http.StatusForbidden
+			}
+			requestLogger(req).Debugf("unauthorized: url[%s] error: %v\n", req.URL.String(), err)
+			rsp.Header().Set("Access-Control-Allow-Origin", "*")
+			ResponseJSON(rsp, code, &Response{Code: RES_ERR, Msg: err.Error()})
+			return
+		}
+		req.Header.Set(TENANT_HEADER, strconv.FormatInt(tenantID, 10))
+		req.Header.Set(API_KEY_ID_HEADER, strconv.FormatInt(keyID, 10))
+		f(rsp, req)
+	}
+}
+
+// authRoutes resolves the tenant of every registered route.
+func (xhs *XHttpServer) authRoutes() {
+	for p, f := range xhs.hs.Routers {
+		xhs.hs.Routers[p] = xhs.authorize(p, f)
+	}
+}
+
+// callerTenant is the tenant set by authorize, TENANT_ALL for handlers called without it.
+func callerTenant(req *http.Request) int64 {
+	id, err := strconv.ParseInt(req.Header.Get(TENANT_HEADER), 10, 0)
+	if err != nil {
+		return TENANT_ALL
+	}
+	return id
+}
+
+// publicTenant is the tenant of a caller of a public route: the one of its api key,
+// or without a key the one it asks for, 0 asking for every tenant.
+func publicTenant(req *http.Request, requested int64) int64 {
+	if tenantID := callerTenant(req); tenantID != TENANT_ALL || requested == 0 {
+		return tenantID
+	}
+	return requested
+}
+
+// CheckDomainGroupTenant fails when a domain group is not of the tenant, a group of another tenant is reported missing.
+func (cl *ControllerLogic) CheckDomainGroupTenant(tenantID, groupID int64) error {
+	if tenantID == TENANT_ALL {
+		return nil
+	}
+	owner, err := cl.cdb.GetDomainGroupTenant(groupID)
+	if err != nil {
+		return err
+	}
+	if owner != tenantID {
+		return fmt.Errorf("no this[%d] domain group!", groupID)
+	}
+	return nil
+}
+
+func (cl *ControllerLogic) CheckContentGroupTenant(tenantID, groupID int64) error {
+	if tenantID == TENANT_ALL {
+		return nil
+	}
+	owner, err := cl.cdb.GetContentGroupTenant(groupID)
+	if err != nil {
+		return err
+	}
+	if owner != tenantID {
+		return fmt.Errorf("no this[%d] content group!", groupID)
+	}
+	return nil
+}
+
+// CheckGroupTenant checks a domain group or a content group by the check type.
+func (cl *ControllerLogic) CheckGroupTenant(checkType string, tenantID, groupID int64) error {
+	switch checkType {
+	case CHECK_TYPE_DOMAIN:
+		return cl.CheckDomainGroupTenant(tenantID, groupID)
+	case CHECK_TYPE_CONTENT:
+		return cl.CheckContentGroupTenant(tenantID, groupID)
+	}
+	return fmt.Errorf("unknown check type[%s]!", checkType)
+}
+
+func (cl *ControllerLogic) CheckDomainTenant(tenantID, domainID int64) error {
+	if tenantID == TENANT_ALL {
+		return nil
+	}
+	domain := &DomainInfo{ID: domainID}
+	if err := cl.cdb.GetDomainFromID(domain); err != nil {
+		return err
+	}
+	if err := cl.CheckDomainGroupTenant(tenantID, domain.GroupID); err != nil {
+		return fmt.Errorf("no this[%d] domain!", domainID)
+	}
+	return nil
+}
+
+func (cl *ControllerLogic) CheckContentTenant(tenantID, contentID int64) error {
+	if tenantID == TENANT_ALL {
+		return nil
+	}
+	content := &ContentInfo{ID: contentID}
+	if err := cl.cdb.GetContentFromID(content); err != nil {
+		return err
+	}
+	if err := cl.CheckContentGroupTenant(tenantID, content.GroupID); err != nil {
+		return fmt.Errorf("no this[%d] content!", contentID)
+	}
+	return nil
+}
+
+// NewGroupTenant returns the tenant owning a group added by a caller: its own,
+// or the one asked for by an admin, 0 for no tenant.
+func (cl *ControllerLogic) NewGroupTenant(callerID, requested int64) (int64, error) {
+	if callerID != TENANT_ALL {
+		if requested != 0 && requested != callerID {
+			return 0, fmt.Errorf("cannot add groups to tenant[%d]", requested)
+		}
+		return callerID, nil
+	}
+	if requested != 0 {
+		if err := cl.cdb.GetTenantFromID(&TenantInfo{ID: requested}); err != nil {
+			return 0, err
+		}
+	}
+	return requested, nil
+}
+
+// CheckTenantQuota fails when adding to a tenant takes it over one of its quotas, groups of no tenant have none.
+func (cl *ControllerLogic) CheckTenantQuota(tenantID int64, add *TenantUsage) error {
+	if tenantID <= 0 {
+		return nil
+	}
+	tenant := &TenantInfo{ID: tenantID}
+	if err := cl.cdb.GetTenantFromID(tenant); err != nil {
+		return err
+	}
+	usage, err := cl.cdb.GetTenantUsage(tenantID)
+	if err != nil {
+		return err
+	}
+	return checkQuota(tenant, usage, add)
+}
+
+// CheckDomainQuota fails when adding domains to a group takes its tenant over the domain quota.
+func (cl *ControllerLogic) CheckDomainQuota(groupID, domains int64) error {
+	tenantID, err := cl.cdb.GetDomainGroupTenant(groupID)
+	if err != nil {
+		return err
+	}
+	return cl.CheckTenantQuota(tenantID, &TenantUsage{Domains: domains})
+}
+
+func checkQuota(tenant *TenantInfo, usage, add *TenantUsage) error {
+	if tenant.MaxDomainGroups > 0 && add.DomainGroups > 0 && usage.DomainGroups+add.DomainGroups > tenant.MaxDomainGroups {
+		return fmt.Errorf("tenant[%d] quota of %d domain groups reached", tenant.ID, tenant.MaxDomainGroups)
+	}
+	if tenant.MaxContentGroups > 0 && add.ContentGroups > 0 && usage.ContentGroups+add.ContentGroups > tenant.MaxContentGroups {
+		return fmt.Errorf("tenant[%d] quota of %d content groups reached", tenant.ID, tenant.MaxContentGroups)
+	}
+	if tenant.MaxDomains > 0 && add.Domains > 0 && usage.Domains+add.Domains > tenant.MaxDomains {
+		return fmt.Errorf("tenant[%d] quota of %d domains reached", tenant.ID, tenant.MaxDomains)
+	}
+	return nil
+}
+
+func filterDomainGroups(list []*DomainGroupInfo, tenantID int64) []*DomainGroupInfo {
+	if tenantID == TENANT_ALL {
+		return list
+	}
+	result := make([]*DomainGroupInfo, 0, len(list))
+	for _, v := range list {
+		if v.TenantID == tenantID {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func filterContentGroups(list []*ContentGroupInfo, tenantID int64) []*ContentGroupInfo {
+	if tenantID == TENANT_ALL {
+		return list
+	}
+	result := make([]*ContentGroupInfo, 0, len(list))
+	for _, v := range list {
+		if v.TenantID == tenantID {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// tenantGroups returns the ids of the domain groups and content groups of a tenant.
+func (cl *ControllerLogic) tenantGroups(tenantID int64) (map[int64]bool, map[int64]bool, error) {
+	domainGroups, _, err := cl.cdb.GetDomainGroupList(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	contentGroups, _, err := cl.cdb.GetContentGroupList(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	domainIDs := make(map[int64]bool)
+	for _, v := range filterDomainGroups(domainGroups, tenantID) {
+		domainIDs[v.ID] = true
+	}
+	contentIDs := make(map[int64]bool)
+	for _, v := range filterContentGroups(contentGroups, tenantID) {
+		contentIDs[v.ID] = true
+	}
+	return domainIDs, contentIDs, nil
+}
+
+// TenantDetails returns the tenants with their usage, only its own to a tenant.
+func (cl *ControllerLogic) TenantDetails(tenantID int64) ([]*TenantDetail, error) {
+	list, err := cl.cdb.GetTenantList()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*TenantDetail, 0, len(list))
+	for _, v := range list {
+		if tenantID != TENANT_ALL && v.ID != tenantID {
+			continue
+		}
+		usage, err := cl.cdb.GetTenantUsage(v.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &TenantDetail{TenantInfo: v, Usage: usage})
+	}
+	return result, nil
+}
+
+func CheckTenantInfo(info *TenantInfo) error {
+	if info.Name == "" || len(info.Name) > TENANT_NAME_MAX_LEN {
+		return fmt.Errorf("tenant name must have 1..%d bytes", TENANT_NAME_MAX_LEN)
+	}
+	if info.MaxDomainGroups < 0 || info.MaxContentGroups < 0 || info.MaxDomains < 0 {
+		return fmt.Errorf("quotas cannot be negative, 0 is unlimited")
+	}
+	return nil
+}
+
+// DeleteTenant removes a tenant owning no groups, with its api keys.
+func (cl *ControllerLogic) DeleteTenant(id int64) error {
+	usage, err := cl.cdb.GetTenantUsage(id)
+	if err != nil {
+		return err
+	}
+	if usage.DomainGroups != 0 || usage.ContentGroups != 0 {
+		return fmt.Errorf("tenant[%d] owns %d domain groups and %d content groups, move or delete them first",
+			id, usage.DomainGroups, usage.ContentGroups)
+	}
+	if err := cl.cdb.DeleteTenant(id); err != nil {
+		return err
+	}
+	return cl.LoadApiKeys()
+}
+
+// AddApiKey creates a key of a tenant, 0 for an admin key, and returns it with the key set.
+func (cl *ControllerLogic) AddApiKey(log *utils.Logger, tenantID int64, name string) (*ApiKeyInfo, error) {
+	if tenantID != 0 {
+		if err := cl.cdb.GetTenantFromID(&TenantInfo{ID: tenantID}); err != nil {
+			return nil, err
+		}
+	}
+	key, err := NewApiKey()
+	if err != nil {
+		return nil, err
+	}
+	info := &ApiKeyInfo{TenantID: tenantID, Name: name, KeyHash: HashApiKey(key)}
+	if err := cl.cdb.InsertApiKey(info); err != nil {
+		return nil, err
+	}
+	if err := cl.LoadApiKeys(); err != nil {
+		return nil, err
+	}
+	info.Key = key
+	log.Infof("api key[%d] of tenant[%d] added.\n", info.ID, tenantID)
+	return info, nil
+}
+
+// DeleteApiKey removes a key, a tenant only removes its own keys.
+func (cl *ControllerLogic) DeleteApiKey(log *utils.Logger, callerID, id int64) error {
+	list, err := cl.cdb.GetApiKeyList(callerID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, v := range list {
+		found = found || v.ID == id
+	}
+	if !found {
+		return fmt.Errorf("no this[%d] api key!", id)
+	}
+	if err := cl.cdb.DeleteApiKey(id); err != nil {
+		return err
+	}
+	log.Infof("api key[%d] deleted.\n", id)
+	return cl.LoadApiKeys()
+}
+
+// SetGroupTenant moves a group to a tenant, 0 for no tenant.
+// A domain group with show group links is refused, they cannot cross tenants.
+func (cl *ControllerLogic) SetGroupTenant(log *utils.Logger, checkType string, groupID, tenantID int64) error {
+	if tenantID != 0 {
+		if err := cl.cdb.GetTenantFromID(&TenantInfo{ID: tenantID}); err != nil {
+			return err
+		}
+	}
+	switch checkType {
+	case CHECK_TYPE_DOMAIN:
+		list, _, err := cl.cdb.GetDomainGroupList(0)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, g := range list {
+			if g.ID == groupID {
+				found = true
+				if len(g.ShowGroups) != 0 {
+					return fmt.Errorf("group[%d] has show groups, remove them first", groupID)
+				}
+			}
+			for _, v := range g.ShowGroups {
+				if v.ShowGroupID == groupID {
+					return fmt.Errorf("group[%d] is the show group of jump group[%d], remove it there first", groupID, g.ID)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("no this[%d] domain group!", groupID)
+		}
+		// the domains move with the group
+		domainList := &DomainList{GroupID: groupID}
+		if err := cl.cdb.GetDomainList(domainList); err != nil {
+			return err
+		}
+		if err := cl.CheckTenantQuota(tenantID, &TenantUsage{DomainGroups: 1, Domains: int64(len(domainList.DomainList))}); err != nil {
+			return err
+		}
+		if err := cl.cdb.UpdateDomainGroupTenant(groupID, tenantID); err != nil {
+			return err
+		}
+		cl.Lock()
+		if v := cl.domainMap[groupID]; v != nil {
+			v.groupInfo.TenantID = tenantID
+		}
+		cl.Unlock()
+	case CHECK_TYPE_CONTENT:
+		if _, err := cl.cdb.GetContentGroupTenant(groupID); err != nil {
+			return err
+		}
+		if err := cl.CheckTenantQuota(tenantID, &TenantUsage{ContentGroups: 1}); err != nil {
+			return err
+		}
+		if err := cl.cdb.UpdateContentGroupTenant(groupID, tenantID); err != nil {
+			return err
+		}
+		cl.Lock()
+		if v := cl.contentMap[groupID]; v != nil {
+			v.groupInfo.TenantID = tenantID
+		}
+		cl.Unlock()
+	default:
+		return fmt.Errorf("unknown group type[%s]!", checkType)
+	}
+	log.With(utils.LOG_GROUP_ID, groupID).Infof("%s group moved to tenant[%d].\n", checkType, tenantID)
+	return nil
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/config"
+	"github.com/reechou/x-real-control/utils"
+)
+
+func TestAuthorize(t *testing.T) {
+	cl := &ControllerLogic{
+		cfg: &config.Config{},
+		apiKeys: map[string]*ApiKeyInfo{
+			HashApiKey("admin"): {ID: 1, TenantID: 0},
+			HashApiKey("team"):  {ID: 2, TenantID: 7},
+		},
+	}
+	cases := []struct {
+		key           string
+		public, admin bool
+		require       bool
+		tenantID      int64
+		err           error
+	}{
+		// once a key exists, keyless callers are refused off the public routes
+		{"", false, false, false, 0, ErrApiKeyRequired},
+		{"", false, true, false, 0, ErrApiKeyRequired},
+		{"", false, false, true, 0, ErrApiKeyRequired},
+		{"", true, false, true, TENANT_ALL, nil},
+		{"admin", false, true, true, TENANT_ALL, nil},
+		{"team", false, false, true, 7, nil},
+		{"team", true, false, false, 7, nil},
+		{"team", false, true, false, 0, ErrAdminOnly},
+		{"guess", true, false, false, 0, ErrApiKeyInvalid},
+	}
+	for i, c := range cases {
+		cl.cfg.RequireApiKey = c.require
+		tenantID, err := cl.Authorize(c.key, c.public, c.admin)
+		if err != c.err || err == nil && tenantID != c.tenantID {
+			t.Errorf("case %d: got %d %v, want %d %v", i, tenantID, err, c.tenantID, c.err)
+		}
+	}
+
+	// before the first key, a keyless caller may add it
+	cl.apiKeys = map[string]*ApiKeyInfo{}
+	cl.cfg.RequireApiKey = false
+	if tenantID, err := cl.Authorize("", false, true); err != nil || tenantID != TENANT_ALL {
+		t.Errorf("no keys yet: got %d %v", tenantID, err)
+	}
+	cl.cfg.RequireApiKey = true
+	if _, err := cl.Authorize("", false, true); err != ErrApiKeyRequired {
+		t.Errorf("no keys yet with RequireApiKey: got %v", err)
+	}
+}
+
+func TestPublicTenant(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/domain/get_url", nil)
+	if got := publicTenant(req, 0); got != TENANT_ALL {
+		t.Errorf("no key no tenant: got %d", got)
+	}
+	if got := publicTenant(req, 3); got != 3 {
+		t.Errorf("no key asking tenant 3: got %d", got)
+	}
+	req.Header.Set(TENANT_HEADER, "5")
+	if got := publicTenant(req, 3); got != 5 {
+		t.Errorf("key of tenant 5 asking tenant 3: got %d", got)
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	tenant := &TenantInfo{ID: 1, MaxDomainGroups: 2, MaxDomains: 10}
+	usage := &TenantUsage{DomainGroups: 2, ContentGroups: 50, Domains: 9}
+	if err := checkQuota(tenant, usage, &TenantUsage{Domains: 1}); err != nil {
+		t.Errorf("last domain: %v", err)
+	}
+	if err := checkQuota(tenant, usage, &TenantUsage{ContentGroups: 1}); err != nil {
+		t.Errorf("content groups are unlimited: %v", err)
+	}
+	if err := checkQuota(tenant, usage, &TenantUsage{Domains: 2}); err == nil || !strings.Contains(err.Error(), "10 domains") {
+		t.Errorf("over domains: got %v", err)
+	}
+	if err := checkQuota(tenant, usage, &TenantUsage{DomainGroups: 1}); err == nil || !strings.Contains(err.Error(), "2 domain groups") {
+		t.Errorf("over domain groups: got %v", err)
+	}
+}
+
+func TestDomainRoundRobinByTenant(t *testing.T) {
+	cl := &ControllerLogic{
+		cfg:            &config.Config{},
+		clock:          utils.NewFakeClock(time.Unix(1500000000, 0)),
+		domainMap:      make(map[int64]*DomainMapInfo),
+		domainGroupIdx: make(map[int64]int64),
+		jumpDomainIdx:  make(map[int64]int64),
+	}
+	tenants := map[int64]int64{1: 1, 2: 2, 3: 1, 4: 2}
+	for id := int64(1); id <= 4; id++ {
+		cl.domainMap[id] = &DomainMapInfo{
+			groupInfo:  &DomainGroupInfo{ID: id, TenantID: tenants[id]},
+			domainList: &DomainList{GroupID: id, DomainList: []*DomainInfo{{ID: id * 10, GroupID: id, Domain: "d.com"}}},
+		}
+		cl.domainGroupList = append(cl.domainGroupList, id)
+	}
+
+	var got []int64
+	for i := 0; i < 4; i++ {
+		// callers of tenant 2 in between do not move the turn of tenant 1
+		if _, err := cl.getDomainInfo(logger, 0, DOMAIN_GROUP_TYPE_SHOW, 2); err != nil {
+			t.Fatal(err)
+		}
+		d, err := cl.getDomainInfo(logger, 0, DOMAIN_GROUP_TYPE_SHOW, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, d.GroupID)
+	}
+	if want := []int64{1, 3, 1, 3}; !equalIDs(got, want) {
+		t.Errorf("tenant 1 got groups %v, want %v", got, want)
+	}
+
+	if _, err := cl.getDomainInfo(logger, 2, DOMAIN_GROUP_TYPE_SHOW, 1); err == nil {
+		t.Errorf("group 2 of tenant 2 handed out to tenant 1")
+	}
+	if _, err := cl.getDomainInfo(logger, 0, DOMAIN_GROUP_TYPE_SHOW, 9); err == nil {
+		t.Errorf("tenant without groups got a domain")
+	}
+	all := make(map[int64]bool)
+	for i := 0; i < 4; i++ {
+		d, err := cl.getDomainInfo(logger, 0, DOMAIN_GROUP_TYPE_SHOW, TENANT_ALL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all[d.GroupID] = true
+	}
+	if len(all) != 4 {
+		t.Errorf("admins go round every group, got %v", all)
+	}
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
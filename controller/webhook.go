@@ -0,0 +1,418 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+const (
+	WEBHOOK_DELIVERY_PENDING = iota
+	WEBHOOK_DELIVERY_DELIVERED
+	// retries ran out, redeliver_webhook sends it again
+	WEBHOOK_DELIVERY_DEAD
+)
+
+const (
+	WEBHOOK_EVENT_HEADER     = "X-Webhook-Event"
+	WEBHOOK_DELIVERY_HEADER  = "X-Webhook-Delivery"
+	WEBHOOK_SIGNATURE_HEADER = "X-Webhook-Signature"
+	// the signature is WEBHOOK_SIGNATURE_PREFIX and the hex hmac-sha256 of the body keyed by the secret
+	WEBHOOK_SIGNATURE_PREFIX = "sha256="
+)
+
+const (
+	WEBHOOK_DELIVERY_INTERVAL = 10 * time.Second
+	WEBHOOK_DELIVERY_BATCH    = 100
+	WEBHOOK_TIMEOUT           = 10 * time.Second
+	// a claimed delivery is left to its controller this long, from the claim just before it is sent
+	WEBHOOK_LEASE        = time.Minute + WEBHOOK_TIMEOUT
+	WEBHOOK_MAX_ATTEMPTS = 8
+	WEBHOOK_BACKOFF_BASE = 30 * time.Second
+	WEBHOOK_BACKOFF_MAX  = time.Hour
+	WEBHOOK_ERROR_MAX    = 1024
+
+	WEBHOOK_DELIVERY_DEFAULT_LIMIT = 50
+	WEBHOOK_DELIVERY_MAX_LIMIT     = 500
+)
+
+// WebhookOutbox keeps the deliveries waiting to be sent, the db of the controller; tests use a fake.
+type WebhookOutbox interface {
+	InsertWebhookDelivery(info *WebhookDelivery) error
+	GetDueWebhookDeliveries(now, limit int64) ([]*WebhookDelivery, error)
+	ClaimWebhookDelivery(id, now, leaseUntil int64) (bool, error)
+	UpdateWebhookDeliveryResult(info *WebhookDelivery) error
+}
+
+// WEBHOOK_EVENT_TYPES are the events a webhook may subscribe to.
+var WEBHOOK_EVENT_TYPES = map[string]bool{
+	EVENT_DOMAIN_STATUS:     true,
+	EVENT_GROUP:             true,
+	EVENT_CONTENT_PUBLISHED: true,
+	EVENT_HEALTH_FAILED:     true,
+	EVENT_CONFIG_RELOADED:   true,
+}
+
+// SignWebhook returns the signature header of body.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return WEBHOOK_SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the wait for every failed attempt, up to WEBHOOK_BACKOFF_MAX.
+func webhookBackoff(attempts int64) time.Duration {
+	d := WEBHOOK_BACKOFF_BASE
+	for i := int64(1); i < attempts; i++ {
+		d *= 2
+		if d >= WEBHOOK_BACKOFF_MAX {
+			return WEBHOOK_BACKOFF_MAX
+		}
+	}
+	return d
+}
+
+// webhookWants tells whether wh receives ev, webhooks of tenant 0 receive the events of every tenant.
+func webhookWants(wh *WebhookInfo, ev *Event) bool {
+	if !wh.Enabled || wh.TenantID != 0 && wh.TenantID != ev.TenantID {
+		return false
+	}
+	for _, v := range wh.EventTypes {
+		if v == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDeniedNets are the loopback, link-local, private and reserved ranges webhooks of tenants may not reach.
+var webhookDeniedNets = parseWebhookNets(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseWebhookNets(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, v := range cidrs {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func webhookIPAllowed(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range webhookDeniedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookHostIPs resolves host, and fails when any of its ips is not public.
+func webhookHostIPs(host string) ([]net.IP, error) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return nil, fmt.Errorf("webhook host[%s] lookup error: %v", host, err)
+		}
+	}
+	for _, ip := range ips {
+		if !webhookIPAllowed(ip) {
+			return nil, fmt.Errorf("webhook host[%s] is at the internal address[%s]", host, ip)
+		}
+	}
+	return ips, nil
+}
+
+// CheckWebhook checks the url and the event types of a webhook. The url of a webhook of a tenant
+// must resolve to public addresses only, internal services are not for tenants to call.
+func CheckWebhook(info *WebhookInfo, tenantScoped bool) error {
+	u, err := url.Parse(info.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook url[%s] is not a http url", info.Url)
+	}
+	if tenantScoped {
+		host := u.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if _, err := webhookHostIPs(strings.Trim(host, "[]")); err != nil {
+			return err
+		}
+	}
+	if len(info.EventTypes) == 0 {
+		return fmt.Errorf("no event types")
+	}
+	for _, v := range info.EventTypes {
+		if !WEBHOOK_EVENT_TYPES[v] {
+			return fmt.Errorf("unknown event type[%s]", v)
+		}
+	}
+	return nil
+}
+
+// LoadWebhooks replaces the webhooks known to the controller by those in db.
+func (cl *ControllerLogic) LoadWebhooks() error {
+	list, err := cl.cdb.GetWebhookList(TENANT_ALL)
+	if err != nil {
+		return err
+	}
+	cl.webhookMutex.Lock()
+	cl.webhooks = list
+	cl.webhookMutex.Unlock()
+	return nil
+}
+
+func (cl *ControllerLogic) getWebhooks() []*WebhookInfo {
+	cl.webhookMutex.RLock()
+	defer cl.webhookMutex.RUnlock()
+	return cl.webhooks
+}
+
+// AddWebhook creates a webhook, a secret is generated when none is given.
+func (cl *ControllerLogic) AddWebhook(log *utils.Logger, callerID int64, info *WebhookInfo) error {
+	if err := CheckWebhook(info, callerID != TENANT_ALL); err != nil {
+		return err
+	}
+	if info.TenantID != 0 {
+		if err := cl.cdb.GetTenantFromID(&TenantInfo{ID: info.TenantID}); err != nil {
+			return err
+		}
+	}
+	if info.Secret == "" {
+		secret, err := NewApiKey()
+		if err != nil {
+			return err
+		}
+		info.Secret = secret
+	}
+	if err := cl.cdb.InsertWebhook(info); err != nil {
+		return err
+	}
+	log.Infof("webhook[%d] of tenant[%d] added for %v.\n", info.ID, info.TenantID, info.EventTypes)
+	return cl.LoadWebhooks()
+}
+
+// GetWebhook returns a webhook the caller may see.
+func (cl *ControllerLogic) GetWebhook(callerID, id int64) (*WebhookInfo, error) {
+	list, err := cl.cdb.GetWebhookList(callerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range list {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("no this[%d] webhook!", id)
+}
+
+func (cl *ControllerLogic) UpdateWebhook(callerID int64, info *WebhookInfo) error {
+	if _, err := cl.GetWebhook(callerID, info.ID); err != nil {
+		return err
+	}
+	if err := CheckWebhook(info, callerID != TENANT_ALL); err != nil {
+		return err
+	}
+	if err := cl.cdb.UpdateWebhook(info); err != nil {
+		return err
+	}
+	return cl.LoadWebhooks()
+}
+
+func (cl *ControllerLogic) DeleteWebhook(log *utils.Logger, callerID, id int64) error {
+	if _, err := cl.GetWebhook(callerID, id); err != nil {
+		return err
+	}
+	if err := cl.cdb.DeleteWebhook(id); err != nil {
+		return err
+	}
+	log.Infof("webhook[%d] deleted.\n", id)
+	return cl.LoadWebhooks()
+}
+
+// Redeliver sends a delivery again with fresh retries, dead ones included.
+func (cl *ControllerLogic) Redeliver(callerID, id int64) error {
+	info := &WebhookDelivery{ID: id}
+	if err := cl.cdb.GetWebhookDeliveryFromID(info); err != nil {
+		return err
+	}
+	if _, err := cl.GetWebhook(callerID, info.WebhookID); err != nil {
+		return err
+	}
+	info.Status = WEBHOOK_DELIVERY_PENDING
+	info.Attempts = 0
+	info.NextAttemptAt = cl.clock.Now().Unix()
+	info.DeliveredAt = 0
+	if err := cl.outbox.UpdateWebhookDeliveryResult(info); err != nil {
+		return err
+	}
+	cl.webhookTask.RunNow()
+	return nil
+}
+
+// enqueueWebhooks writes a delivery of ev to the outbox for every webhook wanting it.
+// The webhooks are the cached ones, so publishing does not read them from db.
+func (cl *ControllerLogic) enqueueWebhooks(ev *Event) {
+	var payload []byte
+	var err error
+	queued := false
+	for _, wh := range cl.getWebhooks() {
+		if !webhookWants(wh, ev) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(ev); err != nil {
+				logger.Errorf("event[%d] marshal error: %v\n", ev.ID, err)
+				return
+			}
+		}
+		err := cl.outbox.InsertWebhookDelivery(&WebhookDelivery{
+			WebhookID:     wh.ID,
+			EventID:       ev.ID,
+			EventType:     ev.Type,
+			Payload:       string(payload),
+			Status:        WEBHOOK_DELIVERY_PENDING,
+			NextAttemptAt: cl.clock.Now().Unix(),
+		})
+		if err != nil {
+			logger.Errorf("webhook[%d] event[%d] %s dropped, enqueue error: %v\n", wh.ID, ev.ID, ev.Type, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		cl.webhookTask.RunNow()
+	}
+}
+
+// DeliverWebhooks sends the due deliveries of the outbox, one run at a time.
+func (cl *ControllerLogic) DeliverWebhooks() {
+	if !atomic.CompareAndSwapInt32(&cl.deliveringWebhooks, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&cl.deliveringWebhooks, 0)
+
+	list, err := cl.outbox.GetDueWebhookDeliveries(cl.clock.Now().Unix(), WEBHOOK_DELIVERY_BATCH)
+	if err != nil {
+		logger.Errorf("get due webhook deliveries error: %v\n", err)
+		return
+	}
+	for _, v := range list {
+		// the sends before took their time, the lease runs from now
+		now := cl.clock.Now()
+		claimed, err := cl.outbox.ClaimWebhookDelivery(v.ID, now.Unix(), now.Add(WEBHOOK_LEASE).Unix())
+		if err != nil {
+			logger.Errorf("claim webhook delivery[%d] error: %v\n", v.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		cl.deliverWebhook(v)
+	}
+}
+
+func (cl *ControllerLogic) deliverWebhook(info *WebhookDelivery) {
+	log := logger.With(utils.LOG_WEBHOOK_ID, info.WebhookID)
+	client := cl.webhookClient
+	if info.TenantID != 0 {
+		client = cl.tenantWebhookClient
+	}
+	code, err := sendWebhook(client, info)
+	info.Attempts++
+	info.ResponseCode = int64(code)
+	now := cl.clock.Now()
+	if err == nil {
+		info.Status = WEBHOOK_DELIVERY_DELIVERED
+		info.NextAttemptAt = 0
+		info.DeliveredAt = now.Unix()
+		info.LastError = ""
+		log.Debugf("webhook delivery[%d] of event[%d] delivered.\n", info.ID, info.EventID)
+	} else {
+		info.LastError = err.Error()
+		if len(info.LastError) > WEBHOOK_ERROR_MAX {
+			info.LastError = info.LastError[:WEBHOOK_ERROR_MAX]
+		}
+		if info.Attempts >= WEBHOOK_MAX_ATTEMPTS {
+			info.Status = WEBHOOK_DELIVERY_DEAD
+			info.NextAttemptAt = 0
+			log.Warningf("webhook delivery[%d] is dead after %d attempts: %v\n", info.ID, info.Attempts, err)
+		} else {
+			info.NextAttemptAt = now.Add(webhookBackoff(info.Attempts)).Unix()
+			log.Infof("webhook delivery[%d] attempt %d failed: %v\n", info.ID, info.Attempts, err)
+		}
+	}
+	if err := cl.outbox.UpdateWebhookDeliveryResult(info); err != nil {
+		log.Errorf("update webhook delivery[%d] error: %v\n", info.ID, err)
+	}
+}
+
+// newTenantWebhookClient returns the client of the webhooks of tenants. It connects to public addresses only,
+// whatever the host resolves to when sending and wherever a redirect points.
+func newTenantWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: WEBHOOK_TIMEOUT}
+	return &http.Client{
+		Timeout: WEBHOOK_TIMEOUT,
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				host, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				ips, err := webhookHostIPs(host)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.Dial(network, net.JoinHostPort(ips[0].String(), port))
+			},
+			TLSHandshakeTimeout: WEBHOOK_TIMEOUT,
+		},
+	}
+}
+
+// sendWebhook posts the payload of a delivery, any answer but 2xx is an error.
+func sendWebhook(client *http.Client, info *WebhookDelivery) (int, error) {
+	body := []byte(info.Payload)
+	req, err := http.NewRequest("POST", info.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WEBHOOK_EVENT_HEADER, info.EventType)
+	req.Header.Set(WEBHOOK_DELIVERY_HEADER, strconv.FormatInt(info.ID, 10))
+	req.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhook(info.Secret, body))
+	rsp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 64*1024))
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp.StatusCode, fmt.Errorf("webhook answered %s", rsp.Status)
+	}
+	return rsp.StatusCode, nil
+}
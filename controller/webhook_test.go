@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reechou/x-real-control/utils"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// hmac-sha256 of the rfc 4231 test case 2
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := SignWebhook("Jefe", []byte("what do ya want for nothing?")); got != want {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cases := map[int64]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		4: 4 * time.Minute,
+		8: WEBHOOK_BACKOFF_MAX,
+	}
+	for attempts, want := range cases {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("%d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestWebhookWants(t *testing.T) {
+	ev := &Event{Type: EVENT_DOMAIN_STATUS, TenantID: 7}
+	cases := []struct {
+		wh   *WebhookInfo
+		want bool
+	}{
+		{&WebhookInfo{Enabled: true, EventTypes: []string{EVENT_DOMAIN_STATUS}}, true},
+		{&WebhookInfo{Enabled: true, TenantID: 7, EventTypes: []string{EVENT_GROUP, EVENT_DOMAIN_STATUS}}, true},
+		{&WebhookInfo{Enabled: true, TenantID: 8, EventTypes: []string{EVENT_DOMAIN_STATUS}}, false},
+		{&WebhookInfo{Enabled: true, EventTypes: []string{EVENT_GROUP}}, false},
+		{&WebhookInfo{EventTypes: []string{EVENT_DOMAIN_STATUS}}, false},
+	}
+	for i, c := range cases {
+		if got := webhookWants(c.wh, ev); got != c.want {
+			t.Errorf("case %d: got %v", i, got)
+		}
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	ok := &WebhookInfo{Url: "https://hooks.example.com/xrc", EventTypes: []string{EVENT_CONTENT_PUBLISHED}}
+	if err := CheckWebhook(ok, false); err != nil {
+		t.Errorf("%v", err)
+	}
+	bad := []*WebhookInfo{
+		{Url: "ftp://hooks.example.com", EventTypes: []string{EVENT_GROUP}},
+		{Url: "https://hooks.example.com"},
+		{Url: "https://hooks.example.com", EventTypes: []string{EVENT_RESET}},
+	}
+	for i, v := range bad {
+		if err := CheckWebhook(v, false); err == nil {
+			t.Errorf("case %d is accepted", i)
+		}
+	}
+
+	// admins may call internal services, tenants may not
+	for _, u := range []string{"http://127.0.0.1:8080/hook", "http://[::1]/hook", "http://169.254.169.254/latest",
+		"http://10.1.2.3/", "http://192.168.1.1:80/", "http://0.0.0.0/", "http://[::ffff:127.0.0.1]/"} {
+		info := &WebhookInfo{Url: u, EventTypes: []string{EVENT_GROUP}}
+		if err := CheckWebhook(info, false); err != nil {
+			t.Errorf("admin %s: %v", u, err)
+		}
+		if err := CheckWebhook(info, true); err == nil {
+			t.Errorf("tenant %s is accepted", u)
+		}
+	}
+	if err := CheckWebhook(&WebhookInfo{Url: "https://93.184.216.34:8443/hook", EventTypes: []string{EVENT_GROUP}}, true); err != nil {
+		t.Errorf("tenant public ip: %v", err)
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get(WEBHOOK_SIGNATURE_HEADER) != SignWebhook("s3cret", body) ||
+			req.Header.Get(WEBHOOK_EVENT_HEADER) != EVENT_GROUP || req.Header.Get(WEBHOOK_DELIVERY_HEADER) != "5" {
+			t.Errorf("headers %v", req.Header)
+		}
+		if req.URL.Path == "/fail" {
+			rsp.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		rsp.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	info := &WebhookDelivery{ID: 5, EventType: EVENT_GROUP, Payload: `{"id":1}`, Url: ts.URL, Secret: "s3cret"}
+	if code, err := sendWebhook(http.DefaultClient, info); err != nil || code != http.StatusNoContent {
+		t.Errorf("got %d %v", code, err)
+	}
+	info.Url = ts.URL + "/fail"
+	if code, err := sendWebhook(http.DefaultClient, info); err == nil || code != http.StatusBadGateway {
+		t.Errorf("got %d %v, want an error", code, err)
+	}
+	// the client of tenants does not reach the loopback test server
+	info.Url = ts.URL
+	if _, err := sendWebhook(newTenantWebhookClient(), info); err == nil || !strings.Contains(err.Error(), "internal address") {
+		t.Errorf("tenant client: got %v, want an internal address error", err)
+	}
+}
+
+// fakeOutbox keeps deliveries in memory and records the claims.
+type fakeOutbox struct {
+	// inserts for this webhook fail
+	failWebhook int64
+
+	due     []*WebhookDelivery
+	claims  [][3]int64
+	results []*WebhookDelivery
+}
+
+func (fo *fakeOutbox) InsertWebhookDelivery(info *WebhookDelivery) error {
+	if info.WebhookID == fo.failWebhook {
+		return errors.New("insert failed")
+	}
+	fo.due = append(fo.due, info)
+	return nil
+}
+
+func (fo *fakeOutbox) GetDueWebhookDeliveries(now, limit int64) ([]*WebhookDelivery, error) {
+	return fo.due, nil
+}
+
+func (fo *fakeOutbox) ClaimWebhookDelivery(id, now, leaseUntil int64) (bool, error) {
+	fo.claims = append(fo.claims, [3]int64{id, now, leaseUntil})
+	return true, nil
+}
+
+func (fo *fakeOutbox) UpdateWebhookDeliveryResult(info *WebhookDelivery) error {
+	fo.results = append(fo.results, info)
+	return nil
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDeliverWebhooksLease(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1500000000, 0))
+	outbox := &fakeOutbox{}
+	for i := int64(1); i <= 10; i++ {
+		outbox.due = append(outbox.due, &WebhookDelivery{ID: i, Url: "http://hooks.example.com/", Payload: "{}"})
+	}
+	var sent []int64
+	cl := &ControllerLogic{
+		clock:  clock,
+		outbox: outbox,
+		// every send takes almost the whole timeout
+		webhookClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			clock.Advance(WEBHOOK_TIMEOUT - time.Second)
+			sent = append(sent, clock.Now().Unix())
+			return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})},
+	}
+	start := clock.Now().Unix()
+	cl.DeliverWebhooks()
+
+	if len(outbox.claims) != 10 || len(sent) != 10 {
+		t.Fatalf("claims %d sends %d", len(outbox.claims), len(sent))
+	}
+	step := int64((WEBHOOK_TIMEOUT - time.Second) / time.Second)
+	for i, c := range outbox.claims {
+		if c[1] != start+int64(i)*step {
+			t.Errorf("claim %d at %d, want the time of the claim %d", i, c[1]-start, int64(i)*step)
+		}
+		if c[2] != c[1]+int64(WEBHOOK_LEASE/time.Second) || c[2] <= sent[i] {
+			t.Errorf("claim %d leased until %d, sent at %d", i, c[2]-start, sent[i]-start)
+		}
+	}
+	for _, v := range outbox.results {
+		if v.Status != WEBHOOK_DELIVERY_DELIVERED {
+			t.Errorf("delivery %d status %d", v.ID, v.Status)
+		}
+	}
+}
+
+// TestEnqueueWebhooks publishes on the cached webhooks, mysql is not connected so any db read would fail.
+func TestEnqueueWebhooks(t *testing.T) {
+	clock := utils.NewFakeClock(time.Unix(1500000000, 0))
+	sched := utils.NewScheduler(clock, time.Second, 60)
+	defer sched.Stop()
+	outbox := &fakeOutbox{failWebhook: 3}
+	cl := &ControllerLogic{
+		clock:       clock,
+		cdb:         &ControllerDB{db: utils.NewMysqlController()},
+		outbox:      outbox,
+		webhookTask: sched.Schedule("webhook_delivery", time.Hour, 0),
+		webhooks: []*WebhookInfo{
+			{ID: 1, Enabled: true, EventTypes: []string{EVENT_DOMAIN_STATUS}},
+			{ID: 2, Enabled: true, TenantID: 8, EventTypes: []string{EVENT_DOMAIN_STATUS}},
+			{ID: 3, Enabled: true, EventTypes: []string{EVENT_DOMAIN_STATUS}},
+			{ID: 4, Enabled: true, TenantID: 7, EventTypes: []string{EVENT_DOMAIN_STATUS}},
+		},
+	}
+	cl.enqueueWebhooks(&Event{ID: 5, Type: EVENT_DOMAIN_STATUS, TenantID: 7})
+
+	// the failed insert of webhook 3 does not stop the others
+	var got []int64
+	for _, v := range outbox.due {
+		got = append(got, v.WebhookID)
+		if v.EventID != 5 || v.Status != WEBHOOK_DELIVERY_PENDING || v.NextAttemptAt != clock.Now().Unix() {
+			t.Errorf("delivery %+v", v)
+		}
+	}
+	if want := []int64{1, 4}; !equalIDs(got, want) {
+		t.Errorf("queued for webhooks %v, want %v", got, want)
+	}
+
+	if err := cl.LoadWebhooks(); err == nil {
+		t.Fatalf("load webhooks without mysql")
+	}
+	if len(cl.getWebhooks()) != 4 {
+		t.Errorf("a failed load dropped the cached webhooks")
+	}
+}
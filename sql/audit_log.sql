@@ -0,0 +1,18 @@
+-- changes made through the api, the body is kept with its secrets masked.
+-- api_key_id is 0 for callers without a key.
+CREATE TABLE audit_log (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  tenant_id BIGINT NOT NULL DEFAULT 0,
+  api_key_id BIGINT NOT NULL DEFAULT 0,
+  actor VARCHAR(64) NOT NULL DEFAULT '',
+  action VARCHAR(64) NOT NULL,
+  request_id VARCHAR(64) NOT NULL DEFAULT '',
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  code INT NOT NULL DEFAULT 0,
+  message VARCHAR(255) NOT NULL DEFAULT '',
+  body TEXT NOT NULL,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_tenant (tenant_id, id),
+  KEY idx_action (action, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
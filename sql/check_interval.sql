@@ -0,0 +1,3 @@
+-- seconds between checks of a group, 0 uses CheckInterval of the config.
+ALTER TABLE domain_group ADD COLUMN check_interval INT NOT NULL DEFAULT 0;
+ALTER TABLE content_group ADD COLUMN check_interval INT NOT NULL DEFAULT 0;
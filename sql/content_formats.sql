@@ -0,0 +1,5 @@
+-- output formats of a content group, comma separated: json,jsonp,rss,atom.
+-- empty means json only.
+ALTER TABLE content_group
+    ADD COLUMN formats VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN jsonp_callback VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- content ordering, per-item enable and pinned flag.
+-- pinned replaces content_group.main_content, existing main content
+-- keeps its order through position.
+ALTER TABLE content
+    ADD COLUMN position INT NOT NULL DEFAULT 0,
+    ADD COLUMN enabled TINYINT NOT NULL DEFAULT 1,
+    ADD COLUMN pinned TINYINT NOT NULL DEFAULT 0;
+
+UPDATE content c JOIN content_group g ON c.group_id = g.id
+    SET c.pinned = 1, c.position = FIND_IN_SET(c.id, g.main_content)
+    WHERE FIND_IN_SET(c.id, g.main_content) > 0;
+
+ALTER TABLE content_group DROP COLUMN main_content;
@@ -0,0 +1,11 @@
+-- every publish of a content group, failed ones with their error.
+CREATE TABLE content_publish_log (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  group_id BIGINT NOT NULL,
+  success TINYINT NOT NULL,
+  json_url VARCHAR(1024) NOT NULL DEFAULT '',
+  error VARCHAR(1024) NOT NULL DEFAULT '',
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_group (group_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,4 @@
+-- scheduled publish and expiry window for content, NULL means no limit.
+ALTER TABLE content
+    ADD COLUMN publish_at DATETIME NULL DEFAULT NULL,
+    ADD COLUMN expire_at DATETIME NULL DEFAULT NULL;
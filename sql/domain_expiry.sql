@@ -0,0 +1,7 @@
+-- registration expiry set by hand and certificate expiry filled by the cert probe, NULL is unknown.
+-- expired domains are not handed out by get_url.
+ALTER TABLE domain
+    ADD COLUMN registration_expires_at DATETIME NULL DEFAULT NULL,
+    ADD COLUMN cert_expires_at DATETIME NULL DEFAULT NULL,
+    ADD KEY idx_registration_expires (registration_expires_at),
+    ADD KEY idx_cert_expires (cert_expires_at);
@@ -0,0 +1,9 @@
+-- show groups of a jump group, replacing domain_group.show_group_list.
+-- the controller moves show_group_list into this table at start and clears the column.
+CREATE TABLE domain_group_show (
+  jump_group_id BIGINT NOT NULL,
+  show_group_id BIGINT NOT NULL,
+  weight INT NOT NULL DEFAULT 1,
+  PRIMARY KEY (jump_group_id, show_group_id),
+  KEY idx_show (show_group_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,13 @@
+-- failed health checks and domains set down by the checker, newest last.
+CREATE TABLE domain_health_log (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  group_id BIGINT NOT NULL,
+  domain_id BIGINT NOT NULL,
+  domain VARCHAR(255) NOT NULL,
+  result VARCHAR(16) NOT NULL,
+  message VARCHAR(1024) NOT NULL DEFAULT '',
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_domain (domain_id, id),
+  KEY idx_group (group_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,45 @@
+-- tables of the first release, the other files of this directory alter them in the order of
+-- SCHEMA_FILES in controller/integration_test.go. time is bumped on every update, the checkers
+-- reload a group when it moves.
+CREATE TABLE domain_group (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  name VARCHAR(64) NOT NULL,
+  type INT NOT NULL DEFAULT 0,
+  status INT NOT NULL DEFAULT 0,
+  share_status INT NOT NULL DEFAULT 0,
+  ads_status INT NOT NULL DEFAULT 0,
+  show_group_list VARCHAR(1024) NOT NULL DEFAULT '',
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE domain (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  group_id BIGINT NOT NULL,
+  domain VARCHAR(255) NOT NULL,
+  status INT NOT NULL DEFAULT 0,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_group (group_id),
+  KEY idx_domain (domain)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE content_group (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  name VARCHAR(64) NOT NULL,
+  type INT NOT NULL DEFAULT 0,
+  json_url VARCHAR(1024) NOT NULL DEFAULT '',
+  main_content VARCHAR(1024) NOT NULL DEFAULT '',
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE content (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  group_id BIGINT NOT NULL,
+  type INT NOT NULL DEFAULT 0,
+  value TEXT NOT NULL,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_group (group_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,11 @@
+-- times a domain was handed out by get_url or a content group was served by get_data, per minute.
+-- domain_id is 0 for content rows.
+CREATE TABLE serve_stats (
+  minute DATETIME NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  group_id BIGINT NOT NULL,
+  domain_id BIGINT NOT NULL DEFAULT 0,
+  count BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (minute, kind, group_id, domain_id),
+  KEY idx_group (kind, group_id, minute)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,32 @@
+-- tenants own domain groups and content groups, quotas of 0 are unlimited.
+CREATE TABLE tenant (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  name VARCHAR(64) NOT NULL,
+  max_domain_groups INT NOT NULL DEFAULT 0,
+  max_content_groups INT NOT NULL DEFAULT 0,
+  max_domains INT NOT NULL DEFAULT 0,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- only the sha256 of a key is kept, the key is shown once when created.
+-- keys of tenant 0 are admin keys and see every tenant.
+CREATE TABLE api_key (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  tenant_id BIGINT NOT NULL DEFAULT 0,
+  name VARCHAR(64) NOT NULL DEFAULT '',
+  key_hash CHAR(64) NOT NULL,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY uniq_key_hash (key_hash),
+  KEY idx_tenant (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- groups of tenant 0 belong to no tenant, only admin keys see them.
+ALTER TABLE domain_group
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 0,
+    ADD KEY idx_tenant (tenant_id);
+ALTER TABLE content_group
+    ADD COLUMN tenant_id BIGINT NOT NULL DEFAULT 0,
+    ADD KEY idx_tenant (tenant_id);
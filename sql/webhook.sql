@@ -0,0 +1,33 @@
+-- webhooks receive the events of /api/v2/events signed with their secret.
+-- event_types is comma separated, webhooks of tenant 0 receive the events of every tenant.
+CREATE TABLE webhook (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  tenant_id BIGINT NOT NULL DEFAULT 0,
+  url VARCHAR(1024) NOT NULL,
+  secret VARCHAR(128) NOT NULL,
+  event_types VARCHAR(255) NOT NULL,
+  enabled TINYINT NOT NULL DEFAULT 1,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_tenant (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- the outbox, a delivery is written with the event and sent until it succeeds or is dead.
+-- status: 0 pending, 1 delivered, 2 dead.
+CREATE TABLE webhook_delivery (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  webhook_id BIGINT NOT NULL,
+  event_id BIGINT NOT NULL,
+  event_type VARCHAR(32) NOT NULL,
+  payload TEXT NOT NULL,
+  status INT NOT NULL DEFAULT 0,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NULL DEFAULT NULL,
+  response_code INT NOT NULL DEFAULT 0,
+  last_error VARCHAR(1024) NOT NULL DEFAULT '',
+  delivered_at TIMESTAMP NULL DEFAULT NULL,
+  time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY idx_due (status, next_attempt_at),
+  KEY idx_webhook (webhook_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
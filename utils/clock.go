@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source of timers, so tests can drive time by hand.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+type Ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+// RealClock is the Clock backed by package time.
+var RealClock Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{time.NewTicker(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (rt *realTicker) Chan() <-chan time.Time {
+	return rt.C
+}
+
+// FakeClock only moves when Advance is called. Ticker channels are unbuffered,
+// so Advance returns only after every due tick has been received.
+type FakeClock struct {
+	sync.Mutex
+
+	now     time.Time
+	tickers []*fakeTicker
+	waiters []*fakeWaiter
+}
+
+type fakeTicker struct {
+	clock    *FakeClock
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+	stop     chan struct{}
+}
+
+type fakeWaiter struct {
+	c    chan time.Time
+	when time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (fc *FakeClock) Now() time.Time {
+	fc.Lock()
+	defer fc.Unlock()
+	return fc.now
+}
+
+func (fc *FakeClock) NewTicker(d time.Duration) Ticker {
+	fc.Lock()
+	defer fc.Unlock()
+	ft := &fakeTicker{
+		clock:    fc,
+		c:        make(chan time.Time),
+		interval: d,
+		next:     fc.now.Add(d),
+		stop:     make(chan struct{}),
+	}
+	fc.tickers = append(fc.tickers, ft)
+	return ft
+}
+
+func (fc *FakeClock) After(d time.Duration) <-chan time.Time {
+	fc.Lock()
+	defer fc.Unlock()
+	w := &fakeWaiter{c: make(chan time.Time, 1), when: fc.now.Add(d)}
+	if d <= 0 {
+		w.c <- fc.now
+		return w.c
+	}
+	fc.waiters = append(fc.waiters, w)
+	return w.c
+}
+
+// Waiters returns how many After channels and tickers are pending, tests use it
+// to wait until a goroutine is blocked on the clock.
+func (fc *FakeClock) Waiters() int {
+	fc.Lock()
+	defer fc.Unlock()
+	return len(fc.waiters) + len(fc.tickers)
+}
+
+// Advance moves the clock forward by d, firing tickers and After channels in time order.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.Lock()
+	end := fc.now.Add(d)
+	fc.Unlock()
+
+	for {
+		fc.Lock()
+		var ticker *fakeTicker
+		next := end
+		for _, t := range fc.tickers {
+			if !t.next.After(next) {
+				ticker = t
+				next = t.next
+			}
+		}
+		if ticker == nil {
+			fc.now = end
+			fc.fireWaiters()
+			fc.Unlock()
+			return
+		}
+		fc.now = next
+		fc.fireWaiters()
+		ticker.next = next.Add(ticker.interval)
+		fc.Unlock()
+
+		select {
+		case ticker.c <- next:
+		case <-ticker.stop:
+		}
+	}
+}
+
+func (fc *FakeClock) fireWaiters() {
+	var pending []*fakeWaiter
+	for _, w := range fc.waiters {
+		if w.when.After(fc.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- fc.now
+	}
+	fc.waiters = pending
+}
+
+func (ft *fakeTicker) Chan() <-chan time.Time {
+	return ft.c
+}
+
+func (ft *fakeTicker) Stop() {
+	fc := ft.clock
+	fc.Lock()
+	defer fc.Unlock()
+	for i, t := range fc.tickers {
+		if t == ft {
+			fc.tickers = append(fc.tickers[:i], fc.tickers[i+1:]...)
+			close(ft.stop)
+			break
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// punycode parameters of RFC 3492
+const (
+	PUNY_BASE         = 36
+	PUNY_TMIN         = 1
+	PUNY_TMAX         = 26
+	PUNY_SKEW         = 38
+	PUNY_DAMP         = 700
+	PUNY_INITIAL_BIAS = 72
+	PUNY_INITIAL_N    = 128
+
+	ACE_PREFIX = "xn--"
+)
+
+// IDNToASCII turns every non ascii label of a domain into its xn-- punycode form.
+// Fullwidth ascii is folded and labels lowercased, the rest of the IDNA mapping is not applied.
+func IDNToASCII(domain string) (string, error) {
+	// ideographic and halfwidth full stops separate labels too
+	domain = strings.NewReplacer("。", ".", "｡", ".").Replace(domain)
+	domain = strings.Map(foldWidth, domain)
+	labels := strings.Split(strings.ToLower(domain), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		if !utf8.ValidString(label) {
+			return "", fmt.Errorf("label[%q] is not utf-8", label)
+		}
+		encoded, err := PunycodeEncode(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = ACE_PREFIX + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// PunycodeEncode encodes s by RFC 3492, without the xn-- prefix.
+func PunycodeEncode(s string) (string, error) {
+	input := []rune(s)
+	out := make([]byte, 0, len(s)+8)
+	for _, r := range input {
+		if r < 0x80 {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(PUNY_INITIAL_N), 0, PUNY_INITIAL_BIAS
+	for h := basic; h < len(input); {
+		m := rune(0x7fffffff)
+		for _, r := range input {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (0x7fffffff-delta)/(h+1) {
+			return "", fmt.Errorf("punycode overflow of %q", s)
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := PUNY_BASE; ; k += PUNY_BASE {
+				t := k - bias
+				if t < PUNY_TMIN {
+					t = PUNY_TMIN
+				} else if t > PUNY_TMAX {
+					t = PUNY_TMAX
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(PUNY_BASE-t)))
+				q = (q - t) / (PUNY_BASE - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == basic)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= PUNY_DAMP
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((PUNY_BASE-PUNY_TMIN)*PUNY_TMAX)/2 {
+		delta /= PUNY_BASE - PUNY_TMIN
+		k += PUNY_BASE
+	}
+	return k + (PUNY_BASE-PUNY_TMIN+1)*delta/(delta+PUNY_SKEW)
+}
+
+// foldWidth maps the fullwidth forms of ascii, as typed with an east asian input method, to ascii.
+func foldWidth(r rune) rune {
+	if r >= 0xff01 && r <= 0xff5e {
+		return r - 0xfee0
+	}
+	return r
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
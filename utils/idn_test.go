@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestIDNToASCII(t *testing.T) {
+	cases := map[string]string{
+		"example.com": "example.com",
+		"Example.COM": "example.com",
+		"bücher.de":   "xn--bcher-kva.de",
+		"München.de":  "xn--mnchen-3ya.de",
+		"中国":          "xn--fiqs8s",
+		"例え。テスト":      "xn--r8jz45g.xn--zckzah",
+		"www.中文网.com": "www.xn--fiq228c5hs.com",
+		"ｅｘａｍｐｌｅ.com": "example.com",
+		"faß.de":      "xn--fa-hia.de",
+		"a_b.com":     "a_b.com",
+		"ＡＢＣ．ｃｏｍ":     "abc.com",
+	}
+	for in, want := range cases {
+		got, err := IDNToASCII(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
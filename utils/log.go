@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+const (
+	LOG_FORMAT_TEXT   = "text"
+	LOG_FORMAT_JSON   = "json"
+	LOG_FORMAT_LOGFMT = "logfmt"
+)
+
+// field names shared by every log line
+const (
+	LOG_GROUP_ID   = "group_id"
+	LOG_DOMAIN_ID  = "domain_id"
+	LOG_REQUEST_ID = "request_id"
+	LOG_WEBHOOK_ID = "webhook_id"
+)
+
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+type LogFields []LogField
+
+// StructuredFormatter is a capnslog formatter writing one text, json or logfmt line per entry.
+// LogFields entries become fields of the line, the rest is the message.
+type StructuredFormatter struct {
+	sync.Mutex
+
+	w      io.Writer
+	format string
+	now    func() time.Time
+}
+
+func NewStructuredFormatter(w io.Writer, format string) (*StructuredFormatter, error) {
+	switch format {
+	case "":
+		format = LOG_FORMAT_TEXT
+	case LOG_FORMAT_TEXT, LOG_FORMAT_JSON, LOG_FORMAT_LOGFMT:
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want one of text, json, logfmt", format)
+	}
+	return &StructuredFormatter{w: w, format: format, now: time.Now}, nil
+}
+
+func (sf *StructuredFormatter) Format(pkg string, level capnslog.LogLevel, depth int, entries ...interface{}) {
+	var fields LogFields
+	var msg []interface{}
+	for _, e := range entries {
+		if f, ok := e.(LogFields); ok {
+			fields = append(fields, f...)
+			continue
+		}
+		msg = append(msg, e)
+	}
+	line := &bytes.Buffer{}
+	now := sf.now()
+	text := strings.TrimRight(fmt.Sprint(msg...), "\n")
+
+	switch sf.format {
+	case LOG_FORMAT_JSON:
+		line.WriteString(`{"time":`)
+		writeJSON(line, now.Format(time.RFC3339Nano))
+		line.WriteString(`,"level":`)
+		writeJSON(line, strings.ToLower(level.String()))
+		line.WriteString(`,"pkg":`)
+		writeJSON(line, pkg)
+		line.WriteString(`,"msg":`)
+		writeJSON(line, text)
+		for _, f := range fields {
+			line.WriteString(",")
+			writeJSON(line, f.Key)
+			line.WriteString(":")
+			writeJSON(line, f.Value)
+		}
+		line.WriteString("}\n")
+	case LOG_FORMAT_LOGFMT:
+		fmt.Fprintf(line, "time=%s level=%s pkg=%s msg=%s",
+			now.Format(time.RFC3339Nano), strings.ToLower(level.String()), logfmtValue(pkg), logfmtValue(text))
+		for _, f := range fields {
+			fmt.Fprintf(line, " %s=%s", f.Key, logfmtValue(fmt.Sprint(f.Value)))
+		}
+		line.WriteString("\n")
+	default:
+		fmt.Fprintf(line, "%s %s | %s: %s", now.Format("2006-01-02 15:04:05.000000"), level.Char(), pkg, text)
+		for _, f := range fields {
+			fmt.Fprintf(line, " %s=%v", f.Key, f.Value)
+		}
+		line.WriteString("\n")
+	}
+
+	sf.Lock()
+	sf.w.Write(line.Bytes())
+	sf.Unlock()
+}
+
+func (sf *StructuredFormatter) Flush() {}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var (
+	formatterMutex sync.RWMutex
+	formatter      *StructuredFormatter
+)
+
+// SetupLogging installs the formatter of format on stderr for every capnslog logger.
+func SetupLogging(format string, debug bool) error {
+	f, err := NewStructuredFormatter(os.Stderr, format)
+	if err != nil {
+		return err
+	}
+	formatterMutex.Lock()
+	formatter = f
+	formatterMutex.Unlock()
+	capnslog.SetFormatter(f)
+	capnslog.SetGlobalLogLevel(capnslog.INFO)
+	if debug {
+		capnslog.SetGlobalLogLevel(capnslog.DEBUG)
+	}
+	return nil
+}
+
+// Logger is a capnslog package logger carrying fields, such as the group or request of the work.
+type Logger struct {
+	plog   *capnslog.PackageLogger
+	pkg    string
+	fields LogFields
+}
+
+func NewLogger(plog *capnslog.PackageLogger, pkg string) *Logger {
+	return &Logger{plog: plog, pkg: pkg}
+}
+
+// With returns a logger adding key=value to every line.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make(LogFields, 0, len(l.fields)+1)
+	for _, f := range l.fields {
+		if f.Key != key {
+			fields = append(fields, f)
+		}
+	}
+	return &Logger{plog: l.plog, pkg: l.pkg, fields: append(fields, LogField{Key: key, Value: value})}
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(capnslog.DEBUG, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(capnslog.INFO, format, args...)
+}
+
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.logf(capnslog.WARNING, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(capnslog.ERROR, format, args...)
+}
+
+func (l *Logger) logf(level capnslog.LogLevel, format string, args ...interface{}) {
+	if !l.plog.LevelAt(level) {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	formatterMutex.RLock()
+	f := formatter
+	formatterMutex.RUnlock()
+	if f == nil {
+		// logging is not set up, keep the fields in the text
+		for _, field := range l.fields {
+			msg = strings.TrimRight(msg, "\n") + fmt.Sprintf(" %s=%v", field.Key, field.Value)
+		}
+		l.plog.Logf(level, "%s", msg)
+		return
+	}
+	f.Format(l.pkg, level, 1, l.fields, msg)
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+func TestStructuredFormatter(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	fields := LogFields{{Key: LOG_GROUP_ID, Value: int64(3)}, {Key: LOG_REQUEST_ID, Value: "a b"}}
+	for format, want := range map[string]string{
+		LOG_FORMAT_JSON:   `{"time":"2017-01-02T03:04:05Z","level":"error","pkg":"controller","msg":"publish \"x\" failed","group_id":3,"request_id":"a b"}` + "\n",
+		LOG_FORMAT_LOGFMT: `time=2017-01-02T03:04:05Z level=error pkg=controller msg="publish \"x\" failed" group_id=3 request_id="a b"` + "\n",
+	} {
+		buf := &bytes.Buffer{}
+		f, err := NewStructuredFormatter(buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.now = func() time.Time { return now }
+		f.Format("controller", capnslog.ERROR, 0, fields, "publish \"x\" failed\n")
+		if buf.String() != want {
+			t.Errorf("%s format:\n got %s\nwant %s", format, buf.String(), want)
+		}
+	}
+	if _, err := NewStructuredFormatter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
+
+func TestLoggerWith(t *testing.T) {
+	l := NewLogger(capnslog.NewPackageLogger("x", "test"), "test")
+	a := l.With(LOG_GROUP_ID, 1)
+	b := a.With(LOG_DOMAIN_ID, 2).With(LOG_GROUP_ID, 3)
+	if len(l.fields) != 0 || len(a.fields) != 1 || a.fields[0].Value != 1 {
+		t.Fatalf("With changed its parent: %v %v", l.fields, a.fields)
+	}
+	if len(b.fields) != 2 || b.fields[0].Key != LOG_DOMAIN_ID || b.fields[1].Value != 3 {
+		t.Fatalf("fields: %v", b.fields)
+	}
+}
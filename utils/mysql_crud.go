@@ -27,7 +27,7 @@ const (
 type MysqlInfo struct {
 	Host         string
 	User         string
-	Pass         string
+	Pass         string `secret:"true"`
 	DBName       string
 	MaxOpenConns int
 	MaxIdleConns int
@@ -69,6 +69,22 @@ func (mc *MysqlController) InitMysql(info *MysqlInfo) error {
 	return mc.db.Ping()
 }
 
+// SetMaxConns changes the pool size of an open db.
+func (mc *MysqlController) SetMaxConns(maxOpenConns, maxIdleConns int) {
+	if maxOpenConns == 0 {
+		maxOpenConns = DefaultOpenConns
+	}
+	if maxIdleConns == 0 {
+		maxIdleConns = DefaultIdleConns
+	}
+	mc.maxOpenConns = maxOpenConns
+	mc.maxIdleConns = maxIdleConns
+	if mc.db != nil {
+		mc.db.SetMaxOpenConns(mc.maxOpenConns)
+		mc.db.SetMaxIdleConns(mc.maxIdleConns)
+	}
+}
+
 func (mc *MysqlController) Close() {
 	if mc.db != nil {
 		mc.db.Close()
@@ -129,6 +145,71 @@ func (mc *MysqlController) Exec(sqlstr string, args ...interface{}) (int64, erro
 	return result.RowsAffected()
 }
 
+// modify in one transaction, each args is one execution of sqlstr
+func (mc *MysqlController) ExecBatch(sqlstr string, argsList ...[]interface{}) (int64, error) {
+	if !mc.checkDB() {
+		return 0, ErrMysqlNotInit
+	}
+
+	tx, err := mc.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	var affected int64
+	for _, args := range argsList {
+		result, err := tx.Exec(sqlstr, args...)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		affected += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// modify in one transaction, sqlstrs[i] runs with argsList[i]
+func (mc *MysqlController) ExecTx(sqlstrs []string, argsList ...[]interface{}) (int64, error) {
+	if !mc.checkDB() {
+		return 0, ErrMysqlNotInit
+	}
+	if len(sqlstrs) != len(argsList) {
+		return 0, errors.New("Mysql sqls and args differ in length.")
+	}
+
+	tx, err := mc.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	var affected int64
+	for i, sqlstr := range sqlstrs {
+		result, err := tx.Exec(sqlstr, argsList[i]...)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		affected += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
 // query, val type: string
 func (mc *MysqlController) FetchRow(sqlstr string, args ...interface{}) (*map[string]string, error) {
 	if !mc.checkDB() {
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RATE_LIMIT_MAX_KEYS = 100000
+)
+
+// RateLimiter is a token bucket per key: every key may burst requests at once,
+// then rate requests per second. A zero rate allows everything.
+// At most maxKeys buckets are kept, the idlest one makes room for a new key.
+type RateLimiter struct {
+	sync.Mutex
+
+	clock   Clock
+	rate    float64
+	burst   float64
+	maxKeys int
+	buckets map[string]*tokenBucket
+	// the buckets by last use, the idlest in front
+	lru   *list.List
+	sweep time.Time
+
+	allowed int64
+	limited int64
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	elem   *list.Element
+}
+
+type RateLimiterStats struct {
+	Rate    float64 `json:"rate"`
+	Burst   int     `json:"burst"`
+	Keys    int     `json:"keys"`
+	Allowed int64   `json:"allowed"`
+	Limited int64   `json:"limited"`
+}
+
+func NewRateLimiter(clock Clock, rate float64, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		clock:   clock,
+		maxKeys: DEFAULT_RATE_LIMIT_MAX_KEYS,
+		buckets: make(map[string]*tokenBucket),
+		lru:     list.New(),
+		sweep:   clock.Now(),
+	}
+	rl.SetLimit(rate, burst)
+	return rl
+}
+
+// SetLimit changes the limit of every key, burst is at least 1.
+func (rl *RateLimiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	rl.rate = rate
+	rl.burst = float64(burst)
+}
+
+// SetMaxKeys changes how many buckets are kept, at least 1.
+func (rl *RateLimiter) SetMaxKeys(n int) {
+	if n < 1 {
+		n = 1
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	rl.maxKeys = n
+}
+
+// Allow takes a token of key. When there is none it returns how long until there is.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	if rl.rate <= 0 {
+		rl.allowed++
+		return true, 0
+	}
+	now := rl.clock.Now()
+	rl.sweepIdle(now)
+
+	b := rl.buckets[key]
+	if b == nil {
+		for len(rl.buckets) >= rl.maxKeys {
+			rl.remove(rl.lru.Front().Value.(*tokenBucket))
+		}
+		b = &tokenBucket{key: key, tokens: rl.burst, last: now}
+		b.elem = rl.lru.PushBack(b)
+		rl.buckets[key] = b
+	} else {
+		rl.lru.MoveToBack(b.elem)
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		rl.allowed++
+		return true, 0
+	}
+	rl.limited++
+	return false, time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+}
+
+// sweepIdle drops buckets that are full again, at most once a minute; it must be called with the lock held.
+// A bucket unused for burst/rate seconds is full, so the sweep stops at the first one used since.
+func (rl *RateLimiter) sweepIdle(now time.Time) {
+	if now.Sub(rl.sweep) < time.Minute {
+		return
+	}
+	rl.sweep = now
+	refill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	for e := rl.lru.Front(); e != nil; {
+		b := e.Value.(*tokenBucket)
+		if now.Sub(b.last) < refill {
+			return
+		}
+		e = e.Next()
+		rl.remove(b)
+	}
+}
+
+// remove must be called with the lock held.
+func (rl *RateLimiter) remove(b *tokenBucket) {
+	rl.lru.Remove(b.elem)
+	delete(rl.buckets, b.key)
+}
+
+func (rl *RateLimiter) Stats() RateLimiterStats {
+	rl.Lock()
+	defer rl.Unlock()
+	return RateLimiterStats{
+		Rate:    rl.rate,
+		Burst:   int(rl.burst),
+		Keys:    len(rl.buckets),
+		Allowed: rl.allowed,
+		Limited: rl.limited,
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1500000000, 0))
+	rl := NewRateLimiter(clock, 2, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := rl.Allow("a"); !ok {
+			t.Fatalf("burst request %d limited", i)
+		}
+	}
+	ok, retry := rl.Allow("a")
+	if ok || retry != 500*time.Millisecond {
+		t.Fatalf("over burst: ok %v retry %v", ok, retry)
+	}
+	// other keys have their own bucket
+	if ok, _ := rl.Allow("b"); !ok {
+		t.Fatal("key b limited")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if ok, _ := rl.Allow("a"); !ok {
+		t.Fatal("refilled token limited")
+	}
+
+	clock.Advance(2 * time.Minute)
+	rl.Allow("c")
+	stats := rl.Stats()
+	if stats.Keys != 1 || stats.Allowed != 6 || stats.Limited != 1 {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	rl.SetLimit(0, 0)
+	for i := 0; i < 10; i++ {
+		if ok, _ := rl.Allow("c"); !ok {
+			t.Fatal("zero rate limited")
+		}
+	}
+}
+
+func TestRateLimiterMaxKeys(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1500000000, 0))
+	rl := NewRateLimiter(clock, 1, 1)
+	rl.SetMaxKeys(2)
+
+	rl.Allow("a")
+	clock.Advance(100 * time.Millisecond)
+	rl.Allow("b")
+	clock.Advance(100 * time.Millisecond)
+	rl.Allow("c")
+	if n := rl.Stats().Keys; n != 2 {
+		t.Fatalf("keys: got %d", n)
+	}
+	// a was the idlest and is gone, b keeps its empty bucket
+	if ok, _ := rl.Allow("b"); ok {
+		t.Errorf("b got a fresh bucket")
+	}
+	// b was used last, so c makes room for d
+	rl.Allow("d")
+	if ok, _ := rl.Allow("b"); ok {
+		t.Errorf("b was evicted before c")
+	}
+
+	// keys rotating past the cap keep it
+	for i := 0; i < 1000; i++ {
+		rl.Allow(fmt.Sprintf("ip-%d", i))
+	}
+	if n := rl.Stats().Keys; n != 2 {
+		t.Errorf("keys after rotation: got %d", n)
+	}
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"container/list"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scheduler is a hashed timing wheel: every task sits in the slot of its next run
+// with the number of full rounds left, so a tick only visits one slot.
+type Scheduler struct {
+	sync.Mutex
+
+	clock    Clock
+	interval time.Duration
+	slots    []*list.List
+	pos      int
+	randFn   func(n int64) int64
+
+	ticker Ticker
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Task is a periodic job of the scheduler. C fires once per run; a run is dropped
+// if the previous one is not received yet.
+type Task struct {
+	s *Scheduler
+
+	name     string
+	interval time.Duration
+	jitter   time.Duration
+	c        chan struct{}
+
+	next      time.Time
+	rounds    int
+	slot      int
+	elem      *list.Element
+	cancelled bool
+}
+
+type TaskInfo struct {
+	Name     string    `json:"name"`
+	Interval string    `json:"interval"`
+	Jitter   string    `json:"jitter"`
+	NextRun  time.Time `json:"nextRun"`
+}
+
+// NewScheduler creates a wheel of slots buckets turning one slot every interval.
+func NewScheduler(clock Clock, interval time.Duration, slots int) *Scheduler {
+	s := newScheduler(clock, interval, slots)
+	s.ticker = clock.NewTicker(interval)
+	go s.run()
+
+	return s
+}
+
+func newScheduler(clock Clock, interval time.Duration, slots int) *Scheduler {
+	if slots <= 0 {
+		slots = 1
+	}
+	s := &Scheduler{
+		clock:    clock,
+		interval: interval,
+		slots:    make([]*list.List, slots),
+		randFn:   rand.New(rand.NewSource(clock.Now().UnixNano())).Int63n,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i := range s.slots {
+		s.slots[i] = list.New()
+	}
+	return s
+}
+
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// Schedule adds a task running every interval, each run moved by up to ±jitter.
+// The first run is spread randomly over the first interval, so tasks added together do not fire together.
+func (s *Scheduler) Schedule(name string, interval, jitter time.Duration) *Task {
+	if interval < s.interval {
+		interval = s.interval
+	}
+	t := &Task{
+		s:        s,
+		name:     name,
+		interval: interval,
+		jitter:   jitter,
+		c:        make(chan struct{}, 1),
+	}
+	s.Lock()
+	s.add(t, time.Duration(s.random(int64(interval))))
+	s.Unlock()
+
+	return t
+}
+
+// Tasks lists the scheduled tasks ordered by next run.
+func (s *Scheduler) Tasks() []TaskInfo {
+	s.Lock()
+	defer s.Unlock()
+
+	list := make([]TaskInfo, 0)
+	for _, l := range s.slots {
+		for e := l.Front(); e != nil; e = e.Next() {
+			t := e.Value.(*Task)
+			list = append(list, TaskInfo{
+				Name:     t.name,
+				Interval: t.interval.String(),
+				Jitter:   t.jitter.String(),
+				NextRun:  t.next,
+			})
+		}
+	}
+	sort.Sort(taskInfoSorter(list))
+	return list
+}
+
+func (s *Scheduler) run() {
+	for {
+		select {
+		case <-s.ticker.Chan():
+			s.onTicker()
+		case <-s.stop:
+			s.ticker.Stop()
+			close(s.done)
+			return
+		}
+	}
+}
+
+func (s *Scheduler) onTicker() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pos = (s.pos + 1) % len(s.slots)
+	l := s.slots[s.pos]
+	var next *list.Element
+	for e := l.Front(); e != nil; e = next {
+		next = e.Next()
+		t := e.Value.(*Task)
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		t.fire()
+		s.remove(t)
+		s.add(t, t.nextDelay())
+	}
+}
+
+// add must be called with the lock held.
+func (s *Scheduler) add(t *Task, delay time.Duration) {
+	ticks := int((delay + s.interval - 1) / s.interval)
+	if ticks < 1 {
+		ticks = 1
+	}
+	t.slot = (s.pos + ticks) % len(s.slots)
+	t.rounds = (ticks - 1) / len(s.slots)
+	t.next = s.clock.Now().Add(time.Duration(ticks) * s.interval)
+	t.elem = s.slots[t.slot].PushBack(t)
+}
+
+// remove must be called with the lock held.
+func (s *Scheduler) remove(t *Task) {
+	if t.elem != nil {
+		s.slots[t.slot].Remove(t.elem)
+		t.elem = nil
+	}
+}
+
+func (s *Scheduler) random(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	return s.randFn(n)
+}
+
+func (t *Task) Name() string {
+	return t.name
+}
+
+func (t *Task) C() <-chan struct{} {
+	return t.c
+}
+
+func (t *Task) NextRun() time.Time {
+	t.s.Lock()
+	defer t.s.Unlock()
+	return t.next
+}
+
+func (t *Task) Interval() time.Duration {
+	t.s.Lock()
+	defer t.s.Unlock()
+	return t.interval
+}
+
+// Cancel removes the task, C never fires again.
+func (t *Task) Cancel() {
+	t.s.Lock()
+	defer t.s.Unlock()
+	t.cancelled = true
+	t.s.remove(t)
+}
+
+// RunNow fires the task at once and restarts its interval.
+func (t *Task) RunNow() {
+	t.s.Lock()
+	defer t.s.Unlock()
+	if t.cancelled {
+		return
+	}
+	t.fire()
+	t.s.remove(t)
+	t.s.add(t, t.nextDelay())
+}
+
+// SetInterval changes the interval, the next run is rescheduled if it is too far away.
+func (t *Task) SetInterval(interval time.Duration) {
+	t.s.Lock()
+	defer t.s.Unlock()
+	if interval < t.s.interval {
+		interval = t.s.interval
+	}
+	if t.cancelled || interval == t.interval {
+		return
+	}
+	t.interval = interval
+	if t.next.Sub(t.s.clock.Now()) > interval {
+		t.s.remove(t)
+		t.s.add(t, t.nextDelay())
+	}
+}
+
+func (t *Task) fire() {
+	select {
+	case t.c <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Task) nextDelay() time.Duration {
+	if t.jitter <= 0 {
+		return t.interval
+	}
+	return t.interval - t.jitter + time.Duration(t.s.random(int64(2*t.jitter)+1))
+}
+
+type taskInfoSorter []TaskInfo
+
+func (s taskInfoSorter) Len() int      { return len(s) }
+func (s taskInfoSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s taskInfoSorter) Less(i, j int) bool {
+	if !s[i].NextRun.Equal(s[j].NextRun) {
+		return s[i].NextRun.Before(s[j].NextRun)
+	}
+	return s[i].Name < s[j].Name
+}
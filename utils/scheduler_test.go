@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(slots int) (*Scheduler, *FakeClock) {
+	clock := NewFakeClock(time.Unix(1500000000, 0))
+	s := newScheduler(clock, time.Second, slots)
+	s.randFn = func(n int64) int64 { return 0 }
+	return s, clock
+}
+
+// runTicks turns the wheel n times and returns the ticks on which the task fired.
+func runTicks(s *Scheduler, clock *FakeClock, t *Task, n int) []int {
+	var fired []int
+	for i := 1; i <= n; i++ {
+		clock.Advance(time.Second)
+		s.onTicker()
+		select {
+		case <-t.C():
+			fired = append(fired, i)
+		default:
+		}
+	}
+	return fired
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	s, clock := newTestScheduler(10)
+	short := s.Schedule("short", 3*time.Second, 0)
+	fired := runTicks(s, clock, short, 10)
+	if !equalInts(fired, []int{1, 4, 7, 10}) {
+		t.Fatalf("short task fired at %v", fired)
+	}
+
+	// longer than one round of the wheel
+	s, clock = newTestScheduler(10)
+	long := s.Schedule("long", 25*time.Second, 0)
+	fired = runTicks(s, clock, long, 60)
+	if !equalInts(fired, []int{1, 26, 51}) {
+		t.Fatalf("long task fired at %v", fired)
+	}
+}
+
+func TestSchedulerSpread(t *testing.T) {
+	s, clock := newTestScheduler(10)
+	s.randFn = func(n int64) int64 { return n - 1 }
+	task := s.Schedule("spread", 5*time.Second, 0)
+	fired := runTicks(s, clock, task, 12)
+	if !equalInts(fired, []int{5, 10}) {
+		t.Fatalf("spread task fired at %v", fired)
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	s, clock := newTestScheduler(10)
+	task := s.Schedule("jitter", 5*time.Second, 2*time.Second)
+	fired := runTicks(s, clock, task, 1)
+	// rand 0 is the lowest jitter
+	if next := task.NextRun(); !next.Equal(clock.Now().Add(3 * time.Second)) {
+		t.Fatalf("jitter next run %v, now %v", next, clock.Now())
+	}
+	s.randFn = func(n int64) int64 { return n - 1 }
+	fired = runTicks(s, clock, task, 10)
+	if !equalInts(fired, []int{3, 10}) {
+		t.Fatalf("jitter task fired at %v", fired)
+	}
+}
+
+func TestSchedulerCancelAndRunNow(t *testing.T) {
+	s, clock := newTestScheduler(10)
+	cancelled := s.Schedule("cancelled", 2*time.Second, 0)
+	cancelled.Cancel()
+	cancelled.RunNow()
+	if fired := runTicks(s, clock, cancelled, 10); len(fired) != 0 {
+		t.Fatalf("cancelled task fired at %v", fired)
+	}
+	if len(s.Tasks()) != 0 {
+		t.Fatalf("cancelled task still listed: %v", s.Tasks())
+	}
+
+	task := s.Schedule("now", 5*time.Second, 0)
+	runTicks(s, clock, task, 2)
+	task.RunNow()
+	select {
+	case <-task.C():
+	default:
+		t.Fatal("run now did not fire")
+	}
+	if next := task.NextRun(); !next.Equal(clock.Now().Add(5 * time.Second)) {
+		t.Fatalf("run now should restart interval, next run %v, now %v", next, clock.Now())
+	}
+}
+
+func TestSchedulerSetIntervalAndTasks(t *testing.T) {
+	s, clock := newTestScheduler(10)
+	a := s.Schedule("a", 20*time.Second, 0)
+	b := s.Schedule("b", 4*time.Second, 0)
+	runTicks(s, clock, a, 1)
+
+	a.SetInterval(2 * time.Second)
+	if a.Interval() != 2*time.Second {
+		t.Fatalf("interval not changed: %v", a.Interval())
+	}
+	tasks := s.Tasks()
+	if len(tasks) != 2 || tasks[0].Name != "a" || tasks[1].Name != "b" {
+		t.Fatalf("tasks should be ordered by next run: %v", tasks)
+	}
+	if !tasks[0].NextRun.Equal(clock.Now().Add(2 * time.Second)) {
+		t.Fatalf("a next run %v, now %v", tasks[0].NextRun, clock.Now())
+	}
+	if fired := runTicks(s, clock, a, 4); !equalInts(fired, []int{2, 4}) {
+		t.Fatalf("a fired at %v", fired)
+	}
+	<-b.C()
+}
+
+func TestSchedulerRun(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1500000000, 0))
+	s := NewScheduler(clock, time.Second, 10)
+	defer s.Stop()
+	task := s.Schedule("run", 3*time.Second, 0)
+	next := task.NextRun()
+
+	clock.Advance(next.Sub(clock.Now()))
+	select {
+	case <-task.C():
+	case <-time.After(time.Second):
+		t.Fatal("task did not fire")
+	}
+}
+
+// TestSchedulerConcurrent is meant for -race: callers change tasks while the wheel turns.
+func TestSchedulerConcurrent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1500000000, 0))
+	s := NewScheduler(clock, time.Second, 10)
+	defer s.Stop()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				task := s.Schedule("concurrent", time.Duration(1+n%5)*time.Second, time.Second)
+				task.RunNow()
+				select {
+				case <-task.C():
+				default:
+				}
+				task.SetInterval(time.Duration(2+(n+i)%7) * time.Second)
+				task.NextRun()
+				s.Tasks()
+				task.Cancel()
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			if n := len(s.Tasks()); n != 0 {
+				t.Errorf("%d tasks left after cancel", n)
+			}
+			return
+		default:
+			clock.Advance(time.Second)
+		}
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1500000000, 0))
+	s := NewScheduler(clock, time.Second, 10)
+	task := s.Schedule("stopped", 2*time.Second, 0)
+	if clock.Waiters() != 1 {
+		t.Fatalf("waiters before stop: %d, want the ticker", clock.Waiters())
+	}
+
+	s.Stop()
+	select {
+	case <-s.done:
+	default:
+		t.Fatal("run did not return")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("waiters after stop: %d, the ticker is not stopped", clock.Waiters())
+	}
+	// with the ticker stopped Advance does not wait for the wheel
+	clock.Advance(time.Minute)
+	select {
+	case <-task.C():
+		t.Error("task fired after stop")
+	default:
+	}
+}